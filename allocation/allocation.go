@@ -0,0 +1,133 @@
+package allocation
+
+import (
+	"fmt"
+	gen "github.com/pintobikez/stock-service/api/structures"
+	"sort"
+)
+
+const (
+	Priority      = "priority"
+	MostAvailable = "most_available"
+	Split         = "split"
+
+	DefaultStrategy = Priority
+)
+
+// Chooses the warehouses that hold the units of a reservation
+// Values are the stock of the sku per warehouse, and warehouses the active warehouses it may be allocated from
+// Allocate fails with 409 when the warehouses can not hold the quantity
+type Strategy interface {
+	Allocate(quantity int64, values []gen.SkuValues, warehouses map[string]gen.Warehouse) ([]gen.Allocation, error)
+}
+
+// Allocates with a plain function
+type StrategyFunc func(quantity int64, values []gen.SkuValues, warehouses map[string]gen.Warehouse) ([]gen.Allocation, error)
+
+func (f StrategyFunc) Allocate(quantity int64, values []gen.SkuValues, warehouses map[string]gen.Warehouse) ([]gen.Allocation, error) {
+	return f(quantity, values, warehouses)
+}
+
+var strategies = map[string]Strategy{
+	Priority:      StrategyFunc(priority),
+	MostAvailable: StrategyFunc(mostAvailable),
+	Split:         StrategyFunc(split),
+}
+
+// Registers a Strategy under the given name, replacing any with the same name
+func Register(name string, s Strategy) {
+	strategies[name] = s
+}
+
+// Retrieves the Strategy registered under the given name
+func Get(name string) (Strategy, error) {
+	s, ok := strategies[name]
+	if !ok {
+		return nil, fmt.Errorf("Strategy %s is not one of %v", name, Names())
+	}
+	return s, nil
+}
+
+// Retrieves the names of every registered Strategy, sorted
+func Names() []string {
+	var names []string
+	for name := range strategies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Holds every unit in the preferred warehouse that has them available
+func priority(quantity int64, values []gen.SkuValues, warehouses map[string]gen.Warehouse) ([]gen.Allocation, error) {
+	for _, v := range candidates(values, warehouses) {
+		if v.Available >= quantity {
+			return []gen.Allocation{{Warehouse: v.Warehouse, Quantity: quantity}}, nil
+		}
+	}
+	return nil, fmt.Errorf("409")
+}
+
+// Holds every unit in the warehouse with the most units available
+func mostAvailable(quantity int64, values []gen.SkuValues, warehouses map[string]gen.Warehouse) ([]gen.Allocation, error) {
+	var best *gen.SkuValues
+
+	for _, v := range candidates(values, warehouses) {
+		if best == nil || v.Available > best.Available {
+			v := v
+			best = &v
+		}
+	}
+
+	if best == nil || best.Available < quantity {
+		return nil, fmt.Errorf("409")
+	}
+	return []gen.Allocation{{Warehouse: best.Warehouse, Quantity: quantity}}, nil
+}
+
+// Holds the units across as many warehouses as needed, the preferred ones first
+func split(quantity int64, values []gen.SkuValues, warehouses map[string]gen.Warehouse) ([]gen.Allocation, error) {
+	var allocations []gen.Allocation
+	missing := quantity
+
+	for _, v := range candidates(values, warehouses) {
+		if missing == 0 {
+			break
+		}
+		if v.Available <= 0 {
+			continue
+		}
+
+		take := v.Available
+		if take > missing {
+			take = missing
+		}
+		allocations = append(allocations, gen.Allocation{Warehouse: v.Warehouse, Quantity: take})
+		missing -= take
+	}
+
+	if missing > 0 {
+		return nil, fmt.Errorf("409")
+	}
+	return allocations, nil
+}
+
+// Retrieves the values of the active warehouses, the preferred ones first
+func candidates(values []gen.SkuValues, warehouses map[string]gen.Warehouse) []gen.SkuValues {
+	var found []gen.SkuValues
+	for _, v := range values {
+		if w, ok := warehouses[v.Warehouse]; ok && w.Active {
+			found = append(found, v)
+		}
+	}
+
+	sort.SliceStable(found, func(i, j int) bool {
+		a, b := warehouses[found[i].Warehouse], warehouses[found[j].Warehouse]
+		if a.Priority != b.Priority {
+			return a.Priority < b.Priority
+		}
+		return a.Code < b.Code
+	})
+
+	return found
+}
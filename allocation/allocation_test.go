@@ -0,0 +1,78 @@
+package allocation
+
+import (
+	gen "github.com/pintobikez/stock-service/api/structures"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+var testWarehouses = map[string]gen.Warehouse{
+	"A": {Code: "A", Active: true, Priority: 2},
+	"B": {Code: "B", Active: true, Priority: 1},
+	"C": {Code: "C", Active: true, Priority: 1},
+	"D": {Code: "D", Active: false, Priority: 0},
+}
+
+var testValues = []gen.SkuValues{
+	{Warehouse: "A", Quantity: 10, Available: 8},
+	{Warehouse: "B", Quantity: 3, Available: 3},
+	{Warehouse: "C", Quantity: 6, Reserved: 1, Available: 5},
+	{Warehouse: "D", Quantity: 50, Available: 50},
+	{Warehouse: "E", Quantity: 50, Available: 50},
+}
+
+/*
+Tests for the allocation strategies
+*/
+type allocateProvider struct {
+	strategy    string
+	quantity    int64
+	allocations []gen.Allocation
+	err         string
+}
+
+var testAllocateProvider = []allocateProvider{
+	{Priority, 2, []gen.Allocation{{Warehouse: "B", Quantity: 2}}, ""}, // preferred warehouse
+	{Priority, 4, []gen.Allocation{{Warehouse: "C", Quantity: 4}}, ""}, // same priority, by code
+	{Priority, 7, []gen.Allocation{{Warehouse: "A", Quantity: 7}}, ""}, // least preferred warehouse
+	{Priority, 9, nil, "409"}, // no warehouse holds every unit, inactive and unknown ones ignored
+	{MostAvailable, 2, []gen.Allocation{{Warehouse: "A", Quantity: 2}}, ""},                                                        // most available warehouse
+	{MostAvailable, 9, nil, "409"},                                                                                                 // not enough in the most available warehouse
+	{Split, 2, []gen.Allocation{{Warehouse: "B", Quantity: 2}}, ""},                                                                // a single warehouse is enough
+	{Split, 10, []gen.Allocation{{Warehouse: "B", Quantity: 3}, {Warehouse: "C", Quantity: 5}, {Warehouse: "A", Quantity: 2}}, ""}, // across warehouses
+	{Split, 16, []gen.Allocation{{Warehouse: "B", Quantity: 3}, {Warehouse: "C", Quantity: 5}, {Warehouse: "A", Quantity: 8}}, ""}, // every unit available
+	{Split, 17, nil, "409"}, // not enough in every warehouse
+}
+
+func TestAllocate(t *testing.T) {
+	for _, pair := range testAllocateProvider {
+		s, err := Get(pair.strategy)
+		assert.NoError(t, err)
+
+		allocations, err := s.Allocate(pair.quantity, testValues, testWarehouses)
+		if pair.err != "" {
+			assert.EqualError(t, err, pair.err, "Error doesn't match")
+			continue
+		}
+
+		assert.NoError(t, err)
+		assert.Equal(t, pair.allocations, allocations, "Allocations of "+pair.strategy+" don't match")
+	}
+}
+
+func TestRegister(t *testing.T) {
+	_, err := Get("nearest")
+	assert.Error(t, err)
+
+	Register("nearest", StrategyFunc(func(quantity int64, values []gen.SkuValues, warehouses map[string]gen.Warehouse) ([]gen.Allocation, error) {
+		return []gen.Allocation{{Warehouse: "C", Quantity: quantity}}, nil
+	}))
+	defer delete(strategies, "nearest")
+
+	s, err := Get("nearest")
+	assert.NoError(t, err)
+
+	allocations, _ := s.Allocate(1, testValues, testWarehouses)
+	assert.Equal(t, []gen.Allocation{{Warehouse: "C", Quantity: 1}}, allocations, "Allocations don't match")
+	assert.Equal(t, []string{MostAvailable, "nearest", Priority, Split}, Names(), "Names don't match")
+}
@@ -3,33 +3,99 @@ package api
 import (
 	"fmt"
 	"github.com/labstack/echo"
+	alloc "github.com/pintobikez/stock-service/allocation"
 	strut "github.com/pintobikez/stock-service/api/structures"
+	cnfs "github.com/pintobikez/stock-service/config/structures"
 	pub "github.com/pintobikez/stock-service/publisher"
 	repo "github.com/pintobikez/stock-service/repository"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 )
 
 const (
 	StatusAvailable   = "Available"
 	StatusUnavailable = "Unavailable"
 
-	SkuNotFound            = "Sku %s not found"
-	ReservationDeleteError = "No reservation found for Sku %s and Warehouse %s"
+	HeaderCaller = "X-Caller"
+
+	DefaultHistoryLimit = 50
+	MaxHistoryLimit     = 500
+	MaxQuerySkus        = 500
+	DefaultListLimit    = 50
+	MaxListLimit        = 500
+	AllocationAttempts  = 3
 
-	ErrorCodeSkuNotFound       = 1001
-	ErrorCodeWrongJsonFormat   = 1002
-	ErrorCodeInvalidContent    = 1003
-	ErrorCodeStoringContent    = 1004
-	ErrorCodePublishingMessage = 1005
+	SkuNotFound            = "Sku %s not found"
+	SkuWarehouseNotFound   = "Sku %s not found in Warehouse %s"
+	InsufficientStock      = "Not enough stock of Sku %s in Warehouse %s to reserve %d units"
+	InsufficientAllocation = "Not enough stock of Sku %s to allocate %d units with the %s strategy"
+	VersionMismatch        = "Version of Sku %s in Warehouse %s has changed"
+	ReservationNotFound    = "Reservation %d not found"
+	ReservationDeleteError = "Reservation %d does not hold %d units"
+	AdjustmentNotFound     = "Adjustment %d not found"
+	AdjustmentNegative     = "Quantity is below the backorder limit after the adjustment"
+	AdjustmentNotStored    = "A Sku of the adjustment is not stored in its Warehouse"
+	WarehouseNotFound      = "Warehouse %s not found"
+	WarehouseInactive      = "Warehouse %s is inactive"
+	WarehouseExists        = "Warehouse %s already exists"
+	WarehouseInUse         = "Warehouse %s still holds stock or reservations"
+	TransferNotFound       = "Transfer %d not found"
+	TransferStatus         = "Transfer %d is %s"
+	TransferInsufficient   = "Not enough stock of Sku %s in Warehouse %s to ship %d units"
+	InboundNotFound        = "Inbound %d not found"
+	InboundStatus          = "Inbound %d is %s"
+	InboundPromised        = "Inbound %d is promised to the reservations of Sku %s in Warehouse %s"
+	BackorderExceeded      = "Quantity of Sku %s in Warehouse %s is below its backorder limit"
+	SerialTracked          = "Quantity of Sku %s is derived from its serial numbers"
+	SerialNotFound         = "Serial %s of Sku %s not found"
+	SerialExists           = "A serial of Sku %s is already registered"
+	SerialInUse            = "Serial %s of Sku %s is held by a reservation"
+	SerialsNotFree         = "Serials of Sku %s are not free in Warehouse %s"
+	SerialsNotHeld         = "Reservation %d does not hold serials %v"
+	SkuInUse               = "Sku %s still holds stock"
+	CommitInsufficient     = "Not enough stock of Sku %s in Warehouse %s to commit %d units"
+
+	ErrorCodeSkuNotFound         = 1001
+	ErrorCodeWrongJsonFormat     = 1002
+	ErrorCodeInvalidContent      = 1003
+	ErrorCodeStoringContent      = 1004
+	ErrorCodePublishingMessage   = 1005
+	ErrorCodeReservationNotFound = 1006
+	ErrorCodeInsufficientStock   = 1007
+	ErrorCodeVersionMismatch     = 1008
+	ErrorCodeAdjustmentNotFound  = 1009
+	ErrorCodeWarehouseNotFound   = 1010
+	ErrorCodeWarehouseExists     = 1011
+	ErrorCodeWarehouseInUse      = 1012
+	ErrorCodeTransferNotFound    = 1013
+	ErrorCodeTransferStatus      = 1014
+	ErrorCodeInboundNotFound     = 1015
+	ErrorCodeInboundStatus       = 1016
+	ErrorCodeSerialNotFound      = 1017
+	ErrorCodeSerialExists        = 1018
+	ErrorCodeSerialInUse         = 1019
+	ErrorCodeSkuInUse            = 1020
+	ErrorCodeOrderExists         = 1021
 )
 
 type API struct {
-	rp repo.Repository
-	pb pub.PubSub
+	rp   repo.Repository
+	pb   pub.PubSub
+	cnfg *cnfs.ServiceConfig
+}
+
+// An error of the repository met while validating a request, which is not the fault of the request
+type repoError struct {
+	error
 }
 
-func New(rpo repo.Repository, p pub.PubSub) *API {
-	return &API{rp: rpo, pb: p}
+func New(rpo repo.Repository, p pub.PubSub, cnfg *cnfs.ServiceConfig) *API {
+	if cnfg == nil {
+		cnfg = new(cnfs.ServiceConfig)
+	}
+	return &API{rp: rpo, pb: p, cnfg: cnfg}
 }
 
 // Handler for Health Status
@@ -59,16 +125,125 @@ func (a *API) GetStock() echo.HandlerFunc {
 	return func(c echo.Context) error {
 
 		skuValue := c.Param("sku")
-		skuResponse, err := a.rp.FindSku(skuValue)
 
+		// the stock the sku had at a past moment, rebuilt from its movements
+		if v := c.QueryParam("as_of"); v != "" {
+			asOf, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return c.JSON(http.StatusBadRequest, &strut.ErrResponse{strut.ErrContent{ErrorCodeInvalidContent, fmt.Sprintf("As_of %s is not a RFC3339 date", v)}})
+			}
+
+			skuResponse, err := a.rp.FindSkuAsOf(skuValue, asOf)
+			if err != nil {
+				return c.JSON(http.StatusNotFound, &strut.ErrResponse{strut.ErrContent{ErrorCodeSkuNotFound, err.Error()}})
+			}
+
+			return c.JSON(http.StatusOK, skuResponse)
+		}
+
+		view := c.QueryParam("view")
+		if view != "" && view != strut.ViewAtp {
+			return c.JSON(http.StatusBadRequest, &strut.ErrResponse{strut.ErrContent{ErrorCodeInvalidContent, fmt.Sprintf("View %s is not %s", view, strut.ViewAtp)}})
+		}
+
+		skuResponse, err := a.rp.FindSku(skuValue)
 		if err != nil {
 			return c.JSON(http.StatusNotFound, &strut.ErrResponse{strut.ErrContent{ErrorCodeSkuNotFound, err.Error()}})
 		}
 
+		// the units that can be promised over time, with the expected inbound supply
+		if view == strut.ViewAtp {
+			inbounds, err := a.rp.FindInbounds(skuValue, c.QueryParam("warehouse"))
+			if err != nil {
+				return c.JSON(http.StatusInternalServerError, &strut.ErrResponse{strut.ErrContent{ErrorCodeInboundNotFound, err.Error()}})
+			}
+
+			return c.JSON(http.StatusOK, repo.AvailableToPromise(skuResponse, inbounds, c.QueryParam("warehouse"), time.Now().UTC().Truncate(time.Second)))
+		}
+
+		// the units the channel can take, out of the allocations of the other channels
+		if channel := c.QueryParam("channel"); channel != "" {
+			skuResponse = repo.ForChannel(skuResponse, channel)
+		}
+
+		setETag(c, skuResponse, c.QueryParam("warehouse"))
+
 		return c.JSON(http.StatusOK, skuResponse)
 	}
 }
 
+// Handler to POST Stock query request
+// Skus not found are listed in missing instead of failing the request
+func (a *API) QueryStock() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		q := new(strut.SkuQuery)
+
+		if err := c.Bind(q); err != nil {
+			return c.JSON(http.StatusBadRequest, &strut.ErrResponse{strut.ErrContent{ErrorCodeWrongJsonFormat, err.Error()}})
+		}
+
+		var skus []string
+		seen := make(map[string]bool)
+		for _, sku := range q.Skus {
+			if sku == "" {
+				return c.JSON(http.StatusBadRequest, &strut.ErrResponse{strut.ErrContent{ErrorCodeInvalidContent, "Sku is empty"}})
+			}
+			if !seen[sku] {
+				seen[sku] = true
+				skus = append(skus, sku)
+			}
+		}
+		if len(skus) == 0 {
+			return c.JSON(http.StatusBadRequest, &strut.ErrResponse{strut.ErrContent{ErrorCodeInvalidContent, "Skus are empty"}})
+		}
+		if len(skus) > MaxQuerySkus {
+			return c.JSON(http.StatusBadRequest, &strut.ErrResponse{strut.ErrContent{ErrorCodeInvalidContent, fmt.Sprintf("Skus are more than %d", MaxQuerySkus)}})
+		}
+
+		found, err := a.rp.FindSkus(skus)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, &strut.ErrResponse{strut.ErrContent{ErrorCodeStoringContent, err.Error()}})
+		}
+
+		resp := &strut.SkuQueryResponse{Skus: found, Missing: []string{}}
+		for _, sku := range skus {
+			if _, ok := found[sku]; !ok {
+				resp.Missing = append(resp.Missing, sku)
+			}
+		}
+
+		return c.JSON(http.StatusOK, resp)
+	}
+}
+
+// Handler to GET Stock History request
+func (a *API) GetStockHistory() echo.HandlerFunc {
+	return func(c echo.Context) error {
+
+		f, err := movementFilter(c)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, &strut.ErrResponse{strut.ErrContent{ErrorCodeInvalidContent, err.Error()}})
+		}
+
+		// one more movement than asked tells if there is a next page
+		limit := f.Limit
+		f.Limit++
+
+		movements, err := a.rp.FindMovements(f)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, &strut.ErrResponse{strut.ErrContent{ErrorCodeStoringContent, err.Error()}})
+		}
+
+		resp := &strut.StockHistory{Sku: f.Sku, Movements: movements}
+		if int64(len(movements)) > limit {
+			resp.Movements = movements[:limit]
+			resp.NextCursor = strconv.FormatInt(movements[limit-1].Id, 10)
+		}
+
+		return c.JSON(http.StatusOK, resp)
+	}
+}
+
 // Handler to PUT Stock request
 func (a *API) PutStock() echo.HandlerFunc {
 	return func(c echo.Context) error {
@@ -83,33 +258,79 @@ func (a *API) PutStock() echo.HandlerFunc {
 		s.Sku = c.Param("sku")
 
 		if err := a.validateSku(s); err != nil {
+			if _, ok := err.(repoError); ok {
+				return c.JSON(http.StatusInternalServerError, &strut.ErrResponse{strut.ErrContent{ErrorCodeStoringContent, err.Error()}})
+			}
 			return c.JSON(http.StatusBadRequest, &strut.ErrResponse{strut.ErrContent{ErrorCodeInvalidContent, err.Error()}})
 		}
 
-		f, err := a.rp.FindBySkuAndWharehouse(s.Sku, s.Warehouse)
+		version, err := ifMatch(c)
 		if err != nil {
-			return c.JSON(http.StatusInternalServerError, &strut.ErrResponse{strut.ErrContent{ErrorCodeSkuNotFound, err.Error()}})
+			return c.JSON(http.StatusBadRequest, &strut.ErrResponse{strut.ErrContent{ErrorCodeInvalidContent, err.Error()}})
 		}
+		s.Version = version
+		s.RequestId, s.Caller = origin(c)
 
-		if f.Sku != "" {
+		switch c.Param("action") {
+		case "add", "sub":
+			delta := s.Quantity
+			if c.Param("action") == "sub" {
+				delta = -delta
+			}
 
-			if c.Param("action") == "add" {
-				s.Quantity += f.Quantity
+			// only a set can take a negative quantity
+			if s.Quantity < 0 {
+				return c.JSON(http.StatusBadRequest, &strut.ErrResponse{strut.ErrContent{ErrorCodeInvalidContent, "Quantity is negative"}})
 			}
-			if c.Param("action") == "sub" {
-				s.Quantity = f.Quantity - s.Quantity
+
+			// nothing changes when adding or subtracting zero units
+			if delta == 0 {
+				af = 0
+				break
 			}
+
+			if _, err := a.rp.AdjustSku(s, delta); err != nil {
+				switch err.Error() {
+				case "404":
+					return c.JSON(http.StatusNotFound, &strut.ErrResponse{strut.ErrContent{ErrorCodeSkuNotFound, fmt.Sprintf(SkuWarehouseNotFound, s.Sku, s.Warehouse)}})
+				case "409":
+					return c.JSON(http.StatusConflict, &strut.ErrResponse{strut.ErrContent{ErrorCodeInsufficientStock, fmt.Sprintf(BackorderExceeded, s.Sku, s.Warehouse)}})
+				case "412":
+					return c.JSON(http.StatusPreconditionFailed, &strut.ErrResponse{strut.ErrContent{ErrorCodeVersionMismatch, fmt.Sprintf(VersionMismatch, s.Sku, s.Warehouse)}})
+				}
+				return c.JSON(http.StatusInternalServerError, &strut.ErrResponse{strut.ErrContent{ErrorCodeStoringContent, err.Error()}})
+			}
+		default:
+			// a set below zero only takes the quantity down to the backorder limit of the sku
 			if s.Quantity < 0 {
-				return c.JSON(http.StatusBadRequest, &strut.ErrResponse{strut.ErrContent{ErrorCodeInvalidContent, fmt.Sprintf("Quantity is negative after subtraction")}})
+				st, err := a.rp.FindSkuSettings(s.Sku)
+				if err != nil {
+					return c.JSON(http.StatusInternalServerError, &strut.ErrResponse{strut.ErrContent{ErrorCodeSkuNotFound, err.Error()}})
+				}
+				if s.Quantity < repo.BackorderFloor(st) {
+					return c.JSON(http.StatusConflict, &strut.ErrResponse{strut.ErrContent{ErrorCodeInsufficientStock, fmt.Sprintf(BackorderExceeded, s.Sku, s.Warehouse)}})
+				}
 			}
 
-			af, err = a.rp.UpdateSku(s)
+			f, err := a.rp.FindBySkuAndWharehouse(s.Sku, s.Warehouse)
 			if err != nil {
-				return c.JSON(http.StatusInternalServerError, &strut.ErrResponse{strut.ErrContent{ErrorCodeStoringContent, err.Error()}})
+				return c.JSON(http.StatusInternalServerError, &strut.ErrResponse{strut.ErrContent{ErrorCodeSkuNotFound, err.Error()}})
 			}
-		} else {
-			if err := a.rp.InsertSku(s); err != nil {
-				return c.JSON(http.StatusInternalServerError, &strut.ErrResponse{strut.ErrContent{ErrorCodeStoringContent, err.Error()}})
+
+			if f.Sku != "" {
+				af, err = a.rp.UpdateSku(s)
+				if err != nil {
+					if err.Error() == "412" {
+						return c.JSON(http.StatusPreconditionFailed, &strut.ErrResponse{strut.ErrContent{ErrorCodeVersionMismatch, fmt.Sprintf(VersionMismatch, s.Sku, s.Warehouse)}})
+					}
+					return c.JSON(http.StatusInternalServerError, &strut.ErrResponse{strut.ErrContent{ErrorCodeStoringContent, err.Error()}})
+				}
+			} else if s.Version > 0 {
+				return c.JSON(http.StatusPreconditionFailed, &strut.ErrResponse{strut.ErrContent{ErrorCodeVersionMismatch, fmt.Sprintf(VersionMismatch, s.Sku, s.Warehouse)}})
+			} else {
+				if err := a.rp.InsertSku(s); err != nil {
+					return c.JSON(http.StatusInternalServerError, &strut.ErrResponse{strut.ErrContent{ErrorCodeStoringContent, err.Error()}})
+				}
 			}
 		}
 
@@ -119,9 +340,11 @@ func (a *API) PutStock() echo.HandlerFunc {
 				return c.JSON(http.StatusNotFound, &strut.ErrResponse{strut.ErrContent{ErrorCodeSkuNotFound, fmt.Sprintf(SkuNotFound, s.Sku)}})
 			}
 
-			if err := a.pb.Publish(skuResponse); err != nil {
+			if err := a.publish(skuResponse); err != nil {
 				return c.JSON(http.StatusInternalServerError, &strut.ErrResponse{strut.ErrContent{ErrorCodePublishingMessage, err.Error()}})
 			}
+
+			setETag(c, skuResponse, s.Warehouse)
 		}
 
 		return c.NoContent(http.StatusOK)
@@ -137,24 +360,52 @@ func (a *API) PutReservation() echo.HandlerFunc {
 			return c.JSON(http.StatusBadRequest, &strut.ErrResponse{strut.ErrContent{ErrorCodeWrongJsonFormat, err.Error()}})
 		}
 		res.Sku = c.Param("sku")
+		res.RequestId, res.Caller = origin(c)
 
 		if httpcode, code, err := a.processReservation(res, true); err != nil {
 			return c.JSON(httpcode, &strut.ErrResponse{strut.ErrContent{code, err.Error()}})
 		}
 
-		return c.NoContent(http.StatusOK)
+		return c.JSON(http.StatusOK, res)
+	}
+}
+
+// Handler to GET Reservation request
+func (a *API) GetReservation() echo.HandlerFunc {
+	return func(c echo.Context) error {
+
+		id, err := reservationId(c)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, &strut.ErrResponse{strut.ErrContent{ErrorCodeInvalidContent, err.Error()}})
+		}
+
+		res, err := a.rp.FindReservation(id)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, &strut.ErrResponse{strut.ErrContent{ErrorCodeReservationNotFound, err.Error()}})
+		}
+		if res.Id == 0 {
+			return c.JSON(http.StatusNotFound, &strut.ErrResponse{strut.ErrContent{ErrorCodeReservationNotFound, fmt.Sprintf(ReservationNotFound, id)}})
+		}
+
+		return c.JSON(http.StatusOK, res)
 	}
 }
 
 // Handler to DELETE Reservation request
 func (a *API) RemoveReservation() echo.HandlerFunc {
 	return func(c echo.Context) error {
-		var res *strut.Reservation
+		res := new(strut.Reservation)
 
-		if err := c.Bind(&res); err != nil {
+		id, err := reservationId(c)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, &strut.ErrResponse{strut.ErrContent{ErrorCodeInvalidContent, err.Error()}})
+		}
+
+		if err := c.Bind(res); err != nil {
 			return c.JSON(http.StatusBadRequest, &strut.ErrResponse{strut.ErrContent{ErrorCodeWrongJsonFormat, err.Error()}})
 		}
-		res.Sku = c.Param("sku")
+		res.Id = id
+		res.RequestId, res.Caller = origin(c)
 
 		if httpcode, code, err := a.processReservation(res, false); err != nil {
 			return c.JSON(httpcode, &strut.ErrResponse{strut.ErrContent{code, err.Error()}})
@@ -164,34 +415,112 @@ func (a *API) RemoveReservation() echo.HandlerFunc {
 	}
 }
 
+// Handler to POST Reservation commit request
+// The shipped units are taken from the reservation and from the stock at once, every unit when no quantity is given
+func (a *API) CommitReservation() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		res := new(strut.Reservation)
+
+		id, err := reservationId(c)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, &strut.ErrResponse{strut.ErrContent{ErrorCodeInvalidContent, err.Error()}})
+		}
+
+		// the body is optional, as for a DELETE
+		if c.Request().ContentLength != 0 {
+			if err := c.Bind(res); err != nil {
+				return c.JSON(http.StatusBadRequest, &strut.ErrResponse{strut.ErrContent{ErrorCodeWrongJsonFormat, err.Error()}})
+			}
+		}
+		res.Id = id
+		res.RequestId, res.Caller = origin(c)
+
+		if httpcode, code, err := a.consumeReservation(res, a.rp.CommitReservation); err != nil {
+			return c.JSON(httpcode, &strut.ErrResponse{strut.ErrContent{code, err.Error()}})
+		}
+
+		skuResponse, err := a.rp.FindSku(res.Sku)
+		if err != nil {
+			return c.JSON(http.StatusNotFound, &strut.ErrResponse{strut.ErrContent{ErrorCodeSkuNotFound, fmt.Sprintf(SkuNotFound, res.Sku)}})
+		}
+
+		if err := a.publish(skuResponse); err != nil {
+			return c.JSON(http.StatusInternalServerError, &strut.ErrResponse{strut.ErrContent{ErrorCodePublishingMessage, err.Error()}})
+		}
+
+		return c.NoContent(http.StatusOK)
+	}
+}
+
 // Processes a Reservation request
 func (a *API) processReservation(r *strut.Reservation, put bool) (int, int, error) {
-	var skuFound *strut.Sku
 
-	if err := a.validateReservation(r); err != nil {
-		return http.StatusBadRequest, ErrorCodeInvalidContent, err
-	}
+	if put {
+		// a reservation without quantity holds a single unit, or every serial number it names
+		if r.Quantity == 0 {
+			r.Quantity = 1
+			if len(r.Serials) > 0 {
+				r.Quantity = int64(len(r.Serials))
+			}
+		}
+		if r.Ttl == 0 {
+			r.Ttl = a.cnfg.Reservation.Ttl
+		}
+		// a reservation without warehouse is allocated with the configured strategy
+		if r.Warehouse == "" && r.Strategy == "" {
+			r.Strategy = a.cnfg.Reservation.Strategy
+			if r.Strategy == "" {
+				r.Strategy = alloc.DefaultStrategy
+			}
+		}
 
-	skuFound, err := a.rp.FindBySkuAndWharehouse(r.Sku, r.Warehouse)
-	if err != nil {
-		return http.StatusInternalServerError, ErrorCodeSkuNotFound, err
-	}
+		if err := a.validateReservation(r); err != nil {
+			return http.StatusBadRequest, ErrorCodeInvalidContent, err
+		}
 
-	if skuFound.Sku != "" {
-		if put {
-			if err := a.rp.InsertReservation(r); err != nil {
-				return http.StatusInternalServerError, ErrorCodeStoringContent, err
+		if r.Ttl > 0 {
+			expires := time.Now().UTC().Add(time.Duration(r.Ttl) * time.Second)
+			r.ExpiresAt = &expires
+		}
+
+		b, err := a.rp.FindBundle(r.Sku)
+		if err != nil {
+			return http.StatusInternalServerError, ErrorCodeStoringContent, err
+		}
+
+		// the stock of a bundle is held by its components
+		if len(b.Components) > 0 {
+			if httpcode, code, err := a.reserveBundle(r, b); err != nil {
+				return httpcode, code, err
+			}
+			if err := a.publishSkus(reservedSkus([]strut.Reservation{*r})); err != nil {
+				return http.StatusInternalServerError, ErrorCodePublishingMessage, err
+			}
+			return http.StatusOK, 0, nil
+		}
+
+		if r.Warehouse == "" {
+			if httpcode, code, err := a.allocateReservation(r); err != nil {
+				return httpcode, code, err
 			}
 		} else {
-			if err := a.rp.DeleteReservation(r); err != nil {
-				if err.Error() == "404" {
-					return http.StatusNotFound, ErrorCodeSkuNotFound, fmt.Errorf(ReservationDeleteError, r.Sku, r.Warehouse)
+			id, err := a.rp.InsertReservation(r)
+			if err != nil {
+				switch err.Error() {
+				case "404":
+					return http.StatusNotFound, ErrorCodeSkuNotFound, fmt.Errorf(SkuWarehouseNotFound, r.Sku, r.Warehouse)
+				case "409":
+					if len(r.Serials) > 0 {
+						return http.StatusConflict, ErrorCodeInsufficientStock, fmt.Errorf(SerialsNotFree, r.Sku, r.Warehouse)
+					}
+					return http.StatusConflict, ErrorCodeInsufficientStock, fmt.Errorf(InsufficientStock, r.Sku, r.Warehouse, r.Quantity)
 				}
 				return http.StatusInternalServerError, ErrorCodeStoringContent, err
 			}
+			r.Id = id
 		}
-	} else {
-		return http.StatusNotFound, ErrorCodeSkuNotFound, fmt.Errorf(SkuNotFound, "")
+	} else if httpcode, code, err := a.consumeReservation(r, a.rp.DeleteReservation); err != nil {
+		return httpcode, code, err
 	}
 
 	skuResponse, err := a.rp.FindSku(r.Sku)
@@ -199,14 +528,282 @@ func (a *API) processReservation(r *strut.Reservation, put bool) (int, int, erro
 		return http.StatusNotFound, ErrorCodeSkuNotFound, fmt.Errorf(SkuNotFound, r.Sku)
 	}
 
-	if err := a.pb.Publish(skuResponse); err != nil {
+	if err := a.publish(skuResponse); err != nil {
 		return http.StatusInternalServerError, ErrorCodePublishingMessage, err
 	}
 
 	return http.StatusOK, 0, nil
 }
 
+// Takes units of a stored Reservation with the given consume, releasing or committing them
+// Without quantity every unit held by the reservation is taken, or every serial number the request names
+func (a *API) consumeReservation(r *strut.Reservation, consume func(*strut.Reservation) error) (int, int, error) {
+	found, err := a.rp.FindReservation(r.Id)
+	if err != nil {
+		return http.StatusInternalServerError, ErrorCodeReservationNotFound, err
+	}
+	if found.Id == 0 {
+		return http.StatusNotFound, ErrorCodeReservationNotFound, fmt.Errorf(ReservationNotFound, r.Id)
+	}
+
+	r.Sku = found.Sku
+	r.Warehouse = found.Warehouse
+	if r.Quantity == 0 {
+		r.Quantity = found.Quantity
+		if len(r.Serials) > 0 {
+			r.Quantity = int64(len(r.Serials))
+		}
+	}
+
+	if err := a.validateReservation(r); err != nil {
+		return http.StatusBadRequest, ErrorCodeInvalidContent, err
+	}
+
+	if err := consume(r); err != nil {
+		// only a commit ships units, which a pre-order may not hold yet
+		if err.Error() == "409" {
+			return http.StatusConflict, ErrorCodeInsufficientStock, fmt.Errorf(CommitInsufficient, r.Sku, r.Warehouse, r.Quantity)
+		}
+		if err.Error() == "404" {
+			if len(r.Serials) > 0 {
+				return http.StatusNotFound, ErrorCodeReservationNotFound, fmt.Errorf(SerialsNotHeld, r.Id, r.Serials)
+			}
+			return http.StatusNotFound, ErrorCodeReservationNotFound, fmt.Errorf(ReservationDeleteError, r.Id, r.Quantity)
+		}
+		return http.StatusInternalServerError, ErrorCodeStoringContent, err
+	}
+
+	return http.StatusOK, 0, nil
+}
+
+// Allocates a Reservation without warehouse across the warehouses holding the sku
+// Each allocation is stored as a reservation of its own, every one of them or none
+// The allocation is chosen again when the stock changes before it is stored
+func (a *API) allocateReservation(r *strut.Reservation) (int, int, error) {
+	strategy, err := alloc.Get(r.Strategy)
+	if err != nil {
+		return http.StatusBadRequest, ErrorCodeInvalidContent, err
+	}
+
+	for attempt := 0; attempt < AllocationAttempts; attempt++ {
+		skuResponse, err := a.rp.FindSku(r.Sku)
+		if err != nil {
+			return http.StatusNotFound, ErrorCodeSkuNotFound, fmt.Errorf(SkuNotFound, r.Sku)
+		}
+		// only the units the channel of the reservation can take are allocated
+		skuResponse = repo.ForChannel(skuResponse, r.Channel)
+
+		warehouses, err := a.warehouses()
+		if err != nil {
+			return http.StatusInternalServerError, ErrorCodeWarehouseNotFound, err
+		}
+
+		reservations, err := allocate(r, strategy, skuResponse, warehouses)
+		if err != nil {
+			if err.Error() == "409" {
+				return http.StatusConflict, ErrorCodeInsufficientStock, fmt.Errorf(InsufficientAllocation, r.Sku, r.Quantity, r.Strategy)
+			}
+			return http.StatusInternalServerError, ErrorCodeStoringContent, err
+		}
+
+		err = a.rp.InsertReservations(reservations)
+		if err != nil {
+			// the stock changed since it was read, allocate again
+			if err.Error() == "404" || err.Error() == "409" {
+				continue
+			}
+			return http.StatusInternalServerError, ErrorCodeStoringContent, err
+		}
+
+		allocated(r, reservations)
+
+		return http.StatusOK, 0, nil
+	}
+
+	return http.StatusConflict, ErrorCodeInsufficientStock, fmt.Errorf(InsufficientAllocation, r.Sku, r.Quantity, r.Strategy)
+}
+
+// Builds the reservations of the warehouses the strategy chooses for a Reservation without warehouse
+// The allocated units are taken from the available ones of the stock, so another allocation of it does not count them again
+func allocate(r *strut.Reservation, strategy alloc.Strategy, stock *strut.SkuResponse, warehouses map[string]strut.Warehouse) ([]*strut.Reservation, error) {
+	allocations, err := strategy.Allocate(r.Quantity, stock.Values, warehouses)
+	if err != nil {
+		return nil, err
+	}
+
+	var reservations []*strut.Reservation
+	for _, l := range allocations {
+		reservations = append(reservations, &strut.Reservation{Sku: r.Sku, Warehouse: l.Warehouse, Quantity: l.Quantity, Reference: r.Reference, Channel: r.Channel, Ttl: r.Ttl, ExpiresAt: r.ExpiresAt, RequestId: r.RequestId, Caller: r.Caller})
+
+		for i := range stock.Values {
+			if stock.Values[i].Warehouse == l.Warehouse {
+				stock.Values[i].Available -= l.Quantity
+			}
+		}
+	}
+
+	return reservations, nil
+}
+
+// Fills the allocations of a Reservation without warehouse with the stored reservations
+func allocated(r *strut.Reservation, reservations []*strut.Reservation) {
+	r.Allocations = nil
+	for _, re := range reservations {
+		r.Allocations = append(r.Allocations, strut.Allocation{Id: re.Id, Warehouse: re.Warehouse, Quantity: re.Quantity})
+		r.Preorder = r.Preorder || re.Preorder
+	}
+	// a reservation held in a single warehouse is released like any other
+	if len(reservations) == 1 {
+		r.Id, r.Warehouse = reservations[0].Id, reservations[0].Warehouse
+	}
+}
+
+// Publishes the stock of a sku and of the bundles made of it
+func (a *API) publish(s *strut.SkuResponse) error {
+	if err := a.pb.Publish(s); err != nil {
+		return err
+	}
+
+	bundles, err := a.rp.FindBundlesWith(s.Sku)
+	if err != nil {
+		return err
+	}
+	return a.publishSkus(bundles)
+}
+
+// Publishes the stock of every given sku once, and then of the bundles made of them
+func (a *API) publishSkus(skus []string) error {
+	skus, failed := repo.WithBundles(a.rp, skus)
+
+	for _, sku := range skus {
+		skuResponse, err := a.rp.FindSku(sku)
+		if err != nil {
+			failed = append(failed, sku)
+			continue
+		}
+		if err := a.pb.Publish(skuResponse); err != nil {
+			failed = append(failed, sku)
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("Could not publish the stock of Skus %v", failed)
+	}
+	return nil
+}
+
+// Retrieves the registered warehouses by code
+func (a *API) warehouses() (map[string]strut.Warehouse, error) {
+	found, err := a.rp.FindWarehouses()
+	if err != nil {
+		return nil, err
+	}
+
+	warehouses := make(map[string]strut.Warehouse)
+	for _, w := range found {
+		warehouses[w.Code] = w
+	}
+
+	return warehouses, nil
+}
+
+// Retrieves the request id and the caller of the request
+func origin(c echo.Context) (string, string) {
+	caller := c.Request().Header.Get(HeaderCaller)
+	if caller == "" {
+		caller = c.RealIP()
+	}
+
+	return c.Response().Header().Get(echo.HeaderXRequestID), caller
+}
+
+// Builds the filter of the stock movements from the url
+func movementFilter(c echo.Context) (*strut.MovementFilter, error) {
+	f := &strut.MovementFilter{Sku: c.Param("sku"), Warehouse: c.QueryParam("warehouse"), Limit: DefaultHistoryLimit}
+
+	if v := c.QueryParam("from"); v != "" {
+		from, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return nil, fmt.Errorf("From %s is not a RFC3339 date", v)
+		}
+		f.From = &from
+	}
+	if v := c.QueryParam("to"); v != "" {
+		to, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return nil, fmt.Errorf("To %s is not a RFC3339 date", v)
+		}
+		f.To = &to
+	}
+	if v := c.QueryParam("cursor"); v != "" {
+		cursor, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || cursor <= 0 {
+			return nil, fmt.Errorf("Cursor %s is invalid", v)
+		}
+		f.Cursor = cursor
+	}
+	if v := c.QueryParam("limit"); v != "" {
+		limit, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || limit <= 0 || limit > MaxHistoryLimit {
+			return nil, fmt.Errorf("Limit must be between 1 and %d", MaxHistoryLimit)
+		}
+		f.Limit = limit
+	}
+
+	return f, nil
+}
+
+// Retrieves the version expected by the If-Match header, 0 when any version is accepted
+func ifMatch(c echo.Context) (int64, error) {
+	value := strings.TrimPrefix(c.Request().Header.Get("If-Match"), "W/")
+	value = strings.Trim(value, `"`)
+
+	if value == "" || value == "*" {
+		return 0, nil
+	}
+
+	version, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || version <= 0 {
+		return 0, fmt.Errorf("If-Match %s is not a valid version", value)
+	}
+
+	return version, nil
+}
+
+// Sets the ETag header with the version of the Sku in the given warehouse
+func setETag(c echo.Context, s *strut.SkuResponse, warehouse string) {
+	if warehouse == "" {
+		return
+	}
+
+	for _, v := range s.Values {
+		if v.Warehouse == warehouse {
+			c.Response().Header().Set("ETag", fmt.Sprintf(`"%d"`, v.Version))
+			return
+		}
+	}
+}
+
+// Retrieves the Reservation id from the url
+// echo shares the parameter names of routes with the same path, so /reservation/:id
+// is read by position to not clash with /reservation/:sku
+func reservationId(c echo.Context) (int64, error) {
+	values := c.ParamValues()
+	if len(values) == 0 || values[0] == "" {
+		return 0, fmt.Errorf("Reservation id is empty")
+	}
+
+	id, err := strconv.ParseInt(values[0], 10, 64)
+	if err != nil || id <= 0 {
+		return 0, fmt.Errorf("Reservation id %s is invalid", values[0])
+	}
+
+	return id, nil
+}
+
 // Validates the consistency of the Sku struct
+// A negative quantity is only valid for a sku that can be backordered, and a serialized sku can not be changed
+// The repository errors met are returned as a repoError
 func (a *API) validateSku(s *strut.Sku) error {
 	if s.Sku == "" {
 		return fmt.Errorf("Sku is empty")
@@ -214,10 +811,22 @@ func (a *API) validateSku(s *strut.Sku) error {
 	if s.Warehouse == "" {
 		return fmt.Errorf("Warehouse is empty")
 	}
+	if err := a.notSerialized(s.Sku); err != nil {
+		return err
+	}
+	if err := a.notBundle(s.Sku); err != nil {
+		return err
+	}
 	if s.Quantity < 0 {
-		return fmt.Errorf("Quantity is negative")
+		st, err := a.rp.FindSkuSettings(s.Sku)
+		if err != nil {
+			return repoError{err}
+		}
+		if repo.BackorderFloor(st) == 0 {
+			return fmt.Errorf("Quantity is negative")
+		}
 	}
-	return nil
+	return a.knownWarehouse(s.Warehouse)
 }
 
 // Validates the consistency of the Reservation struct
@@ -225,8 +834,56 @@ func (a *API) validateReservation(res *strut.Reservation) error {
 	if res.Sku == "" {
 		return fmt.Errorf("Sku is empty")
 	}
-	if res.Warehouse == "" {
+	// only a new reservation can be allocated without warehouse
+	if res.Warehouse == "" && res.Id != 0 {
 		return fmt.Errorf("Warehouse is empty")
 	}
+	if res.Quantity < 0 {
+		return fmt.Errorf("Quantity is negative")
+	}
+	if len(res.Reference) > 64 {
+		return fmt.Errorf("Reference is longer than 64 characters")
+	}
+	if len(res.Channel) > 32 {
+		return fmt.Errorf("Channel is longer than 32 characters")
+	}
+	if res.Ttl < 0 {
+		return fmt.Errorf("Ttl is negative")
+	}
+	if len(res.Serials) > 0 {
+		if err := validateSerials(res.Serials); err != nil {
+			return err
+		}
+		// serial numbers are only looked up in the warehouse of the reservation
+		if res.Warehouse == "" {
+			return fmt.Errorf("Warehouse is empty")
+		}
+		if res.Quantity != int64(len(res.Serials)) {
+			return fmt.Errorf("Quantity does not match the serials")
+		}
+	}
+	// a stored reservation can still be released once its warehouse is inactive
+	if res.Id == 0 {
+		if res.Warehouse == "" {
+			_, err := alloc.Get(res.Strategy)
+			return err
+		}
+		return a.knownWarehouse(res.Warehouse)
+	}
+	return nil
+}
+
+// Validates the warehouse is registered and active
+func (a *API) knownWarehouse(code string) error {
+	w, err := a.rp.FindWarehouse(code)
+	if err != nil {
+		return repoError{err}
+	}
+	if w.Code == "" {
+		return fmt.Errorf(WarehouseNotFound, code)
+	}
+	if !w.Active {
+		return fmt.Errorf(WarehouseInactive, code)
+	}
 	return nil
 }
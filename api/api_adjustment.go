@@ -0,0 +1,159 @@
+package api
+
+import (
+	"fmt"
+	"github.com/labstack/echo"
+	strut "github.com/pintobikez/stock-service/api/structures"
+	"net/http"
+	"strconv"
+)
+
+const (
+	MaxAdjustmentLines = 500
+)
+
+// Reason codes accepted when the service config has no catalogue
+var DefaultAdjustmentReasons = []string{"damage", "theft", "return", "cycle_count"}
+
+// Handler to POST Adjustment request
+func (a *API) PostAdjustment() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		adj := new(strut.Adjustment)
+
+		if err := c.Bind(adj); err != nil {
+			return c.JSON(http.StatusBadRequest, &strut.ErrResponse{strut.ErrContent{ErrorCodeWrongJsonFormat, err.Error()}})
+		}
+		adj.Id = 0
+		adj.CreatedAt = nil
+
+		if err := a.validateAdjustment(adj); err != nil {
+			return c.JSON(http.StatusBadRequest, &strut.ErrResponse{strut.ErrContent{ErrorCodeInvalidContent, err.Error()}})
+		}
+		adj.RequestId, adj.Caller = origin(c)
+
+		if _, err := a.rp.InsertAdjustment(adj); err != nil {
+			switch err.Error() {
+			case "404":
+				return c.JSON(http.StatusNotFound, &strut.ErrResponse{strut.ErrContent{ErrorCodeSkuNotFound, AdjustmentNotStored}})
+			case "409":
+				return c.JSON(http.StatusConflict, &strut.ErrResponse{strut.ErrContent{ErrorCodeInsufficientStock, AdjustmentNegative}})
+			}
+			return c.JSON(http.StatusInternalServerError, &strut.ErrResponse{strut.ErrContent{ErrorCodeStoringContent, err.Error()}})
+		}
+
+		// one message per sku, whatever the number of warehouses adjusted
+		var failed []string
+		seen := make(map[string]bool)
+		for _, l := range adj.Lines {
+			if seen[l.Sku] {
+				continue
+			}
+			seen[l.Sku] = true
+
+			skuResponse, err := a.rp.FindSku(l.Sku)
+			if err != nil {
+				failed = append(failed, l.Sku)
+				continue
+			}
+			if err := a.publish(skuResponse); err != nil {
+				failed = append(failed, l.Sku)
+			}
+		}
+
+		if len(failed) > 0 {
+			return c.JSON(http.StatusInternalServerError, &strut.ErrResponse{strut.ErrContent{ErrorCodePublishingMessage, fmt.Sprintf("Could not publish the stock of Skus %v", failed)}})
+		}
+
+		return c.JSON(http.StatusCreated, adj)
+	}
+}
+
+// Handler to GET Adjustment request
+func (a *API) GetAdjustment() echo.HandlerFunc {
+	return func(c echo.Context) error {
+
+		id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil || id <= 0 {
+			return c.JSON(http.StatusBadRequest, &strut.ErrResponse{strut.ErrContent{ErrorCodeInvalidContent, fmt.Sprintf("Adjustment id %s is invalid", c.Param("id"))}})
+		}
+
+		adj, err := a.rp.FindAdjustment(id)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, &strut.ErrResponse{strut.ErrContent{ErrorCodeAdjustmentNotFound, err.Error()}})
+		}
+		if adj.Id == 0 {
+			return c.JSON(http.StatusNotFound, &strut.ErrResponse{strut.ErrContent{ErrorCodeAdjustmentNotFound, fmt.Sprintf(AdjustmentNotFound, id)}})
+		}
+
+		return c.JSON(http.StatusOK, adj)
+	}
+}
+
+// Validates the consistency of the Adjustment struct
+func (a *API) validateAdjustment(adj *strut.Adjustment) error {
+	if adj.Reason == "" {
+		return fmt.Errorf("Reason is empty")
+	}
+
+	reasons := a.cnfg.Adjustment.Reasons
+	if len(reasons) == 0 {
+		reasons = DefaultAdjustmentReasons
+	}
+	known := false
+	for _, r := range reasons {
+		if r == adj.Reason {
+			known = true
+			break
+		}
+	}
+	if !known {
+		return fmt.Errorf("Reason %s is not one of %v", adj.Reason, reasons)
+	}
+
+	if len(adj.Note) > 255 {
+		return fmt.Errorf("Note is longer than 255 characters")
+	}
+	if len(adj.Lines) == 0 {
+		return fmt.Errorf("Lines are empty")
+	}
+	if len(adj.Lines) > MaxAdjustmentLines {
+		return fmt.Errorf("Lines are more than %d", MaxAdjustmentLines)
+	}
+
+	seen := make(map[string]bool)
+	checked := make(map[string]bool)
+	tracked := make(map[string]bool)
+	for _, l := range adj.Lines {
+		if l.Sku == "" {
+			return fmt.Errorf("Sku is empty")
+		}
+		if l.Warehouse == "" {
+			return fmt.Errorf("Warehouse is empty")
+		}
+		if l.Delta == 0 {
+			return fmt.Errorf("Delta of Sku %s in Warehouse %s is zero", l.Sku, l.Warehouse)
+		}
+		if seen[l.Sku+"\n"+l.Warehouse] {
+			return fmt.Errorf("Sku %s in Warehouse %s is repeated", l.Sku, l.Warehouse)
+		}
+		seen[l.Sku+"\n"+l.Warehouse] = true
+
+		if !checked[l.Warehouse] {
+			if err := a.knownWarehouse(l.Warehouse); err != nil {
+				return err
+			}
+			checked[l.Warehouse] = true
+		}
+		if !tracked[l.Sku] {
+			if err := a.notSerialized(l.Sku); err != nil {
+				return err
+			}
+			if err := a.notBundle(l.Sku); err != nil {
+				return err
+			}
+			tracked[l.Sku] = true
+		}
+	}
+
+	return nil
+}
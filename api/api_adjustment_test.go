@@ -0,0 +1,115 @@
+package api
+
+import (
+	"encoding/json"
+	"github.com/labstack/echo"
+	gen "github.com/pintobikez/stock-service/api/structures"
+	cnfs "github.com/pintobikez/stock-service/config/structures"
+	mock "github.com/pintobikez/stock-service/mocks"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+/*
+Tests for PostAdjustment method
+*/
+type postAdjustmentProviderApi struct {
+	json    string
+	reasons []string
+	result  int
+	code    int
+}
+
+var testPostAdjustmentProviderApi = []postAdjustmentProviderApi{
+	{`{"reason":"damage"`, nil, http.StatusBadRequest, ErrorCodeWrongJsonFormat},                                                                                                         // invalid json
+	{`{"lines":[{"sku":"SCC","warehouse":"A","delta":-1}]}`, nil, http.StatusBadRequest, ErrorCodeInvalidContent},                                                                        // empty reason
+	{`{"reason":"lost","lines":[{"sku":"SCC","warehouse":"A","delta":-1}]}`, nil, http.StatusBadRequest, ErrorCodeInvalidContent},                                                        // reason not in the default catalogue
+	{`{"reason":"damage","lines":[{"sku":"SCC","warehouse":"A","delta":-1}]}`, []string{"lost"}, http.StatusBadRequest, ErrorCodeInvalidContent},                                         // reason not in the configured catalogue
+	{`{"reason":"damage","note":"` + strings.Repeat("n", 256) + `","lines":[{"sku":"SCC","warehouse":"A","delta":-1}]}`, nil, http.StatusBadRequest, ErrorCodeInvalidContent},            // note too long
+	{`{"reason":"damage","lines":[]}`, nil, http.StatusBadRequest, ErrorCodeInvalidContent},                                                                                              // no lines
+	{`{"reason":"damage","lines":[{"warehouse":"A","delta":-1}]}`, nil, http.StatusBadRequest, ErrorCodeInvalidContent},                                                                  // empty sku
+	{`{"reason":"damage","lines":[{"sku":"SCC","delta":-1}]}`, nil, http.StatusBadRequest, ErrorCodeInvalidContent},                                                                      // empty warehouse
+	{`{"reason":"damage","lines":[{"sku":"SCC","warehouse":"I","delta":-1}]}`, nil, http.StatusBadRequest, ErrorCodeInvalidContent},                                                      // inactive warehouse
+	{`{"reason":"damage","lines":[{"sku":"SCC","warehouse":"A","delta":0}]}`, nil, http.StatusBadRequest, ErrorCodeInvalidContent},                                                       // zero delta
+	{`{"reason":"damage","lines":[{"sku":"SCC","warehouse":"A","delta":-1},{"sku":"SCC","warehouse":"A","delta":2}]}`, nil, http.StatusBadRequest, ErrorCodeInvalidContent},              // repeated line
+	{`{"reason":"damage","lines":[{"sku":"SCC","warehouse":"A","delta":-1},{"sku":"SSN","warehouse":"A","delta":-1}]}`, nil, http.StatusBadRequest, ErrorCodeInvalidContent},             // serialized sku
+	{`{"reason":"damage","lines":[{"sku":"SAC","warehouse":"A","delta":-1}]}`, nil, http.StatusInternalServerError, ErrorCodeStoringContent},                                             // RepoInsertAdjustment error
+	{`{"reason":"theft","lines":[{"sku":"SCC","warehouse":"A","delta":-1},{"sku":"SCN","warehouse":"A","delta":-20}]}`, nil, http.StatusConflict, ErrorCodeInsufficientStock},            // below the backorder limit after the adjustment
+	{`{"reason":"theft","lines":[{"sku":"SCC","warehouse":"A","delta":-1},{"sku":"SCW","warehouse":"A","delta":-1}]}`, nil, http.StatusNotFound, ErrorCodeSkuNotFound},                   // sku not stored in the warehouse
+	{`{"reason":"damage","lines":[{"sku":"SCD","warehouse":"A","delta":-1},{"sku":"SCC","warehouse":"A","delta":-1}]}`, nil, http.StatusInternalServerError, ErrorCodePublishingMessage}, // Error Publish
+	{`{"reason":"damage","lines":[{"sku":"SCC","warehouse":"A","delta":-1},{"sku":"SCC","warehouse":"B","delta":3}]}`, nil, http.StatusCreated, 0},                                       // Adjustment OK
+	{`{"reason":"lost","note":"found short on count","lines":[{"sku":"SCC","warehouse":"A","delta":-1}]}`, []string{"lost"}, http.StatusCreated, 0},                                      // configured reason OK
+}
+
+func TestPostAdjustment(t *testing.T) {
+	for _, pair := range testPostAdjustmentProviderApi {
+		p := new(mock.PublisherMock)
+		r := new(mock.RepositoryMock)
+		a := New(r, p, &cnfs.ServiceConfig{Adjustment: cnfs.AdjustmentConfig{Reasons: pair.reasons}})
+
+		// Setup
+		e := echo.New()
+		e.POST("/adjustments", a.PostAdjustment())
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/adjustments", strings.NewReader(pair.json))
+		req.Header.Set("Content-Type", "application/json")
+		e.ServeHTTP(rec, req)
+
+		assert.Equal(t, pair.result, rec.Code, "Http Code doesn't match")
+
+		if pair.result != http.StatusCreated {
+			erm := new(gen.ErrResponse)
+			_ = json.Unmarshal([]byte(rec.Body.String()), erm)
+			assert.Equal(t, pair.code, erm.Error.Code, "ErrorCode doesn't match")
+		} else {
+			val := new(gen.Adjustment)
+			_ = json.Unmarshal([]byte(rec.Body.String()), val)
+			assert.Equal(t, int64(1), val.Id, "Id doesn't match")
+			assert.Equal(t, int64(9), val.Lines[0].Quantity, "Quantity doesn't match")
+		}
+	}
+}
+
+/*
+Tests for GetAdjustment method
+*/
+type getAdjustmentProviderApi struct {
+	value  string
+	result int
+	code   int
+}
+
+var testGetAdjustmentProviderApi = []getAdjustmentProviderApi{
+	{"/adjustments/ABC", http.StatusBadRequest, ErrorCodeInvalidContent},            // invalid Adjustment id
+	{"/adjustments/1", http.StatusInternalServerError, ErrorCodeAdjustmentNotFound}, // RepoFindAdjustment error
+	{"/adjustments/2", http.StatusNotFound, ErrorCodeAdjustmentNotFound},            // Adjustment not found
+	{"/adjustments/3", http.StatusOK, 0},                                            // Adjustment found
+}
+
+func TestGetAdjustment(t *testing.T) {
+	for _, pair := range testGetAdjustmentProviderApi {
+		p := new(mock.PublisherMock)
+		r := new(mock.RepositoryMock)
+		a := New(r, p, nil)
+
+		// Setup
+		e := echo.New()
+		e.GET("/adjustments/:id", a.GetAdjustment())
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", pair.value, strings.NewReader(""))
+		e.ServeHTTP(rec, req)
+
+		assert.Equal(t, pair.result, rec.Code, "Http Code doesn't match")
+
+		if pair.result != http.StatusOK {
+			erm := new(gen.ErrResponse)
+			_ = json.Unmarshal([]byte(rec.Body.String()), erm)
+			assert.Equal(t, pair.code, erm.Error.Code, "ErrorCode doesn't match")
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/labstack/echo"
+	strut "github.com/pintobikez/stock-service/api/structures"
+	"io"
+	"net/http"
+	"unicode"
+)
+
+const (
+	DefaultBulkChunk   = 500
+	DefaultBulkMaxRows = 50000
+)
+
+// Handler to PUT Stock bulk request
+// The body is a JSON array or a stream of newline delimited JSON objects
+func (a *API) PutStocks() echo.HandlerFunc {
+	return func(c echo.Context) error {
+
+		chunk, maxRows := int64(DefaultBulkChunk), int64(DefaultBulkMaxRows)
+		if a.cnfg.Bulk.Chunk > 0 {
+			chunk = a.cnfg.Bulk.Chunk
+		}
+		if a.cnfg.Bulk.MaxRows > 0 {
+			maxRows = a.cnfg.Bulk.MaxRows
+		}
+
+		rows, err := decodeStockRows(c.Request().Body, maxRows)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, &strut.ErrResponse{strut.ErrContent{ErrorCodeWrongJsonFormat, err.Error()}})
+		}
+		if len(rows) == 0 {
+			return c.JSON(http.StatusBadRequest, &strut.ErrResponse{strut.ErrContent{ErrorCodeInvalidContent, "Rows are empty"}})
+		}
+
+		requestId, caller := origin(c)
+		report := &strut.BulkStockReport{Rows: make([]strut.StockRowResult, len(rows))}
+
+		// invalid rows are reported without reaching the repository
+		var valid []strut.StockRow
+		checked := make(map[string]error)
+		tracked := make(map[string]error)
+		for i := range rows {
+			row := &rows[i]
+			row.Row = i + 1
+			row.RequestId, row.Caller = requestId, caller
+			if row.Action == "" {
+				row.Action = strut.ActionSet
+			}
+
+			if err := a.validateStockRow(row, checked, tracked); err != nil {
+				report.Rows[i] = strut.StockRowResult{Row: row.Row, Sku: row.Sku, Warehouse: row.Warehouse, Status: strut.RowFailed, Error: err.Error()}
+				continue
+			}
+			valid = append(valid, *row)
+		}
+
+		for _, res := range a.rp.BulkSku(valid, chunk) {
+			switch res.Error {
+			case "404":
+				res.Error = fmt.Sprintf(SkuWarehouseNotFound, res.Sku, res.Warehouse)
+			case "409":
+				res.Error = fmt.Sprintf(BackorderExceeded, res.Sku, res.Warehouse)
+			}
+			report.Rows[res.Row-1] = res
+		}
+
+		// one message per changed sku, whatever the number of rows
+		var changed []string
+		seen := make(map[string]bool)
+		for _, res := range report.Rows {
+			switch res.Status {
+			case strut.RowChanged:
+				report.Changed++
+				if !seen[res.Sku] {
+					seen[res.Sku] = true
+					changed = append(changed, res.Sku)
+				}
+			case strut.RowUnchanged:
+				report.Unchanged++
+			default:
+				report.Failed++
+			}
+		}
+
+		for _, sku := range changed {
+			skuResponse, err := a.rp.FindSku(sku)
+			if err != nil {
+				report.Unpublished = append(report.Unpublished, sku)
+				continue
+			}
+			if err := a.publish(skuResponse); err != nil {
+				report.Unpublished = append(report.Unpublished, sku)
+			}
+		}
+
+		return c.JSON(http.StatusOK, report)
+	}
+}
+
+// Decodes up to maxRows StockRows from a JSON array or from newline delimited JSON objects
+func decodeStockRows(body io.Reader, maxRows int64) ([]strut.StockRow, error) {
+	var rows []strut.StockRow
+	br := bufio.NewReader(body)
+
+	// the first character tells the array from the stream
+	var first rune
+	for {
+		r, _, err := br.ReadRune()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !unicode.IsSpace(r) {
+			first = r
+			br.UnreadRune()
+			break
+		}
+	}
+
+	dec := json.NewDecoder(br)
+	if first == '[' {
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+	}
+
+	for {
+		if first == '[' && !dec.More() {
+			if _, err := dec.Token(); err != nil {
+				return nil, err
+			}
+			break
+		}
+
+		var row strut.StockRow
+		if err := dec.Decode(&row); err != nil {
+			if err == io.EOF && first != '[' {
+				break
+			}
+			return nil, fmt.Errorf("Row %d is not valid JSON: %s", len(rows)+1, err.Error())
+		}
+
+		rows = append(rows, row)
+		if int64(len(rows)) > maxRows {
+			return nil, fmt.Errorf("Rows are more than %d", maxRows)
+		}
+	}
+
+	return rows, nil
+}
+
+// Validates the consistency of the StockRow struct
+// The result of each warehouse check is kept in checked and the one of each sku in tracked, so each is looked up once
+func (a *API) validateStockRow(row *strut.StockRow, checked map[string]error, tracked map[string]error) error {
+	if row.Sku == "" {
+		return fmt.Errorf("Sku is empty")
+	}
+	if row.Warehouse == "" {
+		return fmt.Errorf("Warehouse is empty")
+	}
+
+	// a set row below zero is checked against the backorder limit of its sku when it is stored
+	switch row.Action {
+	case strut.ActionSet:
+	case strut.ActionAdd, strut.ActionSub:
+		if row.Quantity < 0 {
+			return fmt.Errorf("Quantity is negative")
+		}
+	default:
+		return fmt.Errorf("Action %s is not one of set, add or sub", row.Action)
+	}
+
+	err, ok := tracked[row.Sku]
+	if !ok {
+		err = a.notSerialized(row.Sku)
+		if err == nil {
+			err = a.notBundle(row.Sku)
+		}
+		tracked[row.Sku] = err
+	}
+	if err != nil {
+		return err
+	}
+
+	err, ok = checked[row.Warehouse]
+	if !ok {
+		err = a.knownWarehouse(row.Warehouse)
+		checked[row.Warehouse] = err
+	}
+
+	return err
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"encoding/json"
+	"github.com/labstack/echo"
+	gen "github.com/pintobikez/stock-service/api/structures"
+	cnfs "github.com/pintobikez/stock-service/config/structures"
+	mock "github.com/pintobikez/stock-service/mocks"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+/*
+Tests for PutStocks method
+*/
+type putStocksProviderApi struct {
+	body        string
+	maxRows     int64
+	result      int
+	code        int
+	statuses    []string
+	published   []string
+	unpublished []string
+}
+
+var testPutStocksProviderApi = []putStocksProviderApi{
+	{``, 0, http.StatusBadRequest, ErrorCodeInvalidContent, nil, nil, nil},                                                                                                                                    // empty body
+	{`[]`, 0, http.StatusBadRequest, ErrorCodeInvalidContent, nil, nil, nil},                                                                                                                                  // empty array
+	{`[{"sku":"SCC","warehouse":"A","quantity":1}`, 0, http.StatusBadRequest, ErrorCodeWrongJsonFormat, nil, nil, nil},                                                                                        // unterminated array
+	{"{\"sku\":\"SCC\",\"warehouse\":\"A\",\"quantity\":1}\n{\"sku\":", 0, http.StatusBadRequest, ErrorCodeWrongJsonFormat, nil, nil, nil},                                                                    // broken stream
+	{`[{"sku":"A1","warehouse":"A","quantity":1},{"sku":"A2","warehouse":"A","quantity":1},{"sku":"A3","warehouse":"A","quantity":1}]`, 2, http.StatusBadRequest, ErrorCodeWrongJsonFormat, nil, nil, nil},    // too many rows
+	{`[{"sku":"SCC","warehouse":"A","quantity":5},{"sku":"SCC","warehouse":"B","quantity":2,"action":"add"}]`, 0, http.StatusOK, 0, []string{gen.RowChanged, gen.RowChanged}, []string{"SCC"}, nil},           // one message per sku
+	{"{\"sku\":\"SCC\",\"warehouse\":\"A\",\"quantity\":5}\n\n{\"sku\":\"SCU\",\"warehouse\":\"A\",\"quantity\":5}\n", 0, http.StatusOK, 0, []string{gen.RowChanged, gen.RowUnchanged}, []string{"SCC"}, nil}, // newline delimited rows
+	{`[{"sku":"SCC","quantity":5},{"sku":"SCC","warehouse":"A","quantity":5,"action":"move"},{"sku":"SCN","warehouse":"A","quantity":5,"action":"sub"},{"sku":"SAC","warehouse":"A","quantity":5},{"sku":"SCU","warehouse":"A","quantity":5},{"sku":"SCC","warehouse":"X","quantity":5},{"sku":"SSN","warehouse":"A","quantity":5}]`, 0, http.StatusOK, 0, []string{gen.RowFailed, gen.RowFailed, gen.RowFailed, gen.RowFailed, gen.RowUnchanged, gen.RowFailed, gen.RowFailed}, nil, nil}, // failed rows
+	{`[{"sku":"SCW","warehouse":"A","quantity":5,"action":"sub"},{"sku":"SCC","warehouse":"A","quantity":5}]`, 0, http.StatusOK, 0, []string{gen.RowFailed, gen.RowChanged}, []string{"SCC"}, nil},                                                                                                                                                                                                                                                                                         // subtraction from a sku not stored in the warehouse
+	{`[{"sku":"SCC","warehouse":"A","quantity":-2},{"sku":"SCC","warehouse":"A","quantity":-2,"action":"sub"}]`, 0, http.StatusOK, 0, []string{gen.RowChanged, gen.RowFailed}, []string{"SCC"}, nil},                                                                                                                                                                                                                                                                                       // negative set left to the backorder limit
+	{`[{"sku":"SCD","warehouse":"A","quantity":5},{"sku":"SCCC","warehouse":"A","quantity":5},{"sku":"SCC","warehouse":"A","quantity":5}]`, 0, http.StatusOK, 0, []string{gen.RowChanged, gen.RowChanged, gen.RowChanged}, []string{"SCC"}, []string{"SCD", "SCCC"}},                                                                                                                                                                                                                       // Error Publish
+}
+
+func TestPutStocks(t *testing.T) {
+	for _, pair := range testPutStocksProviderApi {
+		p := new(mock.PublisherMock)
+		r := new(mock.RepositoryMock)
+		a := New(r, p, &cnfs.ServiceConfig{Bulk: cnfs.BulkConfig{MaxRows: pair.maxRows}})
+
+		// Setup
+		e := echo.New()
+		e.PUT("/stock", a.PutStocks())
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("PUT", "/stock", strings.NewReader(pair.body))
+		req.Header.Set("Content-Type", "application/json")
+		e.ServeHTTP(rec, req)
+
+		assert.Equal(t, pair.result, rec.Code, "Http Code doesn't match")
+
+		if pair.result != http.StatusOK {
+			erm := new(gen.ErrResponse)
+			_ = json.Unmarshal([]byte(rec.Body.String()), erm)
+			assert.Equal(t, pair.code, erm.Error.Code, "ErrorCode doesn't match")
+			continue
+		}
+
+		val := new(gen.BulkStockReport)
+		_ = json.Unmarshal([]byte(rec.Body.String()), val)
+
+		var statuses []string
+		for i, row := range val.Rows {
+			assert.Equal(t, i+1, row.Row, "Row doesn't match")
+			statuses = append(statuses, row.Status)
+		}
+		assert.Equal(t, pair.statuses, statuses, "Statuses don't match")
+		assert.Equal(t, pair.published, p.Published, "Published skus don't match")
+		assert.Equal(t, pair.unpublished, val.Unpublished, "Unpublished skus don't match")
+	}
+}
@@ -0,0 +1,239 @@
+package api
+
+import (
+	"fmt"
+	"github.com/labstack/echo"
+	alloc "github.com/pintobikez/stock-service/allocation"
+	strut "github.com/pintobikez/stock-service/api/structures"
+	repo "github.com/pintobikez/stock-service/repository"
+	"net/http"
+)
+
+const (
+	MaxComponents = 20
+
+	BundleNotFound  = "Bundle %s not found"
+	BundleNotStored = "A component of bundle %s is not stored in Warehouse %s"
+	BundleSerials   = "Bundle %s holds no serials of its own"
+	BundleStock     = "Stock of Bundle %s is derived from its components"
+	BundleInUse     = "Sku %s still holds stock or reservations"
+)
+
+// Handler to GET Bundle request
+func (a *API) GetBundle() echo.HandlerFunc {
+	return func(c echo.Context) error {
+
+		b, err := a.rp.FindBundle(c.Param("sku"))
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, &strut.ErrResponse{strut.ErrContent{ErrorCodeSkuNotFound, err.Error()}})
+		}
+		if len(b.Components) == 0 {
+			return c.JSON(http.StatusNotFound, &strut.ErrResponse{strut.ErrContent{ErrorCodeSkuNotFound, fmt.Sprintf(BundleNotFound, c.Param("sku"))}})
+		}
+
+		return c.JSON(http.StatusOK, b)
+	}
+}
+
+// Handler to PUT Bundle request
+// Replaces the components of the bundle, a bundle without components is no longer a bundle
+// A sku holding stock or reservations of its own can not become a bundle
+func (a *API) PutBundle() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		b := new(strut.Bundle)
+
+		if err := c.Bind(b); err != nil {
+			return c.JSON(http.StatusBadRequest, &strut.ErrResponse{strut.ErrContent{ErrorCodeWrongJsonFormat, err.Error()}})
+		}
+		b.Sku = c.Param("sku")
+
+		if err := a.validateBundle(b); err != nil {
+			return c.JSON(http.StatusBadRequest, &strut.ErrResponse{strut.ErrContent{ErrorCodeInvalidContent, err.Error()}})
+		}
+
+		if err := a.rp.UpdateBundle(b); err != nil {
+			if err.Error() == "409" {
+				return c.JSON(http.StatusConflict, &strut.ErrResponse{strut.ErrContent{ErrorCodeSkuInUse, fmt.Sprintf(BundleInUse, b.Sku)}})
+			}
+			return c.JSON(http.StatusInternalServerError, &strut.ErrResponse{strut.ErrContent{ErrorCodeStoringContent, err.Error()}})
+		}
+
+		// the stock of the bundle is now derived from its components
+		if len(b.Components) > 0 {
+			if err := a.publishSkus([]string{b.Sku}); err != nil {
+				return c.JSON(http.StatusInternalServerError, &strut.ErrResponse{strut.ErrContent{ErrorCodePublishingMessage, err.Error()}})
+			}
+		}
+
+		return c.JSON(http.StatusOK, b)
+	}
+}
+
+// Reserves every component of a bundle in a single transaction, as a bundle holds no stock of its own
+// A bundle without warehouse is allocated out of its derived stock with its strategy, and allocated again
+// when the stock changes before it is stored
+func (a *API) reserveBundle(r *strut.Reservation, b *strut.Bundle) (int, int, error) {
+	if len(r.Serials) > 0 {
+		return http.StatusBadRequest, ErrorCodeInvalidContent, fmt.Errorf(BundleSerials, r.Sku)
+	}
+
+	var strategy alloc.Strategy
+	if r.Warehouse == "" {
+		var err error
+		if strategy, err = alloc.Get(r.Strategy); err != nil {
+			return http.StatusBadRequest, ErrorCodeInvalidContent, err
+		}
+	}
+
+	for attempt := 0; attempt < AllocationAttempts; attempt++ {
+		held := []*strut.Reservation{r}
+
+		if r.Warehouse == "" {
+			skuResponse, err := a.rp.FindSku(r.Sku)
+			if err != nil {
+				return http.StatusNotFound, ErrorCodeSkuNotFound, fmt.Errorf(SkuNotFound, r.Sku)
+			}
+			// only the bundles the channel of the reservation can take are allocated
+			skuResponse = repo.ForChannel(skuResponse, r.Channel)
+
+			warehouses, err := a.warehouses()
+			if err != nil {
+				return http.StatusInternalServerError, ErrorCodeWarehouseNotFound, err
+			}
+
+			held, err = allocate(r, strategy, skuResponse, warehouses)
+			if err != nil {
+				if err.Error() == "409" {
+					return http.StatusConflict, ErrorCodeInsufficientStock, fmt.Errorf(InsufficientAllocation, r.Sku, r.Quantity, r.Strategy)
+				}
+				return http.StatusInternalServerError, ErrorCodeStoringContent, err
+			}
+		}
+
+		reservations := componentReservations(b, held)
+
+		err := a.rp.InsertReservations(reservations)
+		if err != nil {
+			switch err.Error() {
+			case "404", "409":
+				// the stock changed since it was read, allocate again
+				if r.Warehouse == "" {
+					continue
+				}
+				if err.Error() == "404" {
+					return http.StatusNotFound, ErrorCodeSkuNotFound, fmt.Errorf(BundleNotStored, r.Sku, r.Warehouse)
+				}
+				return http.StatusConflict, ErrorCodeInsufficientStock, fmt.Errorf(InsufficientStock, r.Sku, r.Warehouse, r.Quantity)
+			}
+			return http.StatusInternalServerError, ErrorCodeStoringContent, err
+		}
+
+		bundled(r, reservations)
+
+		return http.StatusOK, 0, nil
+	}
+
+	return http.StatusConflict, ErrorCodeInsufficientStock, fmt.Errorf(InsufficientAllocation, r.Sku, r.Quantity, r.Strategy)
+}
+
+// Builds the reservations of the components of a bundle for the reservations of the bundle in each warehouse
+func componentReservations(b *strut.Bundle, held []*strut.Reservation) []*strut.Reservation {
+	var reservations []*strut.Reservation
+	for _, re := range held {
+		for _, c := range b.Components {
+			reservations = append(reservations, &strut.Reservation{Sku: c.Sku, Warehouse: re.Warehouse, Quantity: re.Quantity * c.Quantity, Reference: re.Reference, Channel: re.Channel, Ttl: re.Ttl, ExpiresAt: re.ExpiresAt, RequestId: re.RequestId, Caller: re.Caller})
+		}
+	}
+	return reservations
+}
+
+// Fills the components of a bundle Reservation with the stored reservations of its components,
+// which are released and committed like any other
+func bundled(r *strut.Reservation, reservations []*strut.Reservation) {
+	r.Components = nil
+	for _, re := range reservations {
+		r.Components = append(r.Components, *re)
+		r.Preorder = r.Preorder || re.Preorder
+	}
+}
+
+// Retrieves the skus of the components held by the given Reservations, or their own skus
+func reservedSkus(reservations []strut.Reservation) []string {
+	var skus []string
+	for _, re := range reservations {
+		if len(re.Components) == 0 {
+			skus = append(skus, re.Sku)
+		}
+		for _, c := range re.Components {
+			skus = append(skus, c.Sku)
+		}
+	}
+	return skus
+}
+
+// Validates the quantity of a sku is not derived from its components, which hold the stock of a bundle
+func (a *API) notBundle(sku string) error {
+	b, err := a.rp.FindBundle(sku)
+	if err != nil {
+		return repoError{err}
+	}
+	if len(b.Components) > 0 {
+		return fmt.Errorf(BundleStock, sku)
+	}
+	return nil
+}
+
+// Validates the consistency of the Bundle struct
+// A component without quantity is a single unit, and bundles are not made of bundles
+func (a *API) validateBundle(b *strut.Bundle) error {
+	if b.Sku == "" {
+		return fmt.Errorf("Sku is empty")
+	}
+	if len(b.Components) > MaxComponents {
+		return fmt.Errorf("Components are more than %d", MaxComponents)
+	}
+	if b.Components == nil {
+		b.Components = []strut.Component{}
+	}
+
+	seen := make(map[string]bool)
+	for i := range b.Components {
+		c := &b.Components[i]
+		if c.Sku == "" {
+			return fmt.Errorf("Component sku is empty")
+		}
+		if c.Sku == b.Sku {
+			return fmt.Errorf("Component %s is the bundle itself", c.Sku)
+		}
+		if seen[c.Sku] {
+			return fmt.Errorf("Component %s is repeated", c.Sku)
+		}
+		seen[c.Sku] = true
+
+		if c.Quantity == 0 {
+			c.Quantity = 1
+		}
+		if c.Quantity < 0 {
+			return fmt.Errorf("Quantity of component %s is negative", c.Sku)
+		}
+
+		found, err := a.rp.FindBundle(c.Sku)
+		if err != nil {
+			return err
+		}
+		if len(found.Components) > 0 {
+			return fmt.Errorf("Component %s is a bundle", c.Sku)
+		}
+	}
+
+	if len(b.Components) > 0 {
+		bundles, err := a.rp.FindBundlesWith(b.Sku)
+		if err != nil {
+			return err
+		}
+		if len(bundles) > 0 {
+			return fmt.Errorf("Sku %s is a component of bundles %v", b.Sku, bundles)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+package api
+
+import (
+	"encoding/json"
+	"github.com/labstack/echo"
+	gen "github.com/pintobikez/stock-service/api/structures"
+	mock "github.com/pintobikez/stock-service/mocks"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+/*
+Tests for the Bundle methods
+*/
+type bundleProviderApi struct {
+	method string
+	value  string
+	json   string
+	result int
+	code   int
+}
+
+var testBundleProviderApi = []bundleProviderApi{
+	{"GET", "/skus/SBE/bundle", "", http.StatusInternalServerError, ErrorCodeSkuNotFound},                                                                       // RepoFindBundle error
+	{"GET", "/skus/SCC/bundle", "", http.StatusNotFound, ErrorCodeSkuNotFound},                                                                                  // sku is not a bundle
+	{"GET", "/skus/SBN/bundle", "", http.StatusOK, 0},                                                                                                           // bundle found
+	{"PUT", "/skus/SBX/bundle", `{"components":[`, http.StatusBadRequest, ErrorCodeWrongJsonFormat},                                                             // invalid json
+	{"PUT", "/skus/SBX/bundle", `{"components":[{"quantity":1}]}`, http.StatusBadRequest, ErrorCodeInvalidContent},                                              // component without sku
+	{"PUT", "/skus/SBX/bundle", `{"components":[{"sku":"SBX"}]}`, http.StatusBadRequest, ErrorCodeInvalidContent},                                               // bundle of itself
+	{"PUT", "/skus/SBX/bundle", `{"components":[{"sku":"SCC"},{"sku":"SCC","quantity":2}]}`, http.StatusBadRequest, ErrorCodeInvalidContent},                    // repeated component
+	{"PUT", "/skus/SBX/bundle", `{"components":[{"sku":"SCC","quantity":-2}]}`, http.StatusBadRequest, ErrorCodeInvalidContent},                                 // negative quantity
+	{"PUT", "/skus/SBX/bundle", `{"components":[{"sku":"SBE"}]}`, http.StatusBadRequest, ErrorCodeInvalidContent},                                               // RepoFindBundle error
+	{"PUT", "/skus/SBX/bundle", `{"components":[{"sku":"SBN"}]}`, http.StatusBadRequest, ErrorCodeInvalidContent},                                               // component is a bundle
+	{"PUT", "/skus/SBCE/bundle", `{"components":[{"sku":"SCC"}]}`, http.StatusBadRequest, ErrorCodeInvalidContent},                                              // RepoFindBundlesWith error
+	{"PUT", "/skus/SBC/bundle", `{"components":[{"sku":"SCC"}]}`, http.StatusBadRequest, ErrorCodeInvalidContent},                                               // bundle is a component
+	{"PUT", "/skus/SAC/bundle", `{"components":[{"sku":"SCC"}]}`, http.StatusInternalServerError, ErrorCodeStoringContent},                                      // RepoUpdateBundle error
+	{"PUT", "/skus/SBS/bundle", `{"components":[{"sku":"SCC"}]}`, http.StatusConflict, ErrorCodeSkuInUse},                                                       // sku holds stock
+	{"PUT", "/skus/SCD/bundle", `{"components":[{"sku":"SCC"}]}`, http.StatusInternalServerError, ErrorCodePublishingMessage},                                   // Error Publish
+	{"PUT", "/skus/SBX/bundle", `{"components":[{"sku":"SCC","quantity":2},{"sku":"SCM"}]}`, http.StatusOK, 0},                                                  // Update OK
+	{"PUT", "/skus/SBN/bundle", `{"components":[]}`, http.StatusOK, 0},                                                                                          // Remove OK
+	{"PUT", "/stock/SBN/set", `{"warehouse":"A","quantity":5}`, http.StatusBadRequest, ErrorCodeInvalidContent},                                                 // set stock of a bundle
+	{"PUT", "/stock/SBN/lots", `{"warehouse":"A","lot":"L1","expires_at":"2030-01-01T00:00:00Z","quantity":5}`, http.StatusBadRequest, ErrorCodeInvalidContent}, // lot of a bundle
+	{"POST", "/stock/SSNB/serials", `{"warehouse":"A","serials":["SN1"]}`, http.StatusBadRequest, ErrorCodeInvalidContent},                                      // serials of a bundle
+	{"POST", "/transfers", `{"sku":"SBN","source":"A","destination":"B","quantity":2}`, http.StatusBadRequest, ErrorCodeInvalidContent},                         // transfer of a bundle
+	{"POST", "/inbound", `{"sku":"SBN","warehouse":"A","quantity":5,"expected_at":"2017-11-20T00:00:00Z"}`, http.StatusBadRequest, ErrorCodeInvalidContent},     // inbound supply of a bundle
+	{"POST", "/adjustments", `{"reason":"damage","lines":[{"sku":"SBN","warehouse":"A","delta":-1}]}`, http.StatusBadRequest, ErrorCodeInvalidContent},          // adjustment of a bundle
+	{"PUT", "/reservation/SBE", `{"warehouse":"A"}`, http.StatusInternalServerError, ErrorCodeStoringContent},                                                   // RepoFindBundle error
+	{"PUT", "/reservation/SBN", `{"warehouse":"A","serials":["SN1"]}`, http.StatusBadRequest, ErrorCodeInvalidContent},                                          // serials of a bundle
+	{"PUT", "/reservation/SBNA", `{"warehouse":"A"}`, http.StatusNotFound, ErrorCodeSkuNotFound},                                                                // component not stored in the warehouse
+	{"PUT", "/reservation/SBNF", `{"warehouse":"A"}`, http.StatusConflict, ErrorCodeInsufficientStock},                                                          // not enough stock of a component
+	{"PUT", "/reservation/SBNF", `{}`, http.StatusConflict, ErrorCodeInsufficientStock},                                                                         // stock keeps changing while allocating
+	{"PUT", "/reservation/SBN", `{"quantity":4}`, http.StatusConflict, ErrorCodeInsufficientStock},                                                              // not enough bundles to allocate
+	{"PUT", "/reservation/SBN", `{"warehouse":"A","quantity":2}`, http.StatusOK, 0},                                                                             // Insert OK
+	{"PUT", "/reservation/SBN", `{"quantity":3}`, http.StatusOK, 0},                                                                                             // Insert allocated OK
+	{"POST", "/reservations", `{"order":"O1","lines":[{"sku":"SBN","warehouse":"A","serials":["SN1"]}]}`, http.StatusBadRequest, ErrorCodeInvalidContent},       // serials of a bundle line
+	{"POST", "/reservations", `{"order":"O1","lines":[{"sku":"SBNF","warehouse":"A"}]}`, http.StatusConflict, ErrorCodeInsufficientStock},                       // not enough stock of a component of a line
+	{"POST", "/reservations", `{"order":"O1","lines":[{"sku":"SBN","quantity":2},{"sku":"SCC","warehouse":"A"}]}`, http.StatusCreated, 0},                       // Insert order with a bundle OK
+}
+
+func TestBundle(t *testing.T) {
+	for _, pair := range testBundleProviderApi {
+		p := new(mock.PublisherMock)
+		r := new(mock.RepositoryMock)
+		a := New(r, p, nil)
+
+		// Setup
+		e := echo.New()
+		e.GET("/skus/:sku/bundle", a.GetBundle())
+		e.PUT("/skus/:sku/bundle", a.PutBundle())
+		e.PUT("/stock/:sku/lots", a.PutLot())
+		e.PUT("/stock/:sku/:action", a.PutStock())
+		e.POST("/stock/:sku/serials", a.PostSerials())
+		e.POST("/transfers", a.PostTransfer())
+		e.POST("/inbound", a.PostInbound())
+		e.POST("/adjustments", a.PostAdjustment())
+		e.PUT("/reservation/:sku", a.PutReservation())
+		e.POST("/reservations", a.PostOrder())
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(pair.method, pair.value, strings.NewReader(pair.json))
+		req.Header.Set("Content-Type", "application/json")
+		e.ServeHTTP(rec, req)
+
+		assert.Equal(t, pair.result, rec.Code, "Http Code of "+pair.method+" "+pair.value+" "+pair.json+" doesn't match")
+
+		if rec.Code >= http.StatusBadRequest {
+			erm := new(gen.ErrResponse)
+			_ = json.Unmarshal([]byte(rec.Body.String()), erm)
+			assert.Equal(t, pair.code, erm.Error.Code, "ErrorCode doesn't match")
+		}
+	}
+}
+
+/*
+Tests for the reservations of the components of a bundle
+*/
+type bundleReservationProviderApi struct {
+	json       string
+	components []gen.Reservation
+	published  []string
+}
+
+var testBundleReservationProviderApi = []bundleReservationProviderApi{
+	{`{"warehouse":"A","quantity":2,"reference":"R1"}`, []gen.Reservation{{Id: 1, Sku: "SBC", Warehouse: "A", Quantity: 4, Reference: "R1"}, {Id: 2, Sku: "SCM", Warehouse: "A", Quantity: 2, Reference: "R1"}}, []string{"SBC", "SCM", "SBN"}}, // components of the warehouse
+	{`{"quantity":3}`, []gen.Reservation{{Id: 1, Sku: "SBC", Warehouse: "A", Quantity: 6}, {Id: 2, Sku: "SCM", Warehouse: "A", Quantity: 3}}, []string{"SBC", "SCM", "SBN"}},                                                                    // components of the allocated warehouse
+}
+
+func TestBundleReservation(t *testing.T) {
+	for _, pair := range testBundleReservationProviderApi {
+		p := new(mock.PublisherMock)
+		r := new(mock.RepositoryMock)
+		a := New(r, p, nil)
+
+		// Setup
+		e := echo.New()
+		e.PUT("/reservation/:sku", a.PutReservation())
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("PUT", "/reservation/SBN", strings.NewReader(pair.json))
+		req.Header.Set("Content-Type", "application/json")
+		e.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code, "Http Code of "+pair.json+" doesn't match")
+
+		res := new(gen.Reservation)
+		_ = json.Unmarshal([]byte(rec.Body.String()), res)
+
+		var components []gen.Reservation
+		for _, c := range res.Components {
+			c.Ttl, c.ExpiresAt = 0, nil
+			components = append(components, c)
+		}
+		assert.Equal(t, pair.components, components, "Components of "+pair.json+" don't match")
+		assert.Equal(t, pair.published, p.Published, "Published skus of "+pair.json+" don't match")
+	}
+}
+
+/*
+Tests for the stock of a bundle and of its components
+*/
+func TestBundleStock(t *testing.T) {
+	p := new(mock.PublisherMock)
+	r := new(mock.RepositoryMock)
+	a := New(r, p, nil)
+
+	// Setup
+	e := echo.New()
+	e.GET("/stock/:sku", a.GetStock())
+	e.PUT("/stock/:sku/:action", a.PutStock())
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/stock/SBN", nil)
+	e.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code, "Http Code doesn't match")
+
+	s := new(gen.SkuResponse)
+	_ = json.Unmarshal([]byte(rec.Body.String()), s)
+	assert.Equal(t, int64(3), s.Available, "Available bundles don't match")
+	assert.Equal(t, 2, len(s.Components), "Components don't match")
+
+	// a component publishes the bundles made of it
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest("PUT", "/stock/SBC/add", strings.NewReader(`{"warehouse":"A","quantity":2}`))
+	req.Header.Set("Content-Type", "application/json")
+	e.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code, "Http Code doesn't match")
+	assert.Equal(t, []string{"SBC", "SBN"}, p.Published, "Published skus don't match")
+
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest("PUT", "/stock/SBCE/add", strings.NewReader(`{"warehouse":"A","quantity":2}`))
+	req.Header.Set("Content-Type", "application/json")
+	e.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusInternalServerError, rec.Code, "Http Code of RepoFindBundlesWith error doesn't match")
+}
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"fmt"
+	"github.com/labstack/echo"
+	strut "github.com/pintobikez/stock-service/api/structures"
+	"net/http"
+)
+
+// Handler to GET Channel allocations request
+func (a *API) GetChannelAllocations() echo.HandlerFunc {
+	return func(c echo.Context) error {
+
+		allocations, err := a.rp.FindChannelAllocations(c.Param("sku"))
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, &strut.ErrResponse{strut.ErrContent{ErrorCodeSkuNotFound, err.Error()}})
+		}
+
+		return c.JSON(http.StatusOK, allocations)
+	}
+}
+
+// Handler to PUT Channel allocation request
+// An allocation without quantity nor percentage gives its units back to the shared ones
+func (a *API) PutChannelAllocation() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		ch := new(strut.ChannelAllocation)
+
+		if err := c.Bind(ch); err != nil {
+			return c.JSON(http.StatusBadRequest, &strut.ErrResponse{strut.ErrContent{ErrorCodeWrongJsonFormat, err.Error()}})
+		}
+		ch.Sku = c.Param("sku")
+
+		if err := a.validateChannelAllocation(ch); err != nil {
+			return c.JSON(http.StatusBadRequest, &strut.ErrResponse{strut.ErrContent{ErrorCodeInvalidContent, err.Error()}})
+		}
+
+		if err := a.rp.UpdateChannelAllocation(ch); err != nil {
+			if err.Error() == "404" {
+				return c.JSON(http.StatusNotFound, &strut.ErrResponse{strut.ErrContent{ErrorCodeSkuNotFound, fmt.Sprintf(SkuWarehouseNotFound, ch.Sku, ch.Warehouse)}})
+			}
+			return c.JSON(http.StatusInternalServerError, &strut.ErrResponse{strut.ErrContent{ErrorCodeStoringContent, err.Error()}})
+		}
+
+		// the units of every channel changed
+		skuResponse, err := a.rp.FindSku(ch.Sku)
+		if err != nil {
+			return c.JSON(http.StatusNotFound, &strut.ErrResponse{strut.ErrContent{ErrorCodeSkuNotFound, fmt.Sprintf(SkuNotFound, ch.Sku)}})
+		}
+
+		if err := a.publish(skuResponse); err != nil {
+			return c.JSON(http.StatusInternalServerError, &strut.ErrResponse{strut.ErrContent{ErrorCodePublishingMessage, err.Error()}})
+		}
+
+		return c.JSON(http.StatusOK, skuResponse)
+	}
+}
+
+// Validates the consistency of the ChannelAllocation struct
+func (a *API) validateChannelAllocation(ch *strut.ChannelAllocation) error {
+	if ch.Sku == "" {
+		return fmt.Errorf("Sku is empty")
+	}
+	if ch.Warehouse == "" {
+		return fmt.Errorf("Warehouse is empty")
+	}
+	if ch.Channel == "" {
+		return fmt.Errorf("Channel is empty")
+	}
+	if len(ch.Channel) > 32 {
+		return fmt.Errorf("Channel is longer than 32 characters")
+	}
+	// the shared units are the ones no channel is allocated
+	if ch.Channel == strut.ChannelShared {
+		return fmt.Errorf("Channel %s is reserved", ch.Channel)
+	}
+	if ch.Quantity != nil && ch.Percentage != nil {
+		return fmt.Errorf("Quantity and percentage are both set")
+	}
+	if ch.Quantity != nil && *ch.Quantity < 0 {
+		return fmt.Errorf("Quantity is negative")
+	}
+	if ch.Percentage != nil && (*ch.Percentage < 0 || *ch.Percentage > 100) {
+		return fmt.Errorf("Percentage is not between 0 and 100")
+	}
+	return a.knownWarehouse(ch.Warehouse)
+}
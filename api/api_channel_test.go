@@ -0,0 +1,115 @@
+package api
+
+import (
+	"encoding/json"
+	"github.com/labstack/echo"
+	gen "github.com/pintobikez/stock-service/api/structures"
+	mock "github.com/pintobikez/stock-service/mocks"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+/*
+Tests for the Channel allocation methods
+*/
+type channelProviderApi struct {
+	method string
+	value  string
+	json   string
+	result int
+	code   int
+}
+
+var testChannelProviderApi = []channelProviderApi{
+	{"GET", "/stock/SAC/channels", "", http.StatusInternalServerError, ErrorCodeSkuNotFound},                                                         // RepoFindChannelAllocations error
+	{"GET", "/stock/SCH/channels", "", http.StatusOK, 0},                                                                                             // allocations found
+	{"PUT", "/stock/SCC/channels", `{"warehouse":"A"`, http.StatusBadRequest, ErrorCodeWrongJsonFormat},                                              // invalid json
+	{"PUT", "/stock/SCC/channels", `{"channel":"web","quantity":2}`, http.StatusBadRequest, ErrorCodeInvalidContent},                                 // empty warehouse
+	{"PUT", "/stock/SCC/channels", `{"warehouse":"A","quantity":2}`, http.StatusBadRequest, ErrorCodeInvalidContent},                                 // empty channel
+	{"PUT", "/stock/SCC/channels", `{"warehouse":"A","channel":"shared","quantity":2}`, http.StatusBadRequest, ErrorCodeInvalidContent},              // reserved channel
+	{"PUT", "/stock/SCC/channels", `{"warehouse":"A","channel":"web","quantity":2,"percentage":10}`, http.StatusBadRequest, ErrorCodeInvalidContent}, // quantity and percentage
+	{"PUT", "/stock/SCC/channels", `{"warehouse":"A","channel":"web","quantity":-2}`, http.StatusBadRequest, ErrorCodeInvalidContent},                // negative quantity
+	{"PUT", "/stock/SCC/channels", `{"warehouse":"A","channel":"web","percentage":101}`, http.StatusBadRequest, ErrorCodeInvalidContent},             // percentage above 100
+	{"PUT", "/stock/SCC/channels", `{"warehouse":"X","channel":"web","quantity":2}`, http.StatusBadRequest, ErrorCodeInvalidContent},                 // unknown warehouse
+	{"PUT", "/stock/SAC/channels", `{"warehouse":"A","channel":"web","quantity":2}`, http.StatusInternalServerError, ErrorCodeStoringContent},        // RepoUpdateChannelAllocation error
+	{"PUT", "/stock/SCA/channels", `{"warehouse":"A","channel":"web","quantity":2}`, http.StatusNotFound, ErrorCodeSkuNotFound},                      // Sku not stored in the warehouse
+	{"PUT", "/stock/SCCC/channels", `{"warehouse":"A","channel":"web","quantity":2}`, http.StatusNotFound, ErrorCodeSkuNotFound},                     // RepoFindSku error
+	{"PUT", "/stock/SCD/channels", `{"warehouse":"A","channel":"web","quantity":2}`, http.StatusInternalServerError, ErrorCodePublishingMessage},     // Error Publish
+	{"PUT", "/stock/SCC/channels", `{"warehouse":"A","channel":"web","percentage":30}`, http.StatusOK, 0},                                            // Update OK
+	{"PUT", "/stock/SCC/channels", `{"warehouse":"A","channel":"web"}`, http.StatusOK, 0},                                                            // Remove OK
+}
+
+func TestChannelAllocation(t *testing.T) {
+	for _, pair := range testChannelProviderApi {
+		p := new(mock.PublisherMock)
+		r := new(mock.RepositoryMock)
+		a := New(r, p, nil)
+
+		// Setup
+		e := echo.New()
+		e.GET("/stock/:sku/channels", a.GetChannelAllocations())
+		e.PUT("/stock/:sku/channels", a.PutChannelAllocation())
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(pair.method, pair.value, strings.NewReader(pair.json))
+		req.Header.Set("Content-Type", "application/json")
+		e.ServeHTTP(rec, req)
+
+		assert.Equal(t, pair.result, rec.Code, "Http Code of "+pair.method+" "+pair.value+" doesn't match")
+
+		if rec.Code >= http.StatusBadRequest {
+			erm := new(gen.ErrResponse)
+			_ = json.Unmarshal([]byte(rec.Body.String()), erm)
+			assert.Equal(t, pair.code, erm.Error.Code, "ErrorCode doesn't match")
+		}
+	}
+}
+
+/*
+Tests for the channel view of GetStock
+*/
+type stockChannelProviderApi struct {
+	value     string
+	channel   string
+	available int64
+	values    []int64
+}
+
+var testStockChannelProviderApi = []stockChannelProviderApi{
+	{"/stock/SCH", "", 15, []int64{10, 5}},               // every sellable unit
+	{"/stock/SCH?channel=web", "web", 8, []int64{3, 5}},  // allocation of the channel and shared units
+	{"/stock/SCH?channel=pos", "pos", 10, []int64{5, 5}}, // channel without allocation
+	{"/stock/SCC?channel=web", "web", 10, []int64{10}},   // sku without allocations
+}
+
+func TestGetStockChannel(t *testing.T) {
+	for _, pair := range testStockChannelProviderApi {
+		p := new(mock.PublisherMock)
+		r := new(mock.RepositoryMock)
+		a := New(r, p, nil)
+
+		// Setup
+		e := echo.New()
+		e.GET("/stock/:sku", a.GetStock())
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", pair.value, nil)
+		e.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code, "Http Code of "+pair.value+" doesn't match")
+
+		val := new(gen.SkuResponse)
+		_ = json.Unmarshal([]byte(rec.Body.String()), val)
+		assert.Equal(t, pair.channel, val.Channel, "Channel doesn't match")
+		assert.Equal(t, pair.available, val.Available, "Available of "+pair.value+" doesn't match")
+
+		var values []int64
+		for _, v := range val.Values {
+			values = append(values, v.Available)
+		}
+		assert.Equal(t, pair.values, values, "Available by warehouse of "+pair.value+" doesn't match")
+	}
+}
@@ -0,0 +1,142 @@
+package api
+
+import (
+	"fmt"
+	"github.com/labstack/echo"
+	strut "github.com/pintobikez/stock-service/api/structures"
+	"net/http"
+	"strconv"
+)
+
+// Handler to POST Inbound request
+func (a *API) PostInbound() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		i := new(strut.Inbound)
+
+		if err := c.Bind(i); err != nil {
+			return c.JSON(http.StatusBadRequest, &strut.ErrResponse{strut.ErrContent{ErrorCodeWrongJsonFormat, err.Error()}})
+		}
+		*i = strut.Inbound{Sku: i.Sku, Warehouse: i.Warehouse, Quantity: i.Quantity, ExpectedAt: i.ExpectedAt, Reference: i.Reference}
+
+		if err := a.validateInbound(i); err != nil {
+			return c.JSON(http.StatusBadRequest, &strut.ErrResponse{strut.ErrContent{ErrorCodeInvalidContent, err.Error()}})
+		}
+		i.RequestId, i.Caller = origin(c)
+
+		id, err := a.rp.InsertInbound(i)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, &strut.ErrResponse{strut.ErrContent{ErrorCodeStoringContent, err.Error()}})
+		}
+		i.Id = id
+		i.Status = strut.InboundExpected
+
+		return c.JSON(http.StatusCreated, i)
+	}
+}
+
+// Handler to GET Inbound request
+func (a *API) GetInbound() echo.HandlerFunc {
+	return func(c echo.Context) error {
+
+		i, httpcode, code, err := a.findInbound(c)
+		if err != nil {
+			return c.JSON(httpcode, &strut.ErrResponse{strut.ErrContent{code, err.Error()}})
+		}
+
+		return c.JSON(http.StatusOK, i)
+	}
+}
+
+// Handler to POST Inbound receive request
+func (a *API) ReceiveInbound() echo.HandlerFunc {
+	return a.moveInbound(a.rp.ReceiveInbound)
+}
+
+// Handler to POST Inbound cancel request
+func (a *API) CancelInbound() echo.HandlerFunc {
+	return a.moveInbound(a.rp.CancelInbound)
+}
+
+// Moves an Inbound supply to its next status with the given repository step
+// The stock of its sku is published once the units are received
+func (a *API) moveInbound(step func(i *strut.Inbound) error) echo.HandlerFunc {
+	return func(c echo.Context) error {
+
+		i, httpcode, code, err := a.findInbound(c)
+		if err != nil {
+			return c.JSON(httpcode, &strut.ErrResponse{strut.ErrContent{code, err.Error()}})
+		}
+		i.RequestId, i.Caller = origin(c)
+
+		if err := step(i); err != nil {
+			switch err.Error() {
+			case "404":
+				return c.JSON(http.StatusNotFound, &strut.ErrResponse{strut.ErrContent{ErrorCodeInboundNotFound, fmt.Sprintf(InboundNotFound, i.Id)}})
+			case "409":
+				return c.JSON(http.StatusConflict, &strut.ErrResponse{strut.ErrContent{ErrorCodeInsufficientStock, fmt.Sprintf(InboundPromised, i.Id, i.Sku, i.Warehouse)}})
+			case "412":
+				return c.JSON(http.StatusConflict, &strut.ErrResponse{strut.ErrContent{ErrorCodeInboundStatus, fmt.Sprintf(InboundStatus, i.Id, i.Status)}})
+			}
+			return c.JSON(http.StatusInternalServerError, &strut.ErrResponse{strut.ErrContent{ErrorCodeStoringContent, err.Error()}})
+		}
+
+		if i.Status == strut.InboundReceived {
+			skuResponse, err := a.rp.FindSku(i.Sku)
+			if err != nil {
+				return c.JSON(http.StatusNotFound, &strut.ErrResponse{strut.ErrContent{ErrorCodeSkuNotFound, fmt.Sprintf(SkuNotFound, i.Sku)}})
+			}
+
+			if err := a.publish(skuResponse); err != nil {
+				return c.JSON(http.StatusInternalServerError, &strut.ErrResponse{strut.ErrContent{ErrorCodePublishingMessage, err.Error()}})
+			}
+		}
+
+		return c.JSON(http.StatusOK, i)
+	}
+}
+
+// Finds the Inbound supply of the url
+func (a *API) findInbound(c echo.Context) (*strut.Inbound, int, int, error) {
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || id <= 0 {
+		return nil, http.StatusBadRequest, ErrorCodeInvalidContent, fmt.Errorf("Inbound id %s is invalid", c.Param("id"))
+	}
+
+	i, err := a.rp.FindInbound(id)
+	if err != nil {
+		return nil, http.StatusInternalServerError, ErrorCodeInboundNotFound, err
+	}
+	if i.Id == 0 {
+		return nil, http.StatusNotFound, ErrorCodeInboundNotFound, fmt.Errorf(InboundNotFound, id)
+	}
+
+	return i, http.StatusOK, 0, nil
+}
+
+// Validates the consistency of the Inbound struct
+func (a *API) validateInbound(i *strut.Inbound) error {
+	if i.Sku == "" {
+		return fmt.Errorf("Sku is empty")
+	}
+	if i.Warehouse == "" {
+		return fmt.Errorf("Warehouse is empty")
+	}
+	if i.Quantity <= 0 {
+		return fmt.Errorf("Quantity is not positive")
+	}
+	if i.ExpectedAt == nil {
+		return fmt.Errorf("Expected_at is empty")
+	}
+	if len(i.Reference) > 64 {
+		return fmt.Errorf("Reference is longer than 64 characters")
+	}
+	// a serialized sku receives its units as registered serial numbers
+	if err := a.notSerialized(i.Sku); err != nil {
+		return err
+	}
+	if err := a.notBundle(i.Sku); err != nil {
+		return err
+	}
+	return a.knownWarehouse(i.Warehouse)
+}
@@ -0,0 +1,133 @@
+package api
+
+import (
+	"encoding/json"
+	"github.com/labstack/echo"
+	gen "github.com/pintobikez/stock-service/api/structures"
+	mock "github.com/pintobikez/stock-service/mocks"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+/*
+Tests for the Inbound methods
+*/
+type inboundProviderApi struct {
+	method    string
+	value     string
+	json      string
+	result    int
+	code      int
+	status    string
+	published bool
+}
+
+var testInboundProviderApi = []inboundProviderApi{
+	{"POST", "/inbound", `{"sku":"SCC"`, http.StatusBadRequest, ErrorCodeWrongJsonFormat, "", false},                                                                               // invalid json
+	{"POST", "/inbound", `{"warehouse":"A","quantity":5,"expected_at":"2017-11-20T00:00:00Z"}`, http.StatusBadRequest, ErrorCodeInvalidContent, "", false},                         // empty sku
+	{"POST", "/inbound", `{"sku":"SCC","quantity":5,"expected_at":"2017-11-20T00:00:00Z"}`, http.StatusBadRequest, ErrorCodeInvalidContent, "", false},                             // empty warehouse
+	{"POST", "/inbound", `{"sku":"SCC","warehouse":"A","quantity":0,"expected_at":"2017-11-20T00:00:00Z"}`, http.StatusBadRequest, ErrorCodeInvalidContent, "", false},             // no quantity
+	{"POST", "/inbound", `{"sku":"SCC","warehouse":"A","quantity":5}`, http.StatusBadRequest, ErrorCodeInvalidContent, "", false},                                                  // no expected date
+	{"POST", "/inbound", `{"sku":"SCC","warehouse":"I","quantity":5,"expected_at":"2017-11-20T00:00:00Z"}`, http.StatusBadRequest, ErrorCodeInvalidContent, "", false},             // inactive warehouse
+	{"POST", "/inbound", `{"sku":"SSN","warehouse":"A","quantity":5,"expected_at":"2017-11-20T00:00:00Z"}`, http.StatusBadRequest, ErrorCodeInvalidContent, "", false},             // serialized sku
+	{"POST", "/inbound", `{"sku":"SC","warehouse":"A","quantity":5,"expected_at":"2017-11-20T00:00:00Z"}`, http.StatusInternalServerError, ErrorCodeStoringContent, "", false},     // RepoInsertInbound error
+	{"POST", "/inbound", `{"sku":"SCC","warehouse":"A","quantity":5,"expected_at":"2017-11-20T00:00:00Z","status":"received"}`, http.StatusCreated, 0, gen.InboundExpected, false}, // Insert OK
+	{"GET", "/inbound/ABC", "", http.StatusBadRequest, ErrorCodeInvalidContent, "", false},                                                                                         // invalid Inbound id
+	{"GET", "/inbound/1", "", http.StatusInternalServerError, ErrorCodeInboundNotFound, "", false},                                                                                 // RepoFindInbound error
+	{"GET", "/inbound/2", "", http.StatusNotFound, ErrorCodeInboundNotFound, "", false},                                                                                            // Inbound not found
+	{"GET", "/inbound/5", "", http.StatusOK, 0, gen.InboundReceived, false},                                                                                                        // Inbound found
+	{"POST", "/inbound/3/receive", "", http.StatusInternalServerError, ErrorCodeStoringContent, "", false},                                                                         // RepoReceiveInbound error
+	{"POST", "/inbound/5/receive", "", http.StatusConflict, ErrorCodeInboundStatus, "", false},                                                                                     // already received
+	{"POST", "/inbound/6/receive", "", http.StatusInternalServerError, ErrorCodePublishingMessage, "", false},                                                                      // Error Publish
+	{"POST", "/inbound/8/receive", "", http.StatusOK, 0, gen.InboundReceived, true},                                                                                                // Receive OK
+	{"POST", "/inbound/4/cancel", "", http.StatusConflict, ErrorCodeInsufficientStock, "", false},                                                                                  // promised to pre-orders
+	{"POST", "/inbound/5/cancel", "", http.StatusConflict, ErrorCodeInboundStatus, "", false},                                                                                      // already received
+	{"POST", "/inbound/8/cancel", "", http.StatusOK, 0, gen.InboundCancelled, false},                                                                                               // Cancel OK, nothing published
+}
+
+func TestInbound(t *testing.T) {
+	for _, pair := range testInboundProviderApi {
+		p := new(mock.PublisherMock)
+		r := new(mock.RepositoryMock)
+		a := New(r, p, nil)
+
+		// Setup
+		e := echo.New()
+		e.POST("/inbound", a.PostInbound())
+		e.GET("/inbound/:id", a.GetInbound())
+		e.POST("/inbound/:id/receive", a.ReceiveInbound())
+		e.POST("/inbound/:id/cancel", a.CancelInbound())
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(pair.method, pair.value, strings.NewReader(pair.json))
+		req.Header.Set("Content-Type", "application/json")
+		e.ServeHTTP(rec, req)
+
+		assert.Equal(t, pair.result, rec.Code, "Http Code of "+pair.method+" "+pair.value+" doesn't match")
+		assert.Equal(t, pair.published, len(p.Published) > 0, "Published doesn't match")
+
+		if rec.Code >= http.StatusBadRequest {
+			erm := new(gen.ErrResponse)
+			_ = json.Unmarshal([]byte(rec.Body.String()), erm)
+			assert.Equal(t, pair.code, erm.Error.Code, "ErrorCode doesn't match")
+		} else {
+			val := new(gen.Inbound)
+			_ = json.Unmarshal([]byte(rec.Body.String()), val)
+			assert.Equal(t, pair.status, val.Status, "Status doesn't match")
+		}
+	}
+}
+
+/*
+Tests for GetStock method with the atp view
+*/
+type getStockAtpProviderApi struct {
+	value     string
+	result    int
+	code      int
+	available []int64
+}
+
+var testGetStockAtpProviderApi = []getStockAtpProviderApi{
+	{"/stock/SCC?view=forecast", http.StatusBadRequest, ErrorCodeInvalidContent, nil},      // unknown view
+	{"/stock/SCA?view=atp", http.StatusNotFound, ErrorCodeSkuNotFound, nil},                // sku not found
+	{"/stock/SAC?view=atp", http.StatusInternalServerError, ErrorCodeInboundNotFound, nil}, // RepoFindInbounds error
+	{"/stock/SCC?view=atp", http.StatusOK, 0, []int64{10, 15}},                             // on hand now, inbound in a month
+	{"/stock/SCC?view=atp&warehouse=B", http.StatusOK, 0, []int64{0}},                      // warehouse without stock nor inbound
+}
+
+func TestGetStockAtp(t *testing.T) {
+	for _, pair := range testGetStockAtpProviderApi {
+		p := new(mock.PublisherMock)
+		r := new(mock.RepositoryMock)
+		a := New(r, p, nil)
+
+		// Setup
+		e := echo.New()
+		e.GET("/stock/:sku", a.GetStock())
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest("GET", pair.value, nil))
+
+		assert.Equal(t, pair.result, rec.Code, "Http Code of "+pair.value+" doesn't match")
+
+		if rec.Code >= http.StatusBadRequest {
+			erm := new(gen.ErrResponse)
+			_ = json.Unmarshal([]byte(rec.Body.String()), erm)
+			assert.Equal(t, pair.code, erm.Error.Code, "ErrorCode doesn't match")
+			continue
+		}
+
+		val := new(gen.Atp)
+		_ = json.Unmarshal([]byte(rec.Body.String()), val)
+
+		var available []int64
+		for _, point := range val.Points {
+			available = append(available, point.Available)
+		}
+		assert.Equal(t, pair.available, available, "Available to promise doesn't match")
+	}
+}
@@ -0,0 +1,126 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/labstack/echo"
+	strut "github.com/pintobikez/stock-service/api/structures"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Handler to GET Stock listing request
+func (a *API) ListStock() echo.HandlerFunc {
+	return func(c echo.Context) error {
+
+		f, err := stockFilter(c)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, &strut.ErrResponse{strut.ErrContent{ErrorCodeInvalidContent, err.Error()}})
+		}
+
+		// one more item than asked tells if there is a next page
+		limit := f.Limit
+		f.Limit++
+
+		items, err := a.rp.ListStock(f)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, &strut.ErrResponse{strut.ErrContent{ErrorCodeStoringContent, err.Error()}})
+		}
+
+		resp := &strut.StockList{Items: items}
+		if int64(len(items)) > limit {
+			resp.Items = items[:limit]
+			resp.NextCursor = encodeStockCursor(&items[limit-1])
+		}
+
+		return c.JSON(http.StatusOK, resp)
+	}
+}
+
+// Builds the filter of the stock listing from the url
+func stockFilter(c echo.Context) (*strut.StockFilter, error) {
+	f := &strut.StockFilter{Warehouse: c.QueryParam("warehouse"), SkuPrefix: c.QueryParam("sku_prefix"), Sort: strut.SortSku, Limit: DefaultListLimit}
+
+	if v := c.QueryParam("min_avail"); v != "" {
+		min, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Min_avail %s is not a number", v)
+		}
+		f.MinAvail = &min
+	}
+	if v := c.QueryParam("max_avail"); v != "" {
+		max, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Max_avail %s is not a number", v)
+		}
+		f.MaxAvail = &max
+	}
+	if v := c.QueryParam("updated_from"); v != "" {
+		from, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return nil, fmt.Errorf("Updated_from %s is not a RFC3339 date", v)
+		}
+		f.UpdatedFrom = &from
+	}
+	if v := c.QueryParam("updated_to"); v != "" {
+		to, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return nil, fmt.Errorf("Updated_to %s is not a RFC3339 date", v)
+		}
+		f.UpdatedTo = &to
+	}
+
+	if v := c.QueryParam("sort"); v != "" {
+		f.Desc = strings.HasPrefix(v, "-")
+		f.Sort = strings.TrimPrefix(v, "-")
+
+		switch f.Sort {
+		case strut.SortSku, strut.SortUpdatedAt, strut.SortAvail:
+		default:
+			return nil, fmt.Errorf("Sort %s is not one of sku, updated_at or avail, optionally prefixed with -", v)
+		}
+	}
+	if v := c.QueryParam("cursor"); v != "" {
+		after, err := decodeStockCursor(v)
+		if err != nil {
+			return nil, fmt.Errorf("Cursor %s is invalid", v)
+		}
+		f.After = after
+	}
+	if v := c.QueryParam("limit"); v != "" {
+		limit, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || limit <= 0 || limit > MaxListLimit {
+			return nil, fmt.Errorf("Limit must be between 1 and %d", MaxListLimit)
+		}
+		f.Limit = limit
+	}
+
+	return f, nil
+}
+
+// Encodes the position of the given StockItem as an opaque cursor
+func encodeStockCursor(i *strut.StockItem) string {
+	b, _ := json.Marshal(&strut.StockItem{Sku: i.Sku, Warehouse: i.Warehouse, Available: i.Available, UpdatedAt: i.UpdatedAt})
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// Decodes a cursor built by encodeStockCursor
+func decodeStockCursor(cursor string) (*strut.StockItem, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	i := new(strut.StockItem)
+	if err := json.Unmarshal(b, i); err != nil {
+		return nil, err
+	}
+	if i.Sku == "" || i.Warehouse == "" {
+		return nil, fmt.Errorf("Cursor is empty")
+	}
+
+	return i, nil
+}
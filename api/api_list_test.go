@@ -0,0 +1,106 @@
+package api
+
+import (
+	"encoding/json"
+	"github.com/labstack/echo"
+	gen "github.com/pintobikez/stock-service/api/structures"
+	mock "github.com/pintobikez/stock-service/mocks"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+/*
+Tests for ListStock method
+*/
+type listStockProviderApi struct {
+	value  string
+	result int
+	code   int
+	items  []string
+	next   bool
+}
+
+var testListStockProviderApi = []listStockProviderApi{
+	{"/stock?min_avail=low", http.StatusBadRequest, ErrorCodeInvalidContent, nil, false},                                                       // invalid min_avail
+	{"/stock?max_avail=1.5", http.StatusBadRequest, ErrorCodeInvalidContent, nil, false},                                                       // invalid max_avail
+	{"/stock?updated_from=yesterday", http.StatusBadRequest, ErrorCodeInvalidContent, nil, false},                                              // invalid updated_from
+	{"/stock?updated_to=2017-13-01", http.StatusBadRequest, ErrorCodeInvalidContent, nil, false},                                               // invalid updated_to
+	{"/stock?sort=quantity", http.StatusBadRequest, ErrorCodeInvalidContent, nil, false},                                                       // invalid sort
+	{"/stock?cursor=abc", http.StatusBadRequest, ErrorCodeInvalidContent, nil, false},                                                          // invalid cursor
+	{"/stock?limit=501", http.StatusBadRequest, ErrorCodeInvalidContent, nil, false},                                                           // limit too big
+	{"/stock?warehouse=ERR", http.StatusInternalServerError, ErrorCodeStoringContent, nil, false},                                              // RepoListStock error
+	{"/stock", http.StatusOK, 0, []string{"SCA/A", "SCC/A", "SCC/B", "SCD/A", "XYZ/B"}, false},                                                 // every item
+	{"/stock?warehouse=B", http.StatusOK, 0, []string{"SCC/B", "XYZ/B"}, false},                                                                // by warehouse
+	{"/stock?sku_prefix=SC&max_avail=0", http.StatusOK, 0, []string{"SCA/A"}, false},                                                           // out of stock
+	{"/stock?min_avail=1&max_avail=5", http.StatusOK, 0, []string{"SCC/B", "XYZ/B"}, false},                                                    // low stock
+	{"/stock?updated_from=2017-01-02T00:00:00Z&updated_to=2017-01-04T00:00:00Z", http.StatusOK, 0, []string{"SCC/B", "SCD/A", "XYZ/B"}, false}, // updated range
+	{"/stock?sort=-avail&limit=2", http.StatusOK, 0, []string{"SCC/A", "SCD/A"}, true},                                                         // sorted descending, first page
+	{"/stock?sort=updated_at&limit=2", http.StatusOK, 0, []string{"SCC/A", "SCD/A"}, true},                                                     // sorted by update, first page
+}
+
+func TestListStock(t *testing.T) {
+	for _, pair := range testListStockProviderApi {
+		val := listStock(t, pair.value, pair.result, pair.code)
+		if val == nil {
+			continue
+		}
+
+		assert.Equal(t, pair.items, stockItemKeys(val.Items), "Items don't match")
+		assert.Equal(t, pair.next, val.NextCursor != "", "Cursor doesn't match")
+	}
+}
+
+func TestListStockPages(t *testing.T) {
+	for _, sort := range []string{"sku", "-sku", "updated_at", "-updated_at", "avail", "-avail"} {
+		all := listStock(t, "/stock?sort="+sort, http.StatusOK, 0)
+
+		// walking the pages returns every item once, in the same order
+		var paged []gen.StockItem
+		page := listStock(t, "/stock?limit=2&sort="+sort, http.StatusOK, 0)
+		for {
+			paged = append(paged, page.Items...)
+			if page.NextCursor == "" {
+				break
+			}
+			page = listStock(t, "/stock?limit=2&sort="+sort+"&cursor="+page.NextCursor, http.StatusOK, 0)
+		}
+
+		assert.Equal(t, stockItemKeys(all.Items), stockItemKeys(paged), "Pages of sort "+sort+" don't match")
+	}
+}
+
+func listStock(t *testing.T, value string, result int, code int) *gen.StockList {
+	a := New(new(mock.RepositoryMock), new(mock.PublisherMock), nil)
+
+	// Setup
+	e := echo.New()
+	e.GET("/stock", a.ListStock())
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", value, strings.NewReader(""))
+	e.ServeHTTP(rec, req)
+
+	assert.Equal(t, result, rec.Code, "Http Code doesn't match")
+
+	if result != http.StatusOK {
+		erm := new(gen.ErrResponse)
+		_ = json.Unmarshal([]byte(rec.Body.String()), erm)
+		assert.Equal(t, code, erm.Error.Code, "ErrorCode doesn't match")
+		return nil
+	}
+
+	val := new(gen.StockList)
+	_ = json.Unmarshal([]byte(rec.Body.String()), val)
+	return val
+}
+
+func stockItemKeys(items []gen.StockItem) []string {
+	var keys []string
+	for _, i := range items {
+		keys = append(keys, i.Sku+"/"+i.Warehouse)
+	}
+	return keys
+}
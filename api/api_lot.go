@@ -0,0 +1,86 @@
+package api
+
+import (
+	"fmt"
+	"github.com/labstack/echo"
+	strut "github.com/pintobikez/stock-service/api/structures"
+	"net/http"
+)
+
+// Handler to GET Lots request
+func (a *API) GetLots() echo.HandlerFunc {
+	return func(c echo.Context) error {
+
+		lots, err := a.rp.FindLots(c.Param("sku"))
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, &strut.ErrResponse{strut.ErrContent{ErrorCodeSkuNotFound, err.Error()}})
+		}
+
+		return c.JSON(http.StatusOK, lots)
+	}
+}
+
+// Handler to PUT Lot request
+// The quantity of the stock changes by the units the lot gains or loses, a lot without units is removed
+func (a *API) PutLot() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		l := new(strut.Lot)
+
+		if err := c.Bind(l); err != nil {
+			return c.JSON(http.StatusBadRequest, &strut.ErrResponse{strut.ErrContent{ErrorCodeWrongJsonFormat, err.Error()}})
+		}
+		l.Sku = c.Param("sku")
+		l.RequestId, l.Caller = origin(c)
+
+		if err := a.validateLot(l); err != nil {
+			return c.JSON(http.StatusBadRequest, &strut.ErrResponse{strut.ErrContent{ErrorCodeInvalidContent, err.Error()}})
+		}
+
+		if err := a.rp.UpdateLot(l); err != nil {
+			if err.Error() == "409" {
+				return c.JSON(http.StatusConflict, &strut.ErrResponse{strut.ErrContent{ErrorCodeInsufficientStock, fmt.Sprintf(BackorderExceeded, l.Sku, l.Warehouse)}})
+			}
+			return c.JSON(http.StatusInternalServerError, &strut.ErrResponse{strut.ErrContent{ErrorCodeStoringContent, err.Error()}})
+		}
+
+		skuResponse, err := a.rp.FindSku(l.Sku)
+		if err != nil {
+			return c.JSON(http.StatusNotFound, &strut.ErrResponse{strut.ErrContent{ErrorCodeSkuNotFound, fmt.Sprintf(SkuNotFound, l.Sku)}})
+		}
+
+		if err := a.publish(skuResponse); err != nil {
+			return c.JSON(http.StatusInternalServerError, &strut.ErrResponse{strut.ErrContent{ErrorCodePublishingMessage, err.Error()}})
+		}
+
+		return c.JSON(http.StatusOK, skuResponse)
+	}
+}
+
+// Validates the consistency of the Lot struct
+func (a *API) validateLot(l *strut.Lot) error {
+	if l.Sku == "" {
+		return fmt.Errorf("Sku is empty")
+	}
+	if l.Warehouse == "" {
+		return fmt.Errorf("Warehouse is empty")
+	}
+	if l.Lot == "" {
+		return fmt.Errorf("Lot is empty")
+	}
+	if len(l.Lot) > 64 {
+		return fmt.Errorf("Lot is longer than 64 characters")
+	}
+	if l.ExpiresAt == nil {
+		return fmt.Errorf("Expires_at is empty")
+	}
+	if l.Quantity < 0 {
+		return fmt.Errorf("Quantity is negative")
+	}
+	if err := a.notSerialized(l.Sku); err != nil {
+		return err
+	}
+	if err := a.notBundle(l.Sku); err != nil {
+		return err
+	}
+	return a.knownWarehouse(l.Warehouse)
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"encoding/json"
+	"github.com/labstack/echo"
+	gen "github.com/pintobikez/stock-service/api/structures"
+	mock "github.com/pintobikez/stock-service/mocks"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+/*
+Tests for the Lot methods
+*/
+type lotProviderApi struct {
+	method string
+	value  string
+	json   string
+	result int
+	code   int
+}
+
+var testLotProviderApi = []lotProviderApi{
+	{"GET", "/stock/SAC/lots", "", http.StatusInternalServerError, ErrorCodeSkuNotFound},                                                                                    // RepoFindLots error
+	{"GET", "/stock/SLT/lots", "", http.StatusOK, 0},                                                                                                                        // lots found
+	{"PUT", "/stock/SCC/lots", `{"warehouse":"A"`, http.StatusBadRequest, ErrorCodeWrongJsonFormat},                                                                         // invalid json
+	{"PUT", "/stock/SCC/lots", `{"lot":"L1","expires_at":"2030-01-01T00:00:00Z","quantity":5}`, http.StatusBadRequest, ErrorCodeInvalidContent},                             // empty warehouse
+	{"PUT", "/stock/SCC/lots", `{"warehouse":"A","expires_at":"2030-01-01T00:00:00Z","quantity":5}`, http.StatusBadRequest, ErrorCodeInvalidContent},                        // empty lot
+	{"PUT", "/stock/SCC/lots", `{"warehouse":"A","lot":"L1","quantity":5}`, http.StatusBadRequest, ErrorCodeInvalidContent},                                                 // empty expiry date
+	{"PUT", "/stock/SCC/lots", `{"warehouse":"A","lot":"L1","expires_at":"2030-01-01T00:00:00Z","quantity":-5}`, http.StatusBadRequest, ErrorCodeInvalidContent},            // negative quantity
+	{"PUT", "/stock/SCC/lots", `{"warehouse":"X","lot":"L1","expires_at":"2030-01-01T00:00:00Z","quantity":5}`, http.StatusBadRequest, ErrorCodeInvalidContent},             // unknown warehouse
+	{"PUT", "/stock/SSN/lots", `{"warehouse":"A","lot":"L1","expires_at":"2030-01-01T00:00:00Z","quantity":5}`, http.StatusBadRequest, ErrorCodeInvalidContent},             // serialized sku
+	{"PUT", "/stock/SAC/lots", `{"warehouse":"A","lot":"L1","expires_at":"2030-01-01T00:00:00Z","quantity":5}`, http.StatusInternalServerError, ErrorCodeStoringContent},    // RepoUpdateLot error
+	{"PUT", "/stock/SCF/lots", `{"warehouse":"A","lot":"L1","expires_at":"2030-01-01T00:00:00Z","quantity":0}`, http.StatusConflict, ErrorCodeInsufficientStock},            // below the backorder limit
+	{"PUT", "/stock/SCCC/lots", `{"warehouse":"A","lot":"L1","expires_at":"2030-01-01T00:00:00Z","quantity":5}`, http.StatusNotFound, ErrorCodeSkuNotFound},                 // RepoFindSku error
+	{"PUT", "/stock/SCD/lots", `{"warehouse":"A","lot":"L1","expires_at":"2030-01-01T00:00:00Z","quantity":5}`, http.StatusInternalServerError, ErrorCodePublishingMessage}, // Error Publish
+	{"PUT", "/stock/SCC/lots", `{"warehouse":"A","lot":"L1","expires_at":"2030-01-01T00:00:00Z","quantity":5}`, http.StatusOK, 0},                                           // Update OK
+	{"PUT", "/stock/SCC/lots", `{"warehouse":"A","lot":"L1","expires_at":"2030-01-01T00:00:00Z","quantity":0}`, http.StatusOK, 0},                                           // Remove OK
+}
+
+func TestLot(t *testing.T) {
+	for _, pair := range testLotProviderApi {
+		p := new(mock.PublisherMock)
+		r := new(mock.RepositoryMock)
+		a := New(r, p, nil)
+
+		// Setup
+		e := echo.New()
+		e.GET("/stock/:sku/lots", a.GetLots())
+		e.PUT("/stock/:sku/lots", a.PutLot())
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(pair.method, pair.value, strings.NewReader(pair.json))
+		req.Header.Set("Content-Type", "application/json")
+		e.ServeHTTP(rec, req)
+
+		assert.Equal(t, pair.result, rec.Code, "Http Code of "+pair.method+" "+pair.value+" "+pair.json+" doesn't match")
+
+		if rec.Code >= http.StatusBadRequest {
+			erm := new(gen.ErrResponse)
+			_ = json.Unmarshal([]byte(rec.Body.String()), erm)
+			assert.Equal(t, pair.code, erm.Error.Code, "ErrorCode doesn't match")
+		}
+	}
+}
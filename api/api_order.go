@@ -0,0 +1,238 @@
+package api
+
+import (
+	"fmt"
+	"github.com/labstack/echo"
+	alloc "github.com/pintobikez/stock-service/allocation"
+	strut "github.com/pintobikez/stock-service/api/structures"
+	repo "github.com/pintobikez/stock-service/repository"
+	"net/http"
+	"time"
+)
+
+const (
+	MaxOrderLines = 100
+
+	OrderNotFound     = "Order %s holds no reservation"
+	OrderLineNotFound = "A Sku of order %s is not stored in the Warehouse of its line"
+	OrderInsufficient = "Not enough stock to reserve every line of order %s"
+	OrderExists       = "Order %s already holds reservations"
+)
+
+// Handler to POST Reservations request
+// Every line of the order is reserved, or none is, and an order already holding reservations is not reserved again
+func (a *API) PostOrder() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		o := new(strut.Order)
+
+		if err := c.Bind(o); err != nil {
+			return c.JSON(http.StatusBadRequest, &strut.ErrResponse{strut.ErrContent{ErrorCodeWrongJsonFormat, err.Error()}})
+		}
+		o.RequestId, o.Caller = origin(c)
+
+		if err := a.validateOrder(o); err != nil {
+			return c.JSON(http.StatusBadRequest, &strut.ErrResponse{strut.ErrContent{ErrorCodeInvalidContent, err.Error()}})
+		}
+
+		if httpcode, code, err := a.reserveOrder(o); err != nil {
+			return c.JSON(httpcode, &strut.ErrResponse{strut.ErrContent{code, err.Error()}})
+		}
+
+		if err := a.publishSkus(reservedSkus(o.Lines)); err != nil {
+			return c.JSON(http.StatusInternalServerError, &strut.ErrResponse{strut.ErrContent{ErrorCodePublishingMessage, err.Error()}})
+		}
+
+		return c.JSON(http.StatusCreated, o)
+	}
+}
+
+// Handler to DELETE Reservations request
+// Releases every line of the order
+func (a *API) DeleteOrder() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		o := &strut.Order{Order: c.Param("order")}
+		o.RequestId, o.Caller = origin(c)
+
+		skus, err := a.rp.DeleteReservations(o)
+		if err != nil {
+			if err.Error() == "404" {
+				return c.JSON(http.StatusNotFound, &strut.ErrResponse{strut.ErrContent{ErrorCodeReservationNotFound, fmt.Sprintf(OrderNotFound, o.Order)}})
+			}
+			return c.JSON(http.StatusInternalServerError, &strut.ErrResponse{strut.ErrContent{ErrorCodeStoringContent, err.Error()}})
+		}
+
+		if err := a.publishSkus(skus); err != nil {
+			return c.JSON(http.StatusInternalServerError, &strut.ErrResponse{strut.ErrContent{ErrorCodePublishingMessage, err.Error()}})
+		}
+
+		return c.NoContent(http.StatusOK)
+	}
+}
+
+// Reserves every line of an Order in a single transaction, the lines of a bundle reserving its components
+// Lines without warehouse are allocated with their strategy, and allocated again when the stock changes before they are stored
+func (a *API) reserveOrder(o *strut.Order) (int, int, error) {
+	allocating := false
+	bundles := make(map[string]*strut.Bundle)
+	for i, l := range o.Lines {
+		if l.Warehouse == "" {
+			allocating = true
+		}
+
+		if _, ok := bundles[l.Sku]; !ok {
+			b, err := a.rp.FindBundle(l.Sku)
+			if err != nil {
+				return http.StatusInternalServerError, ErrorCodeStoringContent, err
+			}
+			bundles[l.Sku] = b
+		}
+		if len(bundles[l.Sku].Components) > 0 && len(l.Serials) > 0 {
+			return http.StatusBadRequest, ErrorCodeInvalidContent, fmt.Errorf("Line %d: "+BundleSerials, i+1, l.Sku)
+		}
+	}
+
+	for attempt := 0; attempt < AllocationAttempts; attempt++ {
+		var reservations []*strut.Reservation
+		byLine := make([][]*strut.Reservation, len(o.Lines))
+		components := make([][]*strut.Reservation, len(o.Lines))
+
+		stock := make(map[string]*strut.SkuResponse)
+		var warehouses map[string]strut.Warehouse
+
+		for i := range o.Lines {
+			l := &o.Lines[i]
+			b := bundles[l.Sku]
+
+			if l.Warehouse != "" {
+				byLine[i] = []*strut.Reservation{l}
+				if len(b.Components) > 0 {
+					components[i] = componentReservations(b, byLine[i])
+					reservations = append(reservations, components[i]...)
+					continue
+				}
+				reservations = append(reservations, l)
+				continue
+			}
+
+			strategy, err := alloc.Get(l.Strategy)
+			if err != nil {
+				return http.StatusBadRequest, ErrorCodeInvalidContent, err
+			}
+
+			// lines of the same sku are allocated out of the same stock
+			s, ok := stock[l.Sku]
+			if !ok {
+				skuResponse, err := a.rp.FindSku(l.Sku)
+				if err != nil {
+					return http.StatusNotFound, ErrorCodeSkuNotFound, fmt.Errorf(SkuNotFound, l.Sku)
+				}
+				s = repo.ForChannel(skuResponse, l.Channel)
+				stock[l.Sku] = s
+			}
+
+			if warehouses == nil {
+				warehouses, err = a.warehouses()
+				if err != nil {
+					return http.StatusInternalServerError, ErrorCodeWarehouseNotFound, err
+				}
+			}
+
+			byLine[i], err = allocate(l, strategy, s, warehouses)
+			if err != nil {
+				if err.Error() == "409" {
+					return http.StatusConflict, ErrorCodeInsufficientStock, fmt.Errorf(InsufficientAllocation, l.Sku, l.Quantity, l.Strategy)
+				}
+				return http.StatusInternalServerError, ErrorCodeStoringContent, err
+			}
+			if len(b.Components) > 0 {
+				components[i] = componentReservations(b, byLine[i])
+				reservations = append(reservations, components[i]...)
+				continue
+			}
+			reservations = append(reservations, byLine[i]...)
+		}
+
+		err := a.rp.InsertOrder(o, reservations)
+		if err != nil {
+			switch err.Error() {
+			case "412":
+				return http.StatusConflict, ErrorCodeOrderExists, fmt.Errorf(OrderExists, o.Order)
+			case "404", "409":
+				// the stock changed since it was read, allocate again
+				if allocating {
+					continue
+				}
+				if err.Error() == "404" {
+					return http.StatusNotFound, ErrorCodeSkuNotFound, fmt.Errorf(OrderLineNotFound, o.Order)
+				}
+				return http.StatusConflict, ErrorCodeInsufficientStock, fmt.Errorf(OrderInsufficient, o.Order)
+			}
+			return http.StatusInternalServerError, ErrorCodeStoringContent, err
+		}
+
+		for i := range o.Lines {
+			switch {
+			case components[i] != nil:
+				bundled(&o.Lines[i], components[i])
+			case o.Lines[i].Warehouse == "":
+				allocated(&o.Lines[i], byLine[i])
+			}
+		}
+
+		return http.StatusOK, 0, nil
+	}
+
+	return http.StatusConflict, ErrorCodeInsufficientStock, fmt.Errorf(OrderInsufficient, o.Order)
+}
+
+// Validates the consistency of the Order struct
+// Every line is a reservation with the order as reference and the channel and ttl of the order
+func (a *API) validateOrder(o *strut.Order) error {
+	if o.Order == "" {
+		return fmt.Errorf("Order is empty")
+	}
+	if len(o.Order) > 64 {
+		return fmt.Errorf("Order is longer than 64 characters")
+	}
+	if len(o.Lines) == 0 {
+		return fmt.Errorf("Lines are empty")
+	}
+	if len(o.Lines) > MaxOrderLines {
+		return fmt.Errorf("Order has more than %d lines", MaxOrderLines)
+	}
+	if o.Ttl == 0 {
+		o.Ttl = a.cnfg.Reservation.Ttl
+	}
+
+	var expires *time.Time
+	if o.Ttl > 0 {
+		e := time.Now().UTC().Add(time.Duration(o.Ttl) * time.Second)
+		expires = &e
+	}
+
+	for i := range o.Lines {
+		l := &o.Lines[i]
+		l.Id = 0
+		l.Reference, l.Channel, l.Ttl, l.ExpiresAt = o.Order, o.Channel, o.Ttl, expires
+		l.RequestId, l.Caller = o.RequestId, o.Caller
+
+		// a line without quantity holds a single unit, or every serial number it names
+		if l.Quantity == 0 {
+			l.Quantity = 1
+			if len(l.Serials) > 0 {
+				l.Quantity = int64(len(l.Serials))
+			}
+		}
+		if l.Warehouse == "" && l.Strategy == "" {
+			l.Strategy = a.cnfg.Reservation.Strategy
+			if l.Strategy == "" {
+				l.Strategy = alloc.DefaultStrategy
+			}
+		}
+
+		if err := a.validateReservation(l); err != nil {
+			return fmt.Errorf("Line %d: %s", i+1, err.Error())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package api
+
+import (
+	"encoding/json"
+	"github.com/labstack/echo"
+	gen "github.com/pintobikez/stock-service/api/structures"
+	mock "github.com/pintobikez/stock-service/mocks"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+/*
+Tests for the Order methods
+*/
+type orderProviderApi struct {
+	method string
+	value  string
+	json   string
+	result int
+	code   int
+}
+
+var testOrderProviderApi = []orderProviderApi{
+	{"POST", "/reservations", `{"order":"O1"`, http.StatusBadRequest, ErrorCodeWrongJsonFormat},                                                                                   // invalid json
+	{"POST", "/reservations", `{"lines":[{"sku":"SCC","warehouse":"A"}]}`, http.StatusBadRequest, ErrorCodeInvalidContent},                                                        // empty order
+	{"POST", "/reservations", `{"order":"O1"}`, http.StatusBadRequest, ErrorCodeInvalidContent},                                                                                   // empty lines
+	{"POST", "/reservations", `{"order":"O1","lines":[{"warehouse":"A"}]}`, http.StatusBadRequest, ErrorCodeInvalidContent},                                                       // line without sku
+	{"POST", "/reservations", `{"order":"O1","lines":[{"sku":"SCC","warehouse":"A","quantity":-1}]}`, http.StatusBadRequest, ErrorCodeInvalidContent},                             // negative quantity
+	{"POST", "/reservations", `{"order":"O1","ttl":-5,"lines":[{"sku":"SCC","warehouse":"A"}]}`, http.StatusBadRequest, ErrorCodeInvalidContent},                                  // negative ttl
+	{"POST", "/reservations", `{"order":"O1","lines":[{"sku":"SCC","strategy":"nearest"}]}`, http.StatusBadRequest, ErrorCodeInvalidContent},                                      // unknown strategy
+	{"POST", "/reservations", `{"order":"O1","lines":[{"sku":"SCC","warehouse":"A"},{"sku":"SC","warehouse":"A"}]}`, http.StatusInternalServerError, ErrorCodeStoringContent},     // RepoInsertReservations error
+	{"POST", "/reservations", `{"order":"O1","lines":[{"sku":"SCC","warehouse":"A"},{"sku":"SCA","warehouse":"B"}]}`, http.StatusNotFound, ErrorCodeSkuNotFound},                  // Sku and Warehouse of a line not found
+	{"POST", "/reservations", `{"order":"O1","lines":[{"sku":"SCC","warehouse":"A"},{"sku":"SCF","warehouse":"A"}]}`, http.StatusConflict, ErrorCodeInsufficientStock},            // not enough stock for a line
+	{"POST", "/reservations", `{"order":"O1","lines":[{"sku":"SCC"},{"sku":"SCCC"}]}`, http.StatusNotFound, ErrorCodeSkuNotFound},                                                 // allocated Sku not found
+	{"POST", "/reservations", `{"order":"O1","lines":[{"sku":"SCC"},{"sku":"SCF"}]}`, http.StatusConflict, ErrorCodeInsufficientStock},                                            // stock keeps changing while allocating
+	{"POST", "/reservations", `{"order":"O1","lines":[{"sku":"SCM","quantity":4},{"sku":"SCM","quantity":4}]}`, http.StatusConflict, ErrorCodeInsufficientStock},                  // lines of the same sku exhaust its stock
+	{"POST", "/reservations", `{"order":"OX","lines":[{"sku":"SCC","warehouse":"A"}]}`, http.StatusConflict, ErrorCodeOrderExists},                                                // order already holds reservations
+	{"POST", "/reservations", `{"order":"O1","lines":[{"sku":"SCC","warehouse":"A"},{"sku":"SCD","warehouse":"A"}]}`, http.StatusInternalServerError, ErrorCodePublishingMessage}, // Error Publish
+	{"POST", "/reservations", `{"order":"O1","ttl":600,"lines":[{"sku":"SCC","warehouse":"A"},{"sku":"SCM","quantity":5,"strategy":"split"}]}`, http.StatusCreated, 0},            // Insert OK
+	{"DELETE", "/reservations/ERR", "", http.StatusInternalServerError, ErrorCodeStoringContent},                                                                                  // RepoDeleteReservations error
+	{"DELETE", "/reservations/NONE", "", http.StatusNotFound, ErrorCodeReservationNotFound},                                                                                       // order holds no reservation
+	{"DELETE", "/reservations/PUB", "", http.StatusInternalServerError, ErrorCodePublishingMessage},                                                                               // Error Publish
+	{"DELETE", "/reservations/O1", "", http.StatusOK, 0},                                                                                                                          // Delete OK
+}
+
+func TestOrder(t *testing.T) {
+	for _, pair := range testOrderProviderApi {
+		p := new(mock.PublisherMock)
+		r := new(mock.RepositoryMock)
+		a := New(r, p, nil)
+
+		// Setup
+		e := echo.New()
+		e.POST("/reservations", a.PostOrder())
+		e.DELETE("/reservations/:order", a.DeleteOrder())
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(pair.method, pair.value, strings.NewReader(pair.json))
+		req.Header.Set("Content-Type", "application/json")
+		e.ServeHTTP(rec, req)
+
+		assert.Equal(t, pair.result, rec.Code, "Http Code of "+pair.method+" "+pair.value+" "+pair.json+" doesn't match")
+
+		if rec.Code >= http.StatusBadRequest {
+			erm := new(gen.ErrResponse)
+			_ = json.Unmarshal([]byte(rec.Body.String()), erm)
+			assert.Equal(t, pair.code, erm.Error.Code, "ErrorCode doesn't match")
+		}
+	}
+}
+
+/*
+Tests for the allocation of the lines of an Order
+*/
+type orderLinesProviderApi struct {
+	json       string
+	warehouses []string
+	published  []string
+}
+
+var testOrderLinesProviderApi = []orderLinesProviderApi{
+	{`{"order":"O1","lines":[{"sku":"SCC","warehouse":"A"},{"sku":"SCC","warehouse":"A","quantity":2}]}`, []string{"A", "A"}, []string{"SCC"}}, // explicit warehouses, sku published once
+	{`{"order":"O1","lines":[{"sku":"SCM","quantity":4},{"sku":"SCM","quantity":3}]}`, []string{"B", "A"}, []string{"SCM"}},                    // second line allocated out of what the first left
+	{`{"order":"O1","lines":[{"sku":"SCM","quantity":5,"strategy":"split"},{"sku":"SCC"}]}`, []string{"", "A"}, []string{"SCM", "SCC"}},        // split line keeps its allocations
+}
+
+func TestOrderLines(t *testing.T) {
+	for _, pair := range testOrderLinesProviderApi {
+		p := new(mock.PublisherMock)
+		r := new(mock.RepositoryMock)
+		a := New(r, p, nil)
+
+		// Setup
+		e := echo.New()
+		e.POST("/reservations", a.PostOrder())
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/reservations", strings.NewReader(pair.json))
+		req.Header.Set("Content-Type", "application/json")
+		e.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusCreated, rec.Code, "Http Code of "+pair.json+" doesn't match")
+
+		o := new(gen.Order)
+		_ = json.Unmarshal([]byte(rec.Body.String()), o)
+
+		var warehouses []string
+		for _, l := range o.Lines {
+			assert.Equal(t, "O1", l.Reference, "Reference of the line doesn't match")
+			warehouses = append(warehouses, l.Warehouse)
+		}
+		assert.Equal(t, pair.warehouses, warehouses, "Warehouses of "+pair.json+" don't match")
+		assert.Equal(t, pair.published, p.Published, "Published skus of "+pair.json+" don't match")
+	}
+}
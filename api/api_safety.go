@@ -0,0 +1,58 @@
+package api
+
+import (
+	"fmt"
+	"github.com/labstack/echo"
+	strut "github.com/pintobikez/stock-service/api/structures"
+	"net/http"
+)
+
+// Handler to PUT Safety stock request
+// A null safety stock falls back to the one of the warehouse
+func (a *API) PutSafetyStock() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		s := new(strut.SafetyStock)
+
+		if err := c.Bind(s); err != nil {
+			return c.JSON(http.StatusBadRequest, &strut.ErrResponse{strut.ErrContent{ErrorCodeWrongJsonFormat, err.Error()}})
+		}
+		s.Sku = c.Param("sku")
+
+		if err := a.validateSafetyStock(s); err != nil {
+			return c.JSON(http.StatusBadRequest, &strut.ErrResponse{strut.ErrContent{ErrorCodeInvalidContent, err.Error()}})
+		}
+
+		if err := a.rp.UpdateSafetyStock(s); err != nil {
+			if err.Error() == "404" {
+				return c.JSON(http.StatusNotFound, &strut.ErrResponse{strut.ErrContent{ErrorCodeSkuNotFound, fmt.Sprintf(SkuWarehouseNotFound, s.Sku, s.Warehouse)}})
+			}
+			return c.JSON(http.StatusInternalServerError, &strut.ErrResponse{strut.ErrContent{ErrorCodeStoringContent, err.Error()}})
+		}
+
+		// the sellable units changed
+		skuResponse, err := a.rp.FindSku(s.Sku)
+		if err != nil {
+			return c.JSON(http.StatusNotFound, &strut.ErrResponse{strut.ErrContent{ErrorCodeSkuNotFound, fmt.Sprintf(SkuNotFound, s.Sku)}})
+		}
+
+		if err := a.publish(skuResponse); err != nil {
+			return c.JSON(http.StatusInternalServerError, &strut.ErrResponse{strut.ErrContent{ErrorCodePublishingMessage, err.Error()}})
+		}
+
+		return c.JSON(http.StatusOK, skuResponse)
+	}
+}
+
+// Validates the consistency of the SafetyStock struct
+func (a *API) validateSafetyStock(s *strut.SafetyStock) error {
+	if s.Sku == "" {
+		return fmt.Errorf("Sku is empty")
+	}
+	if s.Warehouse == "" {
+		return fmt.Errorf("Warehouse is empty")
+	}
+	if s.SafetyStock != nil && *s.SafetyStock < 0 {
+		return fmt.Errorf("Safety stock is negative")
+	}
+	return a.knownWarehouse(s.Warehouse)
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"encoding/json"
+	"github.com/labstack/echo"
+	gen "github.com/pintobikez/stock-service/api/structures"
+	mock "github.com/pintobikez/stock-service/mocks"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+/*
+Tests for PutSafetyStock method
+*/
+type safetyStockProviderApi struct {
+	value  string
+	json   string
+	result int
+	code   int
+}
+
+var testSafetyStockProviderApi = []safetyStockProviderApi{
+	{"/stock/SCC/safety", `{"warehouse":"A"`, http.StatusBadRequest, ErrorCodeWrongJsonFormat},                              // invalid json
+	{"/stock/SCC/safety", `{"safety_stock":2}`, http.StatusBadRequest, ErrorCodeInvalidContent},                             // empty warehouse
+	{"/stock/SCC/safety", `{"warehouse":"A","safety_stock":-2}`, http.StatusBadRequest, ErrorCodeInvalidContent},            // negative safety stock
+	{"/stock/SCC/safety", `{"warehouse":"X","safety_stock":2}`, http.StatusBadRequest, ErrorCodeInvalidContent},             // unknown warehouse
+	{"/stock/SAC/safety", `{"warehouse":"A","safety_stock":2}`, http.StatusInternalServerError, ErrorCodeStoringContent},    // RepoUpdateSafetyStock error
+	{"/stock/SCA/safety", `{"warehouse":"A","safety_stock":2}`, http.StatusNotFound, ErrorCodeSkuNotFound},                  // Sku not stored in the warehouse
+	{"/stock/SCCC/safety", `{"warehouse":"A","safety_stock":2}`, http.StatusNotFound, ErrorCodeSkuNotFound},                 // RepoFindSku error
+	{"/stock/SCD/safety", `{"warehouse":"A","safety_stock":2}`, http.StatusInternalServerError, ErrorCodePublishingMessage}, // Error Publish
+	{"/stock/SCC/safety", `{"warehouse":"A","safety_stock":2}`, http.StatusOK, 0},                                           // Update OK
+	{"/stock/SCC/safety", `{"warehouse":"A","safety_stock":null}`, http.StatusOK, 0},                                        // falls back to the warehouse OK
+}
+
+func TestPutSafetyStock(t *testing.T) {
+	for _, pair := range testSafetyStockProviderApi {
+		p := new(mock.PublisherMock)
+		r := new(mock.RepositoryMock)
+		a := New(r, p, nil)
+
+		// Setup
+		e := echo.New()
+		e.PUT("/stock/:sku/safety", a.PutSafetyStock())
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("PUT", pair.value, strings.NewReader(pair.json))
+		req.Header.Set("Content-Type", "application/json")
+		e.ServeHTTP(rec, req)
+
+		assert.Equal(t, pair.result, rec.Code, "Http Code of "+pair.value+" doesn't match")
+
+		if rec.Code >= http.StatusBadRequest {
+			erm := new(gen.ErrResponse)
+			_ = json.Unmarshal([]byte(rec.Body.String()), erm)
+			assert.Equal(t, pair.code, erm.Error.Code, "ErrorCode doesn't match")
+			continue
+		}
+
+		// the stock of the sku is published once
+		assert.Equal(t, []string{"SCC"}, p.Published, "Published skus don't match")
+	}
+}
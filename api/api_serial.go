@@ -0,0 +1,143 @@
+package api
+
+import (
+	"fmt"
+	"github.com/labstack/echo"
+	strut "github.com/pintobikez/stock-service/api/structures"
+	"net/http"
+)
+
+const (
+	MaxSerials = 500
+)
+
+// Handler to GET Serials request
+func (a *API) GetSerials() echo.HandlerFunc {
+	return func(c echo.Context) error {
+
+		serials, err := a.rp.FindSerials(c.Param("sku"), c.QueryParam("warehouse"))
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, &strut.ErrResponse{strut.ErrContent{ErrorCodeSkuNotFound, err.Error()}})
+		}
+
+		return c.JSON(http.StatusOK, serials)
+	}
+}
+
+// Handler to POST Serials request
+// Each registered serial number adds a unit to the stock of the sku in the warehouse
+func (a *API) PostSerials() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		s := new(strut.SerialRegistration)
+
+		if err := c.Bind(s); err != nil {
+			return c.JSON(http.StatusBadRequest, &strut.ErrResponse{strut.ErrContent{ErrorCodeWrongJsonFormat, err.Error()}})
+		}
+		s.Sku = c.Param("sku")
+		s.RequestId, s.Caller = origin(c)
+
+		if err := a.validateSerialRegistration(s); err != nil {
+			return c.JSON(http.StatusBadRequest, &strut.ErrResponse{strut.ErrContent{ErrorCodeInvalidContent, err.Error()}})
+		}
+
+		if err := a.rp.InsertSerials(s); err != nil {
+			if err.Error() == "409" {
+				return c.JSON(http.StatusConflict, &strut.ErrResponse{strut.ErrContent{ErrorCodeSerialExists, fmt.Sprintf(SerialExists, s.Sku)}})
+			}
+			return c.JSON(http.StatusInternalServerError, &strut.ErrResponse{strut.ErrContent{ErrorCodeStoringContent, err.Error()}})
+		}
+
+		if err := a.publishSkus([]string{s.Sku}); err != nil {
+			return c.JSON(http.StatusInternalServerError, &strut.ErrResponse{strut.ErrContent{ErrorCodePublishingMessage, err.Error()}})
+		}
+
+		return c.JSON(http.StatusCreated, s)
+	}
+}
+
+// Handler to DELETE Serial request
+// The unit of the serial number leaves the stock, unless a reservation holds it
+func (a *API) DeleteSerial() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		s := &strut.Serial{Sku: c.Param("sku"), Serial: c.Param("serial")}
+		s.RequestId, s.Caller = origin(c)
+
+		if err := a.rp.DeleteSerial(s); err != nil {
+			switch err.Error() {
+			case "404":
+				return c.JSON(http.StatusNotFound, &strut.ErrResponse{strut.ErrContent{ErrorCodeSerialNotFound, fmt.Sprintf(SerialNotFound, s.Serial, s.Sku)}})
+			case "409":
+				return c.JSON(http.StatusConflict, &strut.ErrResponse{strut.ErrContent{ErrorCodeSerialInUse, fmt.Sprintf(SerialInUse, s.Serial, s.Sku)}})
+			}
+			return c.JSON(http.StatusInternalServerError, &strut.ErrResponse{strut.ErrContent{ErrorCodeStoringContent, err.Error()}})
+		}
+
+		if err := a.publishSkus([]string{s.Sku}); err != nil {
+			return c.JSON(http.StatusInternalServerError, &strut.ErrResponse{strut.ErrContent{ErrorCodePublishingMessage, err.Error()}})
+		}
+
+		return c.NoContent(http.StatusOK)
+	}
+}
+
+// Validates the consistency of the SerialRegistration struct, only a serialized sku registers serial numbers
+func (a *API) validateSerialRegistration(s *strut.SerialRegistration) error {
+	if s.Sku == "" {
+		return fmt.Errorf("Sku is empty")
+	}
+	if s.Warehouse == "" {
+		return fmt.Errorf("Warehouse is empty")
+	}
+	if len(s.Serials) == 0 {
+		return fmt.Errorf("Serials are empty")
+	}
+	if len(s.Serials) > MaxSerials {
+		return fmt.Errorf("Serials are more than %d", MaxSerials)
+	}
+	if err := validateSerials(s.Serials); err != nil {
+		return err
+	}
+
+	st, err := a.rp.FindSkuSettings(s.Sku)
+	if err != nil {
+		return err
+	}
+	if !st.Serialized {
+		return fmt.Errorf("Sku %s is not tracked by serial number", s.Sku)
+	}
+	if err := a.notBundle(s.Sku); err != nil {
+		return err
+	}
+	return a.knownWarehouse(s.Warehouse)
+}
+
+// Validates a list of serial numbers
+func validateSerials(serials []string) error {
+	seen := make(map[string]bool)
+	for _, serial := range serials {
+		if serial == "" {
+			return fmt.Errorf("Serial is empty")
+		}
+		if len(serial) > 64 {
+			return fmt.Errorf("Serial %s is longer than 64 characters", serial)
+		}
+		if seen[serial] {
+			return fmt.Errorf("Serial %s is repeated", serial)
+		}
+		seen[serial] = true
+	}
+	return nil
+}
+
+// Validates the quantity of a sku is not derived from its serial numbers, which only registering and
+// shipping them changes
+func (a *API) notSerialized(sku string) error {
+	st, err := a.rp.FindSkuSettings(sku)
+	if err != nil {
+		return repoError{err}
+	}
+	if st.Serialized {
+		return fmt.Errorf(SerialTracked, sku)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"encoding/json"
+	"github.com/labstack/echo"
+	gen "github.com/pintobikez/stock-service/api/structures"
+	mock "github.com/pintobikez/stock-service/mocks"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+/*
+Tests for the Serial methods
+*/
+type serialProviderApi struct {
+	method string
+	value  string
+	json   string
+	result int
+	code   int
+}
+
+var testSerialProviderApi = []serialProviderApi{
+	{"GET", "/stock/SAC/serials", "", http.StatusInternalServerError, ErrorCodeSkuNotFound},                                         // RepoFindSerials error
+	{"GET", "/stock/SSN/serials", "", http.StatusOK, 0},                                                                             // serials found
+	{"POST", "/stock/SSN/serials", `{"warehouse":"A"`, http.StatusBadRequest, ErrorCodeWrongJsonFormat},                             // invalid json
+	{"POST", "/stock/SSN/serials", `{"serials":["SN4"]}`, http.StatusBadRequest, ErrorCodeInvalidContent},                           // empty warehouse
+	{"POST", "/stock/SSN/serials", `{"warehouse":"A","serials":[]}`, http.StatusBadRequest, ErrorCodeInvalidContent},                // empty serials
+	{"POST", "/stock/SSN/serials", `{"warehouse":"A","serials":["SN4",""]}`, http.StatusBadRequest, ErrorCodeInvalidContent},        // empty serial
+	{"POST", "/stock/SSN/serials", `{"warehouse":"A","serials":["SN4","SN4"]}`, http.StatusBadRequest, ErrorCodeInvalidContent},     // repeated serial
+	{"POST", "/stock/SSN/serials", `{"warehouse":"X","serials":["SN4"]}`, http.StatusBadRequest, ErrorCodeInvalidContent},           // unknown warehouse
+	{"POST", "/stock/SSE/serials", `{"warehouse":"A","serials":["SN4"]}`, http.StatusBadRequest, ErrorCodeInvalidContent},           // RepoFindSkuSettings error
+	{"POST", "/stock/SCC/serials", `{"warehouse":"A","serials":["SN4"]}`, http.StatusBadRequest, ErrorCodeInvalidContent},           // sku not serialized
+	{"POST", "/stock/SSNE/serials", `{"warehouse":"A","serials":["SN4"]}`, http.StatusInternalServerError, ErrorCodeStoringContent}, // RepoInsertSerials error
+	{"POST", "/stock/SSNC/serials", `{"warehouse":"A","serials":["SN4"]}`, http.StatusConflict, ErrorCodeSerialExists},              // serial already registered
+	{"POST", "/stock/SSN/serials", `{"warehouse":"A","serials":["SN4","SN5"]}`, http.StatusCreated, 0},                              // Register OK
+	{"DELETE", "/stock/SSN/serials/ERR", "", http.StatusInternalServerError, ErrorCodeStoringContent},                               // RepoDeleteSerial error
+	{"DELETE", "/stock/SSN/serials/NONE", "", http.StatusNotFound, ErrorCodeSerialNotFound},                                         // serial not found
+	{"DELETE", "/stock/SSN/serials/HELD", "", http.StatusConflict, ErrorCodeSerialInUse},                                            // serial held by a reservation
+	{"DELETE", "/stock/SCCC/serials/SN1", "", http.StatusInternalServerError, ErrorCodePublishingMessage},                           // RepoFindSku error
+	{"DELETE", "/stock/SSN/serials/SN2", "", http.StatusOK, 0},                                                                      // Remove OK
+}
+
+func TestSerial(t *testing.T) {
+	for _, pair := range testSerialProviderApi {
+		p := new(mock.PublisherMock)
+		r := new(mock.RepositoryMock)
+		a := New(r, p, nil)
+
+		// Setup
+		e := echo.New()
+		e.GET("/stock/:sku/serials", a.GetSerials())
+		e.POST("/stock/:sku/serials", a.PostSerials())
+		e.DELETE("/stock/:sku/serials/:serial", a.DeleteSerial())
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(pair.method, pair.value, strings.NewReader(pair.json))
+		req.Header.Set("Content-Type", "application/json")
+		e.ServeHTTP(rec, req)
+
+		assert.Equal(t, pair.result, rec.Code, "Http Code of "+pair.method+" "+pair.value+" "+pair.json+" doesn't match")
+
+		if rec.Code >= http.StatusBadRequest {
+			erm := new(gen.ErrResponse)
+			_ = json.Unmarshal([]byte(rec.Body.String()), erm)
+			assert.Equal(t, pair.code, erm.Error.Code, "ErrorCode doesn't match")
+		}
+	}
+}
+
+/*
+Tests for the serials of a warehouse
+*/
+func TestGetSerialsWarehouse(t *testing.T) {
+	p := new(mock.PublisherMock)
+	r := new(mock.RepositoryMock)
+	a := New(r, p, nil)
+
+	// Setup
+	e := echo.New()
+	e.GET("/stock/:sku/serials", a.GetSerials())
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/stock/SSN/serials?warehouse=A", nil)
+	e.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code, "Http Code doesn't match")
+
+	var serials []gen.Serial
+	_ = json.Unmarshal([]byte(rec.Body.String()), &serials)
+	assert.Equal(t, 2, len(serials), "Serials of the warehouse don't match")
+	assert.Equal(t, int64(6), serials[0].ReservationId, "Reservation of the serial doesn't match")
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"fmt"
+	"github.com/labstack/echo"
+	strut "github.com/pintobikez/stock-service/api/structures"
+	"net/http"
+)
+
+// Handler to GET Sku settings request
+func (a *API) GetSkuSettings() echo.HandlerFunc {
+	return func(c echo.Context) error {
+
+		s, err := a.rp.FindSkuSettings(c.Param("sku"))
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, &strut.ErrResponse{strut.ErrContent{ErrorCodeSkuNotFound, err.Error()}})
+		}
+
+		return c.JSON(http.StatusOK, s)
+	}
+}
+
+// Handler to PUT Sku settings request
+// The settings left out of the request keep their stored values
+func (a *API) PutSkuSettings() echo.HandlerFunc {
+	return func(c echo.Context) error {
+
+		s, err := a.rp.FindSkuSettings(c.Param("sku"))
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, &strut.ErrResponse{strut.ErrContent{ErrorCodeSkuNotFound, err.Error()}})
+		}
+
+		if err := c.Bind(s); err != nil {
+			return c.JSON(http.StatusBadRequest, &strut.ErrResponse{strut.ErrContent{ErrorCodeWrongJsonFormat, err.Error()}})
+		}
+		s.Sku = c.Param("sku")
+
+		if err := validateSkuSettings(s); err != nil {
+			return c.JSON(http.StatusBadRequest, &strut.ErrResponse{strut.ErrContent{ErrorCodeInvalidContent, err.Error()}})
+		}
+
+		if err := a.rp.UpdateSkuSettings(s); err != nil {
+			if err.Error() == "409" {
+				return c.JSON(http.StatusConflict, &strut.ErrResponse{strut.ErrContent{ErrorCodeSkuInUse, fmt.Sprintf(SkuInUse, s.Sku)}})
+			}
+			return c.JSON(http.StatusInternalServerError, &strut.ErrResponse{strut.ErrContent{ErrorCodeStoringContent, err.Error()}})
+		}
+
+		return c.JSON(http.StatusOK, s)
+	}
+}
+
+// Validates the consistency of the SkuSettings struct
+// Without a backorder policy the sku can not be backordered
+func validateSkuSettings(s *strut.SkuSettings) error {
+	if s.Sku == "" {
+		return fmt.Errorf("Sku is empty")
+	}
+	if s.Backorder == "" {
+		s.Backorder = strut.BackorderDisallowed
+	}
+	switch s.Backorder {
+	case strut.BackorderDisallowed, strut.BackorderUnlimited, strut.BackorderCapped:
+	default:
+		return fmt.Errorf("Backorder %s is not one of disallowed, unlimited or capped", s.Backorder)
+	}
+	if s.BackorderLimit < 0 {
+		return fmt.Errorf("Backorder limit is negative")
+	}
+	// only a capped sku keeps a limit
+	if s.Backorder != strut.BackorderCapped {
+		s.BackorderLimit = 0
+	}
+	return nil
+}
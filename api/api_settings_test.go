@@ -0,0 +1,81 @@
+package api
+
+import (
+	"encoding/json"
+	"github.com/labstack/echo"
+	gen "github.com/pintobikez/stock-service/api/structures"
+	mock "github.com/pintobikez/stock-service/mocks"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+/*
+Tests for the Sku settings methods
+*/
+type skuSettingsProviderApi struct {
+	method     string
+	value      string
+	json       string
+	result     int
+	code       int
+	preorder   bool
+	backorder  string
+	limit      int64
+	serialized bool
+}
+
+var testSkuSettingsProviderApi = []skuSettingsProviderApi{
+	{"GET", "/skus/SSE", "", http.StatusInternalServerError, ErrorCodeSkuNotFound, false, "", 0, false},                                      // RepoFindSkuSettings error
+	{"GET", "/skus/SCC", "", http.StatusOK, 0, false, gen.BackorderDisallowed, 0, false},                                                     // default settings
+	{"GET", "/skus/SCP", "", http.StatusOK, 0, true, gen.BackorderDisallowed, 0, false},                                                      // pre-orderable sku
+	{"GET", "/skus/SBO", "", http.StatusOK, 0, false, gen.BackorderCapped, 5, false},                                                         // backorderable sku
+	{"PUT", "/skus/SCC", `{"preorder":"yes"}`, http.StatusBadRequest, ErrorCodeWrongJsonFormat, false, "", 0, false},                         // invalid json
+	{"PUT", "/skus/SCC", `{"backorder":"always"}`, http.StatusBadRequest, ErrorCodeInvalidContent, false, "", 0, false},                      // unknown backorder policy
+	{"PUT", "/skus/SCC", `{"backorder":"capped","backorder_limit":-1}`, http.StatusBadRequest, ErrorCodeInvalidContent, false, "", 0, false}, // negative backorder limit
+	{"PUT", "/skus/SAC", `{"preorder":true}`, http.StatusInternalServerError, ErrorCodeStoringContent, false, "", 0, false},                  // RepoUpdateSkuSettings error
+	{"PUT", "/skus/SCC", `{"preorder":true}`, http.StatusOK, 0, true, gen.BackorderDisallowed, 0, false},                                     // Update OK
+	{"PUT", "/skus/SCC", `{"backorder":"capped","backorder_limit":5}`, http.StatusOK, 0, false, gen.BackorderCapped, 5, false},               // capped backorders
+	{"PUT", "/skus/SSE", `{"preorder":true}`, http.StatusInternalServerError, ErrorCodeSkuNotFound, false, "", 0, false},                     // RepoFindSkuSettings error on update
+	{"PUT", "/skus/SCC", `{"serialized":true}`, http.StatusConflict, ErrorCodeSkuInUse, false, "", 0, false},                                 // made serialized while holding stock
+	{"PUT", "/skus/SSN", `{"serialized":false}`, http.StatusConflict, ErrorCodeSkuInUse, false, "", 0, false},                                // no longer serialized while holding serials
+	{"PUT", "/skus/SNW", `{"serialized":true}`, http.StatusOK, 0, false, gen.BackorderDisallowed, 0, true},                                   // made serialized without stock
+	{"PUT", "/skus/SSN", `{"preorder":true}`, http.StatusOK, 0, true, gen.BackorderDisallowed, 0, true},                                      // serialized kept when left out
+	{"PUT", "/skus/SBO", `{"preorder":true}`, http.StatusOK, 0, true, gen.BackorderCapped, 5, false},                                         // backorder policy kept when left out
+	{"PUT", "/skus/SCC", `{"backorder":"unlimited","backorder_limit":5}`, http.StatusOK, 0, false, gen.BackorderUnlimited, 0, false},         // limit of another policy dropped
+}
+
+func TestSkuSettings(t *testing.T) {
+	for _, pair := range testSkuSettingsProviderApi {
+		p := new(mock.PublisherMock)
+		r := new(mock.RepositoryMock)
+		a := New(r, p, nil)
+
+		// Setup
+		e := echo.New()
+		e.GET("/skus/:sku", a.GetSkuSettings())
+		e.PUT("/skus/:sku", a.PutSkuSettings())
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(pair.method, pair.value, strings.NewReader(pair.json))
+		req.Header.Set("Content-Type", "application/json")
+		e.ServeHTTP(rec, req)
+
+		assert.Equal(t, pair.result, rec.Code, "Http Code of "+pair.method+" "+pair.value+" doesn't match")
+
+		if rec.Code >= http.StatusBadRequest {
+			erm := new(gen.ErrResponse)
+			_ = json.Unmarshal([]byte(rec.Body.String()), erm)
+			assert.Equal(t, pair.code, erm.Error.Code, "ErrorCode doesn't match")
+		} else {
+			val := new(gen.SkuSettings)
+			_ = json.Unmarshal([]byte(rec.Body.String()), val)
+			assert.Equal(t, pair.preorder, val.Preorder, "Preorder doesn't match")
+			assert.Equal(t, pair.backorder, val.Backorder, "Backorder doesn't match")
+			assert.Equal(t, pair.limit, val.BackorderLimit, "Backorder limit doesn't match")
+			assert.Equal(t, pair.serialized, val.Serialized, "Serialized doesn't match")
+		}
+	}
+}
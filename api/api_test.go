@@ -5,12 +5,14 @@ import (
 	"fmt"
 	"github.com/labstack/echo"
 	gen "github.com/pintobikez/stock-service/api/structures"
+	cnfs "github.com/pintobikez/stock-service/config/structures"
 	mock "github.com/pintobikez/stock-service/mocks"
 	"github.com/stretchr/testify/assert"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 )
 
 /*
@@ -25,27 +27,59 @@ type reservationProviderApi struct {
 }
 
 var testReservationProviderApi = []reservationProviderApi{
-	{"PUT", "/reservation/", "", http.StatusNotFound, 0},                                                         // url not found
-	{"PUT", "/reservation/SAC", `{}`, http.StatusBadRequest, ErrorCodeInvalidContent},                            // invalid Reservation object
-	{"PUT", "/reservation/SAC", `{"warehouse":"A"}`, http.StatusInternalServerError, ErrorCodeSkuNotFound},       // RepoFindBySkuAndWharehouse error
-	{"PUT", "/reservation/SC", `{"warehouse":"C"}`, http.StatusInternalServerError, ErrorCodeStoringContent},     // RepoInsertReservation error
-	{"PUT", "/reservation/SCA", `{"warehouse":"B"}`, http.StatusNotFound, ErrorCodeSkuNotFound},                  // Sku and Warehouse not found
-	{"PUT", "/reservation/SCD", `{"warehouse":"A"}`, http.StatusInternalServerError, ErrorCodePublishingMessage}, // Error Publish
-	{"PUT", "/reservation/SCC", `{"warehouse":"A"}`, http.StatusOK, 0},                                           // Insert OK
-	{"DELETE", "/reservation/", "", http.StatusNotFound, 0},                                                      // url not found
-	{"DELETE", "/reservation/SAC", `{}`, http.StatusBadRequest, ErrorCodeInvalidContent},                         // invalid Reservation object
-	{"DELETE", "/reservation/SAC", `{"warehouse":"C"}`, http.StatusInternalServerError, ErrorCodeSkuNotFound},    // RepoDeleteReservation error
-	{"DELETE", "/reservation/SC", `{"warehouse":"C"}`, http.StatusInternalServerError, ErrorCodeStoringContent},  // RepoDeleteReservation error 404
-	{"DELETE", "/reservation/SCE", `{"warehouse":"D"}`, http.StatusNotFound, ErrorCodeSkuNotFound},               // RepoDeleteReservation error
-	{"DELETE", "/reservation/DDD", `{"warehouse":"D"}`, http.StatusNotFound, ErrorCodeSkuNotFound},               // Sku and Warehouse not found
-	{"DELETE", "/reservation/SCC", `{"warehouse":"A"}`, http.StatusOK, 0},                                        // Insert OK
+	{"PUT", "/reservation/", "", http.StatusNotFound, 0},                                                                            // url not found
+	{"PUT", "/reservation/SAC", `{"ttl":-1}`, http.StatusBadRequest, ErrorCodeInvalidContent},                                       // invalid Reservation object
+	{"PUT", "/reservation/SC", `{"warehouse":"C"}`, http.StatusInternalServerError, ErrorCodeStoringContent},                        // RepoInsertReservation error
+	{"PUT", "/reservation/SCA", `{"warehouse":"B"}`, http.StatusNotFound, ErrorCodeSkuNotFound},                                     // Sku and Warehouse not found
+	{"PUT", "/reservation/SCF", `{"warehouse":"A", "quantity":5}`, http.StatusConflict, ErrorCodeInsufficientStock},                 // not enough stock available
+	{"PUT", "/reservation/SCD", `{"warehouse":"A"}`, http.StatusInternalServerError, ErrorCodePublishingMessage},                    // Error Publish
+	{"PUT", "/reservation/SCC", `{"warehouse":"A", "quantity":-2}`, http.StatusBadRequest, ErrorCodeInvalidContent},                 // negative quantity
+	{"PUT", "/reservation/SCC", `{"warehouse":"I"}`, http.StatusBadRequest, ErrorCodeInvalidContent},                                // inactive warehouse
+	{"PUT", "/reservation/SCC", `{"warehouse":"A"}`, http.StatusOK, 0},                                                              // Insert OK
+	{"PUT", "/reservation/SCC", `{"warehouse":"A", "quantity":50}`, http.StatusOK, 0},                                               // Insert several units OK
+	{"PUT", "/reservation/SCC", `{"warehouse":"A", "ttl":-10}`, http.StatusBadRequest, ErrorCodeInvalidContent},                     // negative ttl
+	{"PUT", "/reservation/SCC", `{"warehouse":"A", "ttl":600}`, http.StatusOK, 0},                                                   // Insert expiring OK
+	{"PUT", "/reservation/SCC", `{"strategy":"nearest"}`, http.StatusBadRequest, ErrorCodeInvalidContent},                           // unknown strategy
+	{"PUT", "/reservation/SCA", `{}`, http.StatusNotFound, ErrorCodeSkuNotFound},                                                    // allocated Sku not found
+	{"PUT", "/reservation/SC", `{}`, http.StatusInternalServerError, ErrorCodeStoringContent},                                       // RepoInsertReservations error
+	{"PUT", "/reservation/SCF", `{}`, http.StatusConflict, ErrorCodeInsufficientStock},                                              // stock keeps changing while allocating
+	{"PUT", "/reservation/SCM", `{"quantity":5}`, http.StatusConflict, ErrorCodeInsufficientStock},                                  // no warehouse holds every unit
+	{"PUT", "/reservation/SCM", `{"quantity":5, "strategy":"split"}`, http.StatusOK, 0},                                             // Insert allocated OK
+	{"PUT", "/reservation/SSN", `{"serials":["SN1"]}`, http.StatusBadRequest, ErrorCodeInvalidContent},                              // serials without warehouse
+	{"PUT", "/reservation/SSN", `{"warehouse":"A","quantity":2,"serials":["SN1"]}`, http.StatusBadRequest, ErrorCodeInvalidContent}, // quantity of other serials
+	{"PUT", "/reservation/SSN", `{"warehouse":"A","serials":["SN1","SN1"]}`, http.StatusBadRequest, ErrorCodeInvalidContent},        // repeated serial
+	{"PUT", "/reservation/SCF", `{"warehouse":"A","serials":["SN1"]}`, http.StatusConflict, ErrorCodeInsufficientStock},             // serials not free
+	{"PUT", "/reservation/SSN", `{"warehouse":"A","serials":["SN1","SN2"]}`, http.StatusOK, 0},                                      // Insert serials OK
+	{"DELETE", "/reservation/", "", http.StatusNotFound, 0},                                                                         // url not found
+	{"DELETE", "/reservation/ABC", "", http.StatusBadRequest, ErrorCodeInvalidContent},                                              // invalid Reservation id
+	{"DELETE", "/reservation/1", "", http.StatusInternalServerError, ErrorCodeReservationNotFound},                                  // RepoFindReservation error
+	{"DELETE", "/reservation/2", "", http.StatusNotFound, ErrorCodeReservationNotFound},                                             // Reservation not found
+	{"DELETE", "/reservation/6", `{"quantity":-1}`, http.StatusBadRequest, ErrorCodeInvalidContent},                                 // negative quantity
+	{"DELETE", "/reservation/3", "", http.StatusInternalServerError, ErrorCodeStoringContent},                                       // RepoDeleteReservation error
+	{"DELETE", "/reservation/4", "", http.StatusNotFound, ErrorCodeReservationNotFound},                                             // RepoDeleteReservation error 404
+	{"DELETE", "/reservation/5", "", http.StatusInternalServerError, ErrorCodePublishingMessage},                                    // Error Publish
+	{"DELETE", "/reservation/6", "", http.StatusOK, 0},                                                                              // Delete OK
+	{"DELETE", "/reservation/6", `{"quantity":5}`, http.StatusOK, 0},                                                                // Delete several units OK
+	{"POST", "/reservation/ABC/commit", "", http.StatusBadRequest, ErrorCodeInvalidContent},                                         // invalid Reservation id
+	{"POST", "/reservation/1/commit", "", http.StatusInternalServerError, ErrorCodeReservationNotFound},                             // RepoFindReservation error
+	{"POST", "/reservation/2/commit", "", http.StatusNotFound, ErrorCodeReservationNotFound},                                        // Reservation not found
+	{"POST", "/reservation/6/commit", `{"quantity":-1}`, http.StatusBadRequest, ErrorCodeInvalidContent},                            // negative quantity
+	{"POST", "/reservation/3/commit", "", http.StatusInternalServerError, ErrorCodeStoringContent},                                  // RepoCommitReservation error
+	{"POST", "/reservation/4/commit", "", http.StatusNotFound, ErrorCodeReservationNotFound},                                        // RepoCommitReservation error 404
+	{"POST", "/reservation/5/commit", "", http.StatusInternalServerError, ErrorCodePublishingMessage},                               // Error Publish
+	{"POST", "/reservation/7/commit", "", http.StatusConflict, ErrorCodeInsufficientStock},                                          // pre-order not received yet
+	{"POST", "/reservation/6/commit", "", http.StatusOK, 0},                                                                         // Commit OK
+	{"POST", "/reservation/6/commit", `{"quantity":5}`, http.StatusOK, 0},                                                           // Commit several units OK
+	{"POST", "/reservation/6/commit", `{"quantity":1,"serials":["SN1","SN2"]}`, http.StatusBadRequest, ErrorCodeInvalidContent},     // quantity of other serials
+	{"POST", "/reservation/4/commit", `{"serials":["SN1"]}`, http.StatusNotFound, ErrorCodeReservationNotFound},                     // serials not held
+	{"POST", "/reservation/6/commit", `{"serials":["SN1"]}`, http.StatusOK, 0},                                                      // Commit serials OK
 }
 
 func TestPutDeleteReservation(t *testing.T) {
 	for _, pair := range testReservationProviderApi {
 		p := new(mock.PublisherMock)
 		r := new(mock.RepositoryMock)
-		a := New(r, p)
+		a := New(r, p, new(cnfs.ServiceConfig))
 
 		// Setup
 		e := echo.New()
@@ -53,7 +87,11 @@ func TestPutDeleteReservation(t *testing.T) {
 			e.PUT("/reservation/:sku", a.PutReservation())
 		}
 		if pair.method == "DELETE" {
-			e.DELETE("/reservation/:sku", a.RemoveReservation())
+			e.DELETE("/reservation/:id", a.RemoveReservation())
+		}
+		if pair.method == "POST" {
+			e.PUT("/reservation/:sku", a.PutReservation())
+			e.POST("/reservation/:id/commit", a.CommitReservation())
 		}
 
 		rec := httptest.NewRecorder()
@@ -71,25 +109,120 @@ func TestPutDeleteReservation(t *testing.T) {
 	}
 }
 
+/*
+Tests for the allocation of a Reservation without warehouse
+*/
+type allocationProviderApi struct {
+	sku         string
+	json        string
+	strategy    string
+	id          int64
+	warehouse   string
+	allocations []gen.Allocation
+}
+
+var testAllocationProviderApi = []allocationProviderApi{
+	{"SCM", `{"quantity":2}`, "", 1, "A", []gen.Allocation{{Id: 1, Warehouse: "A", Quantity: 2}}},                                                                           // configured strategy
+	{"SCM", `{"quantity":2, "strategy":"most_available"}`, "", 1, "B", []gen.Allocation{{Id: 1, Warehouse: "B", Quantity: 2}}},                                              // strategy of the request
+	{"SCM", `{"quantity":5}`, "split", 0, "", []gen.Allocation{{Id: 1, Warehouse: "A", Quantity: 3}, {Id: 2, Warehouse: "B", Quantity: 2}}},                                 // split across warehouses
+	{"SCM", `{"quantity":5, "strategy":"priority", "warehouse":"B"}`, "", 1, "B", nil},                                                                                      // warehouse given, no allocation
+	{"SCH", `{"quantity":4, "strategy":"split"}`, "", 1, "A", []gen.Allocation{{Id: 1, Warehouse: "A", Quantity: 4}}},                                                       // shared units
+	{"SCH", `{"quantity":4, "strategy":"split", "channel":"web"}`, "", 0, "", []gen.Allocation{{Id: 1, Warehouse: "A", Quantity: 3}, {Id: 2, Warehouse: "B", Quantity: 1}}}, // units of the channel
+}
+
+func TestPutReservationAllocation(t *testing.T) {
+	for _, pair := range testAllocationProviderApi {
+		p := new(mock.PublisherMock)
+		r := new(mock.RepositoryMock)
+		a := New(r, p, &cnfs.ServiceConfig{Reservation: cnfs.ReservationConfig{Strategy: pair.strategy}})
+
+		// Setup
+		e := echo.New()
+		e.PUT("/reservation/:sku", a.PutReservation())
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("PUT", "/reservation/"+pair.sku, strings.NewReader(pair.json))
+		req.Header.Set("Content-Type", "application/json")
+		e.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code, "Http Code doesn't match")
+
+		res := new(gen.Reservation)
+		_ = json.Unmarshal([]byte(rec.Body.String()), res)
+		assert.Equal(t, pair.id, res.Id, "Reservation id doesn't match")
+		assert.Equal(t, pair.warehouse, res.Warehouse, "Warehouse doesn't match")
+		assert.Equal(t, pair.allocations, res.Allocations, "Allocations don't match")
+	}
+}
+
+/*
+Tests for GetReservation method
+*/
+type getReservationProviderApi struct {
+	value  string
+	result int
+	code   int
+}
+
+var testGetReservationProviderApi = []getReservationProviderApi{
+	{"/reservation/", http.StatusNotFound, 0},                                        // url not found
+	{"/reservation/ABC", http.StatusBadRequest, ErrorCodeInvalidContent},             // invalid Reservation id
+	{"/reservation/1", http.StatusInternalServerError, ErrorCodeReservationNotFound}, // RepoFindReservation error
+	{"/reservation/2", http.StatusNotFound, ErrorCodeReservationNotFound},            // Reservation not found
+	{"/reservation/6", http.StatusOK, 0},                                             // Reservation found
+}
+
+func TestGetReservation(t *testing.T) {
+	for _, pair := range testGetReservationProviderApi {
+		p := new(mock.PublisherMock)
+		r := new(mock.RepositoryMock)
+		a := New(r, p, new(cnfs.ServiceConfig))
+
+		// Setup
+		e := echo.New()
+		e.GET("/reservation/:id", a.GetReservation())
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", pair.value, strings.NewReader(""))
+		req.Header.Set("Content-Type", "application/json")
+		e.ServeHTTP(rec, req)
+
+		assert.Equal(t, rec.Code, pair.result, "Http Code doesn't match")
+
+		if pair.result != http.StatusOK {
+			erm := new(gen.ErrResponse)
+			_ = json.Unmarshal([]byte(rec.Body.String()), erm)
+			assert.Equal(t, pair.code, erm.Error.Code, "ErrorCode doesn't match")
+		} else {
+			res := new(gen.Reservation)
+			_ = json.Unmarshal([]byte(rec.Body.String()), res)
+			assert.Equal(t, int64(6), res.Id, "Reservation id doesn't match")
+		}
+	}
+}
+
 /*
 Tests for GetStock method
 */
 type getStockProviderApi struct {
 	value  string
 	result int
+	etag   string
 }
 
 var testGetStockProviderApi = []getStockProviderApi{
-	{"/stock/", http.StatusNotFound},    // url not found
-	{"/stock/SCA", http.StatusNotFound}, // sku not found
-	{"/stock/SC", http.StatusOK},        // sku found
+	{"/stock/", http.StatusNotFound, ""},            // url not found
+	{"/stock/SCA", http.StatusNotFound, ""},         // sku not found
+	{"/stock/SC", http.StatusOK, ""},                // sku found
+	{"/stock/SC?warehouse=B", http.StatusOK, ""},    // sku found, not in the warehouse
+	{"/stock/SC?warehouse=A", http.StatusOK, `"3"`}, // sku found with the warehouse version
 }
 
 func TestGetStock(t *testing.T) {
 	for _, pair := range testGetStockProviderApi {
 		p := new(mock.PublisherMock)
 		r := new(mock.RepositoryMock)
-		a := New(r, p)
+		a := New(r, p, new(cnfs.ServiceConfig))
 
 		// Setup
 		e := echo.New()
@@ -100,6 +233,160 @@ func TestGetStock(t *testing.T) {
 		req.Header.Set("Content-Type", "application/json")
 		e.ServeHTTP(rec, req)
 		assert.Equal(t, rec.Code, pair.result, "Http Code doesn't match")
+		assert.Equal(t, pair.etag, rec.Header().Get("ETag"), "ETag doesn't match")
+	}
+}
+
+/*
+Tests for QueryStock method
+*/
+type queryStockProviderApi struct {
+	json    string
+	result  int
+	code    int
+	found   int
+	missing []string
+}
+
+var testQueryStockProviderApi = []queryStockProviderApi{
+	{`{"skus":"SCC"}`, http.StatusBadRequest, ErrorCodeWrongJsonFormat, 0, nil},                 // invalid json
+	{`{"skus":[]}`, http.StatusBadRequest, ErrorCodeInvalidContent, 0, nil},                     // no skus
+	{`{"skus":["SCC",""]}`, http.StatusBadRequest, ErrorCodeInvalidContent, 0, nil},             // empty sku
+	{`{"skus":["SCC","SAC"]}`, http.StatusInternalServerError, ErrorCodeStoringContent, 0, nil}, // RepoFindSkus error
+	{`{"skus":["SCC","SCD","SCC"]}`, http.StatusOK, 0, 2, []string{}},                           // repeated skus
+	{`{"skus":["SCC","SCA","SCD"]}`, http.StatusOK, 0, 2, []string{"SCA"}},                      // missing sku
+}
+
+func TestQueryStock(t *testing.T) {
+	for _, pair := range testQueryStockProviderApi {
+		p := new(mock.PublisherMock)
+		r := new(mock.RepositoryMock)
+		a := New(r, p, nil)
+
+		// Setup
+		e := echo.New()
+		e.POST("/stock/query", a.QueryStock())
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/stock/query", strings.NewReader(pair.json))
+		req.Header.Set("Content-Type", "application/json")
+		e.ServeHTTP(rec, req)
+
+		assert.Equal(t, pair.result, rec.Code, "Http Code doesn't match")
+
+		if pair.result != http.StatusOK {
+			erm := new(gen.ErrResponse)
+			_ = json.Unmarshal([]byte(rec.Body.String()), erm)
+			assert.Equal(t, pair.code, erm.Error.Code, "ErrorCode doesn't match")
+		} else {
+			val := new(gen.SkuQueryResponse)
+			_ = json.Unmarshal([]byte(rec.Body.String()), val)
+			assert.Equal(t, pair.found, len(val.Skus), "Skus found don't match")
+			assert.Equal(t, pair.missing, val.Missing, "Missing skus don't match")
+		}
+	}
+}
+
+/*
+Tests for GetStock method with as_of
+*/
+type getStockAsOfProviderApi struct {
+	value     string
+	result    int
+	code      int
+	available int64
+}
+
+var testGetStockAsOfProviderApi = []getStockAsOfProviderApi{
+	{"/stock/SCC?as_of=yesterday", http.StatusBadRequest, ErrorCodeInvalidContent, 0},       // invalid as_of
+	{"/stock/SCC?as_of=2016-12-31T23:00:00Z", http.StatusNotFound, ErrorCodeSkuNotFound, 0}, // no movements yet
+	{"/stock/SCC?as_of=2017-01-01T10:30:00Z", http.StatusOK, 0, 10},                         // first movement
+	{"/stock/SCC?as_of=2017-01-01T12:00:00%2B01:00", http.StatusOK, 0, 8},                   // timezone offset
+	{"/stock/SCC?as_of=2017-01-02T00:00:00Z", http.StatusOK, 0, 13},                         // every warehouse
+}
+
+func TestGetStockAsOf(t *testing.T) {
+	for _, pair := range testGetStockAsOfProviderApi {
+		p := new(mock.PublisherMock)
+		r := &mock.RepositoryMock{Movements: []gen.StockMovement{
+			{Id: 1, Sku: "SCC", Warehouse: "A", Action: gen.ActionSet, Delta: 10, Quantity: 10, CreatedAt: time.Date(2017, 1, 1, 10, 0, 0, 0, time.UTC)},
+			{Id: 2, Sku: "SCC", Warehouse: "A", Action: gen.ActionReserve, Delta: 2, Quantity: 10, Reserved: 2, CreatedAt: time.Date(2017, 1, 1, 11, 0, 0, 0, time.UTC)},
+			{Id: 3, Sku: "SCC", Warehouse: "B", Action: gen.ActionSet, Delta: 5, Quantity: 5, CreatedAt: time.Date(2017, 1, 1, 12, 0, 0, 0, time.UTC)},
+		}}
+		a := New(r, p, new(cnfs.ServiceConfig))
+
+		// Setup
+		e := echo.New()
+		e.GET("/stock/:sku", a.GetStock())
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", pair.value, strings.NewReader(""))
+		e.ServeHTTP(rec, req)
+
+		assert.Equal(t, pair.result, rec.Code, "Http Code doesn't match")
+		assert.Equal(t, "", rec.Header().Get("ETag"), "ETag doesn't match")
+
+		if pair.result != http.StatusOK {
+			erm := new(gen.ErrResponse)
+			_ = json.Unmarshal([]byte(rec.Body.String()), erm)
+			assert.Equal(t, pair.code, erm.Error.Code, "ErrorCode doesn't match")
+		} else {
+			val := new(gen.SkuResponse)
+			_ = json.Unmarshal([]byte(rec.Body.String()), val)
+			assert.Equal(t, pair.available, val.Available, "Available doesn't match")
+		}
+	}
+}
+
+/*
+Tests for GetStockHistory method
+*/
+type getStockHistoryProviderApi struct {
+	value  string
+	result int
+	code   int
+	count  int
+	cursor string
+}
+
+var testGetStockHistoryProviderApi = []getStockHistoryProviderApi{
+	{"/stock/SCC/history?from=yesterday", http.StatusBadRequest, ErrorCodeInvalidContent, 0, ""},            // invalid from
+	{"/stock/SCC/history?to=2017-13-01", http.StatusBadRequest, ErrorCodeInvalidContent, 0, ""},             // invalid to
+	{"/stock/SCC/history?cursor=abc", http.StatusBadRequest, ErrorCodeInvalidContent, 0, ""},                // invalid cursor
+	{"/stock/SCC/history?limit=0", http.StatusBadRequest, ErrorCodeInvalidContent, 0, ""},                   // invalid limit
+	{"/stock/SCC/history?limit=501", http.StatusBadRequest, ErrorCodeInvalidContent, 0, ""},                 // limit too big
+	{"/stock/SAC/history", http.StatusInternalServerError, ErrorCodeStoringContent, 0, ""},                  // RepoFindMovements error
+	{"/stock/SCC/history", http.StatusOK, 0, 3, ""},                                                         // every movement
+	{"/stock/SCC/history?warehouse=A&from=2017-01-01T00:00:00Z&limit=2", http.StatusOK, 0, 2, "20"},         // first page
+	{"/stock/SCC/history?warehouse=A&from=2017-01-01T00:00:00Z&limit=2&cursor=20", http.StatusOK, 0, 1, ""}, // last page
+}
+
+func TestGetStockHistory(t *testing.T) {
+	for _, pair := range testGetStockHistoryProviderApi {
+		p := new(mock.PublisherMock)
+		r := new(mock.RepositoryMock)
+		a := New(r, p, new(cnfs.ServiceConfig))
+
+		// Setup
+		e := echo.New()
+		e.GET("/stock/:sku/history", a.GetStockHistory())
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", pair.value, strings.NewReader(""))
+		e.ServeHTTP(rec, req)
+
+		assert.Equal(t, pair.result, rec.Code, "Http Code doesn't match")
+
+		if pair.result != http.StatusOK {
+			erm := new(gen.ErrResponse)
+			_ = json.Unmarshal([]byte(rec.Body.String()), erm)
+			assert.Equal(t, pair.code, erm.Error.Code, "ErrorCode doesn't match")
+		} else {
+			val := new(gen.StockHistory)
+			_ = json.Unmarshal([]byte(rec.Body.String()), val)
+			assert.Equal(t, pair.count, len(val.Movements), "Movements don't match")
+			assert.Equal(t, pair.cursor, val.NextCursor, "Cursor doesn't match")
+		}
 	}
 }
 
@@ -114,29 +401,94 @@ type putStockProviderApi struct {
 }
 
 var testPutStockProviderApi = []putStockProviderApi{
-	{"/stock/", "", http.StatusNotFound, 0},                                                                        // Incorrect url no sku
-	{"/stock/SAC", `{"quantity":10}`, http.StatusBadRequest, ErrorCodeInvalidContent},                              // empty warehouse error
-	{"/stock/SAC", `{"quantity":10, "warehouse":"C"}`, http.StatusInternalServerError, ErrorCodeSkuNotFound},       // RepoFindBySkuAndWharehouse error
-	{"/stock/DDD", `{"quantity":10, "warehouse":"A"}`, http.StatusInternalServerError, ErrorCodeStoringContent},    // RepoFindBySkuAndWharehouse Sku empty, INSERT erro
-	{"/stock/DDDD", `{"quantity":10, "warehouse":"A"}`, http.StatusOK, 0},                                          // RepoFindBySkuAndWharehouse Sku empty, INSERT OK
-	{"/stock/SC", `{"quantity":10, "warehouse":"C"}`, http.StatusInternalServerError, ErrorCodeStoringContent},     // UPDATE NOK
-	{"/stock/SCCC", `{"quantity":10, "warehouse":"B"}`, http.StatusNotFound, ErrorCodeSkuNotFound},                 // FindSku to publish error
-	{"/stock/SCD", `{"quantity":10, "warehouse":"D"}`, http.StatusInternalServerError, ErrorCodePublishingMessage}, // Error in publish
+	{"/stock/", "", http.StatusNotFound, 0},                                                                            // Incorrect url no sku
+	{"/stock/SAC", `{"quantity":10}`, http.StatusBadRequest, ErrorCodeInvalidContent},                                  // empty warehouse error
+	{"/stock/SAC", `{"quantity":10, "warehouse":"C"}`, http.StatusInternalServerError, ErrorCodeSkuNotFound},           // RepoFindBySkuAndWharehouse error
+	{"/stock/SCC", `{"quantity":10, "warehouse":"X"}`, http.StatusBadRequest, ErrorCodeInvalidContent},                 // unknown warehouse
+	{"/stock/DDD", `{"quantity":10, "warehouse":"A"}`, http.StatusInternalServerError, ErrorCodeStoringContent},        // RepoFindBySkuAndWharehouse Sku empty, INSERT erro
+	{"/stock/DDDD", `{"quantity":10, "warehouse":"A"}`, http.StatusOK, 0},                                              // RepoFindBySkuAndWharehouse Sku empty, INSERT OK
+	{"/stock/SC", `{"quantity":10, "warehouse":"C"}`, http.StatusInternalServerError, ErrorCodeStoringContent},         // UPDATE NOK
+	{"/stock/SCCC", `{"quantity":10, "warehouse":"B"}`, http.StatusNotFound, ErrorCodeSkuNotFound},                     // FindSku to publish error
+	{"/stock/SCD", `{"quantity":10, "warehouse":"D"}`, http.StatusInternalServerError, ErrorCodePublishingMessage},     // Error in publish
+	{"/stock/SAC/add", `{"quantity":10, "warehouse":"C"}`, http.StatusInternalServerError, ErrorCodeStoringContent},    // RepoAdjustSku error
+	{"/stock/SCN/sub", `{"quantity":10, "warehouse":"C"}`, http.StatusConflict, ErrorCodeInsufficientStock},            // negative after subtraction
+	{"/stock/SCW/sub", `{"quantity":10, "warehouse":"A"}`, http.StatusNotFound, ErrorCodeSkuNotFound},                  // sku not stored in the warehouse
+	{"/stock/SCD/add", `{"quantity":10, "warehouse":"D"}`, http.StatusInternalServerError, ErrorCodePublishingMessage}, // Error in publish
+	{"/stock/SCD/add", `{"quantity":0, "warehouse":"D"}`, http.StatusOK, 0},                                            // nothing to add, not published
+	{"/stock/SCC/add", `{"quantity":10, "warehouse":"A"}`, http.StatusOK, 0},                                           // Add OK
+	{"/stock/SCC/sub", `{"quantity":10, "warehouse":"A"}`, http.StatusOK, 0},                                           // Sub OK
+	{"/stock/SBO/sub", `{"quantity":-1, "warehouse":"A"}`, http.StatusBadRequest, ErrorCodeInvalidContent},             // negative subtraction
+	{"/stock/SSE", `{"quantity":5, "warehouse":"A"}`, http.StatusInternalServerError, ErrorCodeStoringContent},         // RepoFindSkuSettings error
+	{"/stock/SCC", `{"quantity":5, "warehouse":"ERR"}`, http.StatusInternalServerError, ErrorCodeStoringContent},       // RepoFindWarehouse error
+	{"/stock/SBO", `{"quantity":-6, "warehouse":"A"}`, http.StatusConflict, ErrorCodeInsufficientStock},                // below the backorder limit
+	{"/stock/SBO", `{"quantity":-5, "warehouse":"A"}`, http.StatusOK, 0},                                               // backordered set OK
+	{"/stock/SSN", `{"quantity":5, "warehouse":"A"}`, http.StatusBadRequest, ErrorCodeInvalidContent},                  // serialized sku set
+	{"/stock/SSN/add", `{"quantity":5, "warehouse":"A"}`, http.StatusBadRequest, ErrorCodeInvalidContent},              // serialized sku add
 }
 
 func TestPutStock(t *testing.T) {
 	for _, pair := range testPutStockProviderApi {
 		p := new(mock.PublisherMock)
 		r := new(mock.RepositoryMock)
-		a := New(r, p)
+		a := New(r, p, new(cnfs.ServiceConfig))
+
+		// Setup
+		e := echo.New()
+		e.PUT("/stock/:sku", a.PutStock())
+		e.PUT("/stock/:sku/:action", a.PutStock())
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("PUT", pair.value, strings.NewReader(pair.json))
+		req.Header.Set("Content-Type", "application/json")
+		e.ServeHTTP(rec, req)
+
+		assert.Equal(t, rec.Code, pair.result, "Http Code doesn't match")
+
+		if pair.result != http.StatusOK {
+			erm := new(gen.ErrResponse)
+			_ = json.Unmarshal([]byte(rec.Body.String()), erm)
+			assert.Equal(t, pair.code, erm.Error.Code, "ErrorCode doesn't match")
+		}
+	}
+}
+
+/*
+Test for PutStock method with If-Match
+*/
+type putStockIfMatchProviderApi struct {
+	value  string
+	json   string
+	match  string
+	result int
+	code   int
+}
+
+var testPutStockIfMatchProviderApi = []putStockIfMatchProviderApi{
+	{"/stock/SCC", `{"quantity":10, "warehouse":"A"}`, `"abc"`, http.StatusBadRequest, ErrorCodeInvalidContent},             // invalid version
+	{"/stock/SCC", `{"quantity":10, "warehouse":"A"}`, `"-3"`, http.StatusBadRequest, ErrorCodeInvalidContent},              // negative version
+	{"/stock/SCC", `{"quantity":10, "warehouse":"A"}`, `"99"`, http.StatusPreconditionFailed, ErrorCodeVersionMismatch},     // UPDATE version moved on
+	{"/stock/DDDD", `{"quantity":10, "warehouse":"A"}`, `"3"`, http.StatusPreconditionFailed, ErrorCodeVersionMismatch},     // Sku not found, nothing to match
+	{"/stock/SCC/add", `{"quantity":10, "warehouse":"A"}`, `"99"`, http.StatusPreconditionFailed, ErrorCodeVersionMismatch}, // ADJUST version moved on
+	{"/stock/SCC", `{"quantity":10, "warehouse":"A"}`, `"3"`, http.StatusOK, 0},                                             // UPDATE OK
+	{"/stock/SCC/sub", `{"quantity":10, "warehouse":"A"}`, `W/"3"`, http.StatusOK, 0},                                       // ADJUST OK
+	{"/stock/DDDD", `{"quantity":10, "warehouse":"A"}`, `*`, http.StatusOK, 0},                                              // any version, INSERT OK
+}
+
+func TestPutStockIfMatch(t *testing.T) {
+	for _, pair := range testPutStockIfMatchProviderApi {
+		p := new(mock.PublisherMock)
+		r := new(mock.RepositoryMock)
+		a := New(r, p, new(cnfs.ServiceConfig))
 
 		// Setup
 		e := echo.New()
 		e.PUT("/stock/:sku", a.PutStock())
+		e.PUT("/stock/:sku/:action", a.PutStock())
 
 		rec := httptest.NewRecorder()
 		req := httptest.NewRequest("PUT", pair.value, strings.NewReader(pair.json))
 		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("If-Match", pair.match)
 		e.ServeHTTP(rec, req)
 
 		assert.Equal(t, rec.Code, pair.result, "Http Code doesn't match")
@@ -145,6 +497,8 @@ func TestPutStock(t *testing.T) {
 			erm := new(gen.ErrResponse)
 			_ = json.Unmarshal([]byte(rec.Body.String()), erm)
 			assert.Equal(t, pair.code, erm.Error.Code, "ErrorCode doesn't match")
+		} else {
+			assert.Equal(t, `"3"`, rec.Header().Get("ETag"), "ETag doesn't match")
 		}
 	}
 }
@@ -156,17 +510,26 @@ type testSkuApi struct {
 }
 
 var testValidSkuApi = []testSkuApi{
-	{gen.Sku{"", 10, "AB"}, fmt.Errorf("Sku is empty")},
-	{gen.Sku{"AA", 10, ""}, fmt.Errorf("Warehouse is empty")},
-	{gen.Sku{"AA", -1, "AB"}, fmt.Errorf("Quantity is negative")},
-	{gen.Sku{"AA", 10, "AB"}, nil},
+	{gen.Sku{Sku: "", Quantity: 10, Warehouse: "AB"}, fmt.Errorf("Sku is empty")},
+	{gen.Sku{Sku: "AA", Quantity: 10, Warehouse: ""}, fmt.Errorf("Warehouse is empty")},
+	{gen.Sku{Sku: "AA", Quantity: -1, Warehouse: "AB"}, fmt.Errorf("Quantity is negative")},
+	{gen.Sku{Sku: "AA", Quantity: 10, Warehouse: "X"}, fmt.Errorf("Warehouse X not found")},
+	{gen.Sku{Sku: "AA", Quantity: 10, Warehouse: "I"}, fmt.Errorf("Warehouse I is inactive")},
+	{gen.Sku{Sku: "AA", Quantity: 10, Warehouse: "AB"}, nil},
+	{gen.Sku{Sku: "SSE", Quantity: -1, Warehouse: "AB"}, repoError{fmt.Errorf("Erro")}},
+	{gen.Sku{Sku: "SBE", Quantity: 10, Warehouse: "AB"}, repoError{fmt.Errorf("Erro")}},
+	{gen.Sku{Sku: "AA", Quantity: 10, Warehouse: "ERR"}, repoError{fmt.Errorf("Erro")}},
+	{gen.Sku{Sku: "SSN", Quantity: 10, Warehouse: "AB"}, fmt.Errorf("Quantity of Sku SSN is derived from its serial numbers")},
+	{gen.Sku{Sku: "SBO", Quantity: -6, Warehouse: "AB"}, nil},
+	{gen.Sku{Sku: "SBO", Quantity: -5, Warehouse: "AB"}, nil},
+	{gen.Sku{Sku: "SBU", Quantity: -1000, Warehouse: "AB"}, nil},
 }
 
 /* Test for ValidateSku method */
 func TestValidateSku(t *testing.T) {
 	p := new(mock.PublisherMock)
 	r := new(mock.RepositoryMock)
-	a := New(r, p)
+	a := New(r, p, new(cnfs.ServiceConfig))
 
 	for _, pair := range testValidSkuApi {
 		v := a.validateSku(&pair.value)
@@ -181,16 +544,25 @@ type testReservApi struct {
 }
 
 var testValidReservationApi = []testReservApi{
-	{gen.Reservation{"", "AB"}, fmt.Errorf("Sku is empty")},
-	{gen.Reservation{"AA", ""}, fmt.Errorf("Warehouse is empty")},
-	{gen.Reservation{"AA", "AB"}, nil},
+	{gen.Reservation{Sku: "", Warehouse: "AB", Quantity: 1}, fmt.Errorf("Sku is empty")},
+	{gen.Reservation{Id: 3, Sku: "AA", Warehouse: "", Quantity: 1}, fmt.Errorf("Warehouse is empty")},
+	{gen.Reservation{Sku: "AA", Warehouse: "", Quantity: 1, Strategy: "nearest"}, fmt.Errorf("Strategy nearest is not one of [most_available priority split]")},
+	{gen.Reservation{Sku: "AA", Warehouse: "", Quantity: 1, Strategy: "split"}, nil},
+	{gen.Reservation{Sku: "AA", Warehouse: "AB", Quantity: -1}, fmt.Errorf("Quantity is negative")},
+	{gen.Reservation{Sku: "AA", Warehouse: "AB", Quantity: 1, Reference: strings.Repeat("A", 65)}, fmt.Errorf("Reference is longer than 64 characters")},
+	{gen.Reservation{Sku: "AA", Warehouse: "AB", Quantity: 1, Channel: strings.Repeat("A", 33)}, fmt.Errorf("Channel is longer than 32 characters")},
+	{gen.Reservation{Sku: "AA", Warehouse: "AB", Quantity: 1, Ttl: -1}, fmt.Errorf("Ttl is negative")},
+	{gen.Reservation{Sku: "AA", Warehouse: "X", Quantity: 1}, fmt.Errorf("Warehouse X not found")},
+	{gen.Reservation{Sku: "AA", Warehouse: "I", Quantity: 1}, fmt.Errorf("Warehouse I is inactive")},
+	{gen.Reservation{Id: 3, Sku: "AA", Warehouse: "I", Quantity: 1}, nil},
+	{gen.Reservation{Sku: "AA", Warehouse: "AB", Quantity: 5, Reference: "ORDER-1", Ttl: 60}, nil},
 }
 
 /* Test for ValidateSku method */
 func TestValidateReservation(t *testing.T) {
 	p := new(mock.PublisherMock)
 	r := new(mock.RepositoryMock)
-	a := New(r, p)
+	a := New(r, p, new(cnfs.ServiceConfig))
 
 	for _, pair := range testValidReservationApi {
 		v := a.validateReservation(&pair.value)
@@ -216,7 +588,7 @@ func TestHealthStatus(t *testing.T) {
 	for _, pair := range testGetHealthStatusApi {
 		p := new(mock.PublisherMock)
 		r := new(mock.RepositoryMock)
-		a := New(r, p)
+		a := New(r, p, new(cnfs.ServiceConfig))
 
 		switch pair.erro {
 		case "repo":
@@ -0,0 +1,156 @@
+package api
+
+import (
+	"fmt"
+	"github.com/labstack/echo"
+	strut "github.com/pintobikez/stock-service/api/structures"
+	"net/http"
+	"strconv"
+)
+
+// Handler to POST Transfer request
+func (a *API) PostTransfer() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		t := new(strut.Transfer)
+
+		if err := c.Bind(t); err != nil {
+			return c.JSON(http.StatusBadRequest, &strut.ErrResponse{strut.ErrContent{ErrorCodeWrongJsonFormat, err.Error()}})
+		}
+		*t = strut.Transfer{Sku: t.Sku, Source: t.Source, Destination: t.Destination, Quantity: t.Quantity, Reference: t.Reference}
+
+		if err := a.validateTransfer(t); err != nil {
+			return c.JSON(http.StatusBadRequest, &strut.ErrResponse{strut.ErrContent{ErrorCodeInvalidContent, err.Error()}})
+		}
+		t.RequestId, t.Caller = origin(c)
+
+		id, err := a.rp.InsertTransfer(t)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, &strut.ErrResponse{strut.ErrContent{ErrorCodeStoringContent, err.Error()}})
+		}
+		t.Id = id
+		t.Status = strut.TransferRequested
+
+		return c.JSON(http.StatusCreated, t)
+	}
+}
+
+// Handler to GET Transfer request
+func (a *API) GetTransfer() echo.HandlerFunc {
+	return func(c echo.Context) error {
+
+		t, httpcode, code, err := a.findTransfer(c)
+		if err != nil {
+			return c.JSON(httpcode, &strut.ErrResponse{strut.ErrContent{code, err.Error()}})
+		}
+
+		return c.JSON(http.StatusOK, t)
+	}
+}
+
+// Handler to POST Transfer ship request
+func (a *API) ShipTransfer() echo.HandlerFunc {
+	return a.moveTransfer(a.rp.ShipTransfer)
+}
+
+// Handler to POST Transfer receive request
+func (a *API) ReceiveTransfer() echo.HandlerFunc {
+	return a.moveTransfer(a.rp.ReceiveTransfer)
+}
+
+// Handler to POST Transfer cancel request
+func (a *API) CancelTransfer() echo.HandlerFunc {
+	return a.moveTransfer(a.rp.CancelTransfer)
+}
+
+// Moves a Transfer to its next status with the given repository step and publishes the stock of its sku
+func (a *API) moveTransfer(step func(t *strut.Transfer) error) echo.HandlerFunc {
+	return func(c echo.Context) error {
+
+		t, httpcode, code, err := a.findTransfer(c)
+		if err != nil {
+			return c.JSON(httpcode, &strut.ErrResponse{strut.ErrContent{code, err.Error()}})
+		}
+		t.RequestId, t.Caller = origin(c)
+
+		// cancelling a transfer not shipped yet does not change the stock
+		moved := t.Status != strut.TransferRequested
+
+		if err := step(t); err != nil {
+			switch err.Error() {
+			case "404":
+				return c.JSON(http.StatusNotFound, &strut.ErrResponse{strut.ErrContent{ErrorCodeTransferNotFound, fmt.Sprintf(TransferNotFound, t.Id)}})
+			case "409":
+				return c.JSON(http.StatusConflict, &strut.ErrResponse{strut.ErrContent{ErrorCodeInsufficientStock, fmt.Sprintf(TransferInsufficient, t.Sku, t.Source, t.Quantity)}})
+			case "412":
+				return c.JSON(http.StatusConflict, &strut.ErrResponse{strut.ErrContent{ErrorCodeTransferStatus, fmt.Sprintf(TransferStatus, t.Id, t.Status)}})
+			}
+			return c.JSON(http.StatusInternalServerError, &strut.ErrResponse{strut.ErrContent{ErrorCodeStoringContent, err.Error()}})
+		}
+		moved = moved || t.Status != strut.TransferCancelled
+
+		if moved {
+			skuResponse, err := a.rp.FindSku(t.Sku)
+			if err != nil {
+				return c.JSON(http.StatusNotFound, &strut.ErrResponse{strut.ErrContent{ErrorCodeSkuNotFound, fmt.Sprintf(SkuNotFound, t.Sku)}})
+			}
+
+			if err := a.publish(skuResponse); err != nil {
+				return c.JSON(http.StatusInternalServerError, &strut.ErrResponse{strut.ErrContent{ErrorCodePublishingMessage, err.Error()}})
+			}
+		}
+
+		return c.JSON(http.StatusOK, t)
+	}
+}
+
+// Finds the Transfer of the url
+func (a *API) findTransfer(c echo.Context) (*strut.Transfer, int, int, error) {
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || id <= 0 {
+		return nil, http.StatusBadRequest, ErrorCodeInvalidContent, fmt.Errorf("Transfer id %s is invalid", c.Param("id"))
+	}
+
+	t, err := a.rp.FindTransfer(id)
+	if err != nil {
+		return nil, http.StatusInternalServerError, ErrorCodeTransferNotFound, err
+	}
+	if t.Id == 0 {
+		return nil, http.StatusNotFound, ErrorCodeTransferNotFound, fmt.Errorf(TransferNotFound, id)
+	}
+
+	return t, http.StatusOK, 0, nil
+}
+
+// Validates the consistency of the Transfer struct
+func (a *API) validateTransfer(t *strut.Transfer) error {
+	if t.Sku == "" {
+		return fmt.Errorf("Sku is empty")
+	}
+	if t.Source == "" {
+		return fmt.Errorf("Source is empty")
+	}
+	if t.Destination == "" {
+		return fmt.Errorf("Destination is empty")
+	}
+	if t.Source == t.Destination {
+		return fmt.Errorf("Source and Destination are the same Warehouse")
+	}
+	if t.Quantity <= 0 {
+		return fmt.Errorf("Quantity is not positive")
+	}
+	if len(t.Reference) > 64 {
+		return fmt.Errorf("Reference is longer than 64 characters")
+	}
+	// the serial numbers of a serialized sku do not travel with a transfer
+	if err := a.notSerialized(t.Sku); err != nil {
+		return err
+	}
+	if err := a.notBundle(t.Sku); err != nil {
+		return err
+	}
+	if err := a.knownWarehouse(t.Source); err != nil {
+		return err
+	}
+	return a.knownWarehouse(t.Destination)
+}
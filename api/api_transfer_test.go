@@ -0,0 +1,88 @@
+package api
+
+import (
+	"encoding/json"
+	"github.com/labstack/echo"
+	gen "github.com/pintobikez/stock-service/api/structures"
+	mock "github.com/pintobikez/stock-service/mocks"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+/*
+Tests for the Transfer methods
+*/
+type transferProviderApi struct {
+	method    string
+	value     string
+	json      string
+	result    int
+	code      int
+	status    string
+	published bool
+}
+
+var testTransferProviderApi = []transferProviderApi{
+	{"POST", "/transfers", `{"sku":"SCC"`, http.StatusBadRequest, ErrorCodeWrongJsonFormat, "", false},                                                           // invalid json
+	{"POST", "/transfers", `{"source":"A","destination":"B","quantity":1}`, http.StatusBadRequest, ErrorCodeInvalidContent, "", false},                           // empty sku
+	{"POST", "/transfers", `{"sku":"SCC","destination":"B","quantity":1}`, http.StatusBadRequest, ErrorCodeInvalidContent, "", false},                            // empty source
+	{"POST", "/transfers", `{"sku":"SCC","source":"A","quantity":1}`, http.StatusBadRequest, ErrorCodeInvalidContent, "", false},                                 // empty destination
+	{"POST", "/transfers", `{"sku":"SCC","source":"A","destination":"A","quantity":1}`, http.StatusBadRequest, ErrorCodeInvalidContent, "", false},               // same warehouse
+	{"POST", "/transfers", `{"sku":"SCC","source":"A","destination":"B","quantity":0}`, http.StatusBadRequest, ErrorCodeInvalidContent, "", false},               // no quantity
+	{"POST", "/transfers", `{"sku":"SCC","source":"A","destination":"I","quantity":1}`, http.StatusBadRequest, ErrorCodeInvalidContent, "", false},               // inactive destination
+	{"POST", "/transfers", `{"sku":"SSN","source":"A","destination":"B","quantity":1}`, http.StatusBadRequest, ErrorCodeInvalidContent, "", false},               // serialized sku
+	{"POST", "/transfers", `{"sku":"SC","source":"A","destination":"B","quantity":1}`, http.StatusInternalServerError, ErrorCodeStoringContent, "", false},       // RepoInsertTransfer error
+	{"POST", "/transfers", `{"sku":"SCC","source":"A","destination":"B","quantity":2,"status":"received"}`, http.StatusCreated, 0, gen.TransferRequested, false}, // Insert OK
+	{"GET", "/transfers/ABC", "", http.StatusBadRequest, ErrorCodeInvalidContent, "", false},                                                                     // invalid Transfer id
+	{"GET", "/transfers/1", "", http.StatusInternalServerError, ErrorCodeTransferNotFound, "", false},                                                            // RepoFindTransfer error
+	{"GET", "/transfers/2", "", http.StatusNotFound, ErrorCodeTransferNotFound, "", false},                                                                       // Transfer not found
+	{"GET", "/transfers/5", "", http.StatusOK, 0, gen.TransferReceived, false},                                                                                   // Transfer found
+	{"POST", "/transfers/2/ship", "", http.StatusNotFound, ErrorCodeTransferNotFound, "", false},                                                                 // Transfer not found
+	{"POST", "/transfers/3/ship", "", http.StatusInternalServerError, ErrorCodeStoringContent, "", false},                                                        // RepoShipTransfer error
+	{"POST", "/transfers/4/ship", "", http.StatusConflict, ErrorCodeInsufficientStock, "", false},                                                                // not enough stock in the source
+	{"POST", "/transfers/5/ship", "", http.StatusConflict, ErrorCodeTransferStatus, "", false},                                                                   // already received
+	{"POST", "/transfers/8/ship", "", http.StatusOK, 0, gen.TransferShipped, true},                                                                               // Ship OK
+	{"POST", "/transfers/8/receive", "", http.StatusConflict, ErrorCodeTransferStatus, "", false},                                                                // not shipped yet
+	{"POST", "/transfers/6/receive", "", http.StatusInternalServerError, ErrorCodePublishingMessage, "", false},                                                  // Error Publish
+	{"POST", "/transfers/7/receive", "", http.StatusOK, 0, gen.TransferReceived, true},                                                                           // Receive OK
+	{"POST", "/transfers/5/cancel", "", http.StatusConflict, ErrorCodeTransferStatus, "", false},                                                                 // already received
+	{"POST", "/transfers/8/cancel", "", http.StatusOK, 0, gen.TransferCancelled, false},                                                                          // Cancel before shipping, nothing published
+	{"POST", "/transfers/7/cancel", "", http.StatusOK, 0, gen.TransferCancelled, true},                                                                           // Cancel after shipping gives the units back
+}
+
+func TestTransfer(t *testing.T) {
+	for _, pair := range testTransferProviderApi {
+		p := new(mock.PublisherMock)
+		r := new(mock.RepositoryMock)
+		a := New(r, p, nil)
+
+		// Setup
+		e := echo.New()
+		e.POST("/transfers", a.PostTransfer())
+		e.GET("/transfers/:id", a.GetTransfer())
+		e.POST("/transfers/:id/ship", a.ShipTransfer())
+		e.POST("/transfers/:id/receive", a.ReceiveTransfer())
+		e.POST("/transfers/:id/cancel", a.CancelTransfer())
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(pair.method, pair.value, strings.NewReader(pair.json))
+		req.Header.Set("Content-Type", "application/json")
+		e.ServeHTTP(rec, req)
+
+		assert.Equal(t, pair.result, rec.Code, "Http Code of "+pair.method+" "+pair.value+" doesn't match")
+		assert.Equal(t, pair.published, len(p.Published) > 0, "Published doesn't match")
+
+		if rec.Code >= http.StatusBadRequest {
+			erm := new(gen.ErrResponse)
+			_ = json.Unmarshal([]byte(rec.Body.String()), erm)
+			assert.Equal(t, pair.code, erm.Error.Code, "ErrorCode doesn't match")
+		} else {
+			val := new(gen.Transfer)
+			_ = json.Unmarshal([]byte(rec.Body.String()), val)
+			assert.Equal(t, pair.status, val.Status, "Status doesn't match")
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package api
+
+import (
+	"fmt"
+	"github.com/labstack/echo"
+	strut "github.com/pintobikez/stock-service/api/structures"
+	"net/http"
+	"time"
+)
+
+// Handler to GET Warehouses request
+func (a *API) GetWarehouses() echo.HandlerFunc {
+	return func(c echo.Context) error {
+
+		warehouses, err := a.rp.FindWarehouses()
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, &strut.ErrResponse{strut.ErrContent{ErrorCodeStoringContent, err.Error()}})
+		}
+
+		return c.JSON(http.StatusOK, warehouses)
+	}
+}
+
+// Handler to GET Warehouse request
+func (a *API) GetWarehouse() echo.HandlerFunc {
+	return func(c echo.Context) error {
+
+		code := c.Param("code")
+		w, err := a.rp.FindWarehouse(code)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, &strut.ErrResponse{strut.ErrContent{ErrorCodeWarehouseNotFound, err.Error()}})
+		}
+		if w.Code == "" {
+			return c.JSON(http.StatusNotFound, &strut.ErrResponse{strut.ErrContent{ErrorCodeWarehouseNotFound, fmt.Sprintf(WarehouseNotFound, code)}})
+		}
+
+		return c.JSON(http.StatusOK, w)
+	}
+}
+
+// Handler to POST Warehouse request
+func (a *API) PostWarehouse() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		// a warehouse is active unless told otherwise
+		w := &strut.Warehouse{Active: true}
+
+		if err := c.Bind(w); err != nil {
+			return c.JSON(http.StatusBadRequest, &strut.ErrResponse{strut.ErrContent{ErrorCodeWrongJsonFormat, err.Error()}})
+		}
+
+		if err := a.validateWarehouse(w); err != nil {
+			return c.JSON(http.StatusBadRequest, &strut.ErrResponse{strut.ErrContent{ErrorCodeInvalidContent, err.Error()}})
+		}
+
+		if err := a.rp.InsertWarehouse(w); err != nil {
+			if err.Error() == "409" {
+				return c.JSON(http.StatusConflict, &strut.ErrResponse{strut.ErrContent{ErrorCodeWarehouseExists, fmt.Sprintf(WarehouseExists, w.Code)}})
+			}
+			return c.JSON(http.StatusInternalServerError, &strut.ErrResponse{strut.ErrContent{ErrorCodeStoringContent, err.Error()}})
+		}
+
+		return c.JSON(http.StatusCreated, w)
+	}
+}
+
+// Handler to PUT Warehouse request
+func (a *API) PutWarehouse() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		w := &strut.Warehouse{Active: true}
+
+		if err := c.Bind(w); err != nil {
+			return c.JSON(http.StatusBadRequest, &strut.ErrResponse{strut.ErrContent{ErrorCodeWrongJsonFormat, err.Error()}})
+		}
+		w.Code = c.Param("code")
+
+		if err := a.validateWarehouse(w); err != nil {
+			return c.JSON(http.StatusBadRequest, &strut.ErrResponse{strut.ErrContent{ErrorCodeInvalidContent, err.Error()}})
+		}
+
+		if err := a.rp.UpdateWarehouse(w); err != nil {
+			if err.Error() == "404" {
+				return c.JSON(http.StatusNotFound, &strut.ErrResponse{strut.ErrContent{ErrorCodeWarehouseNotFound, fmt.Sprintf(WarehouseNotFound, w.Code)}})
+			}
+			return c.JSON(http.StatusInternalServerError, &strut.ErrResponse{strut.ErrContent{ErrorCodeStoringContent, err.Error()}})
+		}
+
+		return c.JSON(http.StatusOK, w)
+	}
+}
+
+// Handler to DELETE Warehouse request
+// A warehouse holding stock or reservations can only be made inactive
+func (a *API) RemoveWarehouse() echo.HandlerFunc {
+	return func(c echo.Context) error {
+
+		code := c.Param("code")
+		if err := a.rp.DeleteWarehouse(code); err != nil {
+			switch err.Error() {
+			case "404":
+				return c.JSON(http.StatusNotFound, &strut.ErrResponse{strut.ErrContent{ErrorCodeWarehouseNotFound, fmt.Sprintf(WarehouseNotFound, code)}})
+			case "409":
+				return c.JSON(http.StatusConflict, &strut.ErrResponse{strut.ErrContent{ErrorCodeWarehouseInUse, fmt.Sprintf(WarehouseInUse, code)}})
+			}
+			return c.JSON(http.StatusInternalServerError, &strut.ErrResponse{strut.ErrContent{ErrorCodeStoringContent, err.Error()}})
+		}
+
+		return c.NoContent(http.StatusOK)
+	}
+}
+
+// Validates the consistency of the Warehouse struct
+func (a *API) validateWarehouse(w *strut.Warehouse) error {
+	if w.Code == "" {
+		return fmt.Errorf("Code is empty")
+	}
+	if len(w.Code) > 45 {
+		return fmt.Errorf("Code is longer than 45 characters")
+	}
+	if w.Name == "" {
+		return fmt.Errorf("Name is empty")
+	}
+	if len(w.Name) > 128 {
+		return fmt.Errorf("Name is longer than 128 characters")
+	}
+	if w.Timezone == "" {
+		w.Timezone = "UTC"
+	}
+	if _, err := time.LoadLocation(w.Timezone); err != nil {
+		return fmt.Errorf("Timezone %s is unknown", w.Timezone)
+	}
+	if w.Priority < 0 {
+		return fmt.Errorf("Priority is negative")
+	}
+	if w.SafetyStock != nil && *w.SafetyStock < 0 {
+		return fmt.Errorf("Safety stock is negative")
+	}
+	if len(w.Address) > 255 {
+		return fmt.Errorf("Address is longer than 255 characters")
+	}
+	return nil
+}
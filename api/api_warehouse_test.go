@@ -0,0 +1,88 @@
+package api
+
+import (
+	"encoding/json"
+	"github.com/labstack/echo"
+	gen "github.com/pintobikez/stock-service/api/structures"
+	mock "github.com/pintobikez/stock-service/mocks"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+/*
+Tests for the Warehouse methods
+*/
+type warehouseProviderApi struct {
+	method string
+	value  string
+	json   string
+	result int
+	code   int
+}
+
+// every request runs against the same repository, in order
+var testWarehouseProviderApi = []warehouseProviderApi{
+	{"GET", "/warehouses", "", http.StatusOK, 0},                                                                                       // no warehouses
+	{"POST", "/warehouses", `{"code":"B"`, http.StatusBadRequest, ErrorCodeWrongJsonFormat},                                            // invalid json
+	{"POST", "/warehouses", `{"name":"Porto"}`, http.StatusBadRequest, ErrorCodeInvalidContent},                                        // empty code
+	{"POST", "/warehouses", `{"code":"B"}`, http.StatusBadRequest, ErrorCodeInvalidContent},                                            // empty name
+	{"POST", "/warehouses", `{"code":"B","name":"Porto","timezone":"Europe/Nowhere"}`, http.StatusBadRequest, ErrorCodeInvalidContent}, // unknown timezone
+	{"POST", "/warehouses", `{"code":"B","name":"Porto","priority":-1}`, http.StatusBadRequest, ErrorCodeInvalidContent},               // negative priority
+	{"POST", "/warehouses", `{"code":"B","name":"Porto","safety_stock":-1}`, http.StatusBadRequest, ErrorCodeInvalidContent},           // negative safety stock
+	{"POST", "/warehouses", `{"code":"ERR","name":"Porto"}`, http.StatusInternalServerError, ErrorCodeStoringContent},                  // RepoInsertWarehouse error
+	{"POST", "/warehouses", `{"code":"B","name":"Porto","timezone":"Europe/Lisbon","priority":2}`, http.StatusCreated, 0},              // Insert OK
+	{"POST", "/warehouses", `{"code":"B","name":"Porto"}`, http.StatusConflict, ErrorCodeWarehouseExists},                              // code already in use
+	{"POST", "/warehouses", `{"code":"C","name":"Lisboa","active":false}`, http.StatusCreated, 0},                                      // Insert inactive OK
+	{"GET", "/warehouses/ERR", "", http.StatusInternalServerError, ErrorCodeWarehouseNotFound},                                         // RepoFindWarehouse error
+	{"GET", "/warehouses/b", "", http.StatusNotFound, ErrorCodeWarehouseNotFound},                                                      // codes are case sensitive
+	{"GET", "/warehouses/B", "", http.StatusOK, 0},                                                                                     // Warehouse found
+	{"PUT", "/warehouses/D", `{"name":"Braga"}`, http.StatusNotFound, ErrorCodeWarehouseNotFound},                                      // Warehouse not found
+	{"PUT", "/warehouses/B", `{"name":""}`, http.StatusBadRequest, ErrorCodeInvalidContent},                                            // empty name
+	{"PUT", "/warehouses/B", `{"name":"Porto","active":false}`, http.StatusOK, 0},                                                      // Update OK
+	{"DELETE", "/warehouses/A", "", http.StatusConflict, ErrorCodeWarehouseInUse},                                                      // Warehouse holding stock
+	{"DELETE", "/warehouses/D", "", http.StatusNotFound, ErrorCodeWarehouseNotFound},                                                   // Warehouse not found
+	{"DELETE", "/warehouses/C", "", http.StatusOK, 0},                                                                                  // Delete OK
+}
+
+func TestWarehouse(t *testing.T) {
+	p := new(mock.PublisherMock)
+	r := new(mock.RepositoryMock)
+	a := New(r, p, nil)
+
+	// Setup
+	e := echo.New()
+	e.GET("/warehouses", a.GetWarehouses())
+	e.POST("/warehouses", a.PostWarehouse())
+	e.GET("/warehouses/:code", a.GetWarehouse())
+	e.PUT("/warehouses/:code", a.PutWarehouse())
+	e.DELETE("/warehouses/:code", a.RemoveWarehouse())
+
+	for _, pair := range testWarehouseProviderApi {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(pair.method, pair.value, strings.NewReader(pair.json))
+		req.Header.Set("Content-Type", "application/json")
+		e.ServeHTTP(rec, req)
+
+		assert.Equal(t, pair.result, rec.Code, "Http Code of "+pair.method+" "+pair.value+" doesn't match")
+
+		if rec.Code >= http.StatusBadRequest {
+			erm := new(gen.ErrResponse)
+			_ = json.Unmarshal([]byte(rec.Body.String()), erm)
+			assert.Equal(t, pair.code, erm.Error.Code, "ErrorCode doesn't match")
+		}
+	}
+
+	// the registry now holds the updated warehouse only
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest("GET", "/warehouses", nil))
+
+	val := []gen.Warehouse{}
+	_ = json.Unmarshal([]byte(rec.Body.String()), &val)
+	assert.Equal(t, []gen.Warehouse{{Code: "B", Name: "Porto", Active: false, Timezone: "UTC"}}, val, "Warehouses don't match")
+
+	// and the stock of an inactive warehouse can not be changed
+	assert.Equal(t, "Warehouse B is inactive", a.validateSku(&gen.Sku{Sku: "SCC", Warehouse: "B", Quantity: 1}).Error(), "Error message doesn't match")
+}
@@ -1,26 +1,385 @@
 package structures
 
+import "time"
+
+// Actions recorded in the stock movements
+const (
+	ActionSet     = "set"
+	ActionAdd     = "add"
+	ActionSub     = "sub"
+	ActionReserve = "reserve"
+	ActionRelease = "release"
+	ActionCommit  = "commit"
+	ActionExpire  = "expire"
+	ActionAdjust  = "adjust"
+
+	ActionReceive = "receive"
+	ActionLot     = "lot"
+
+	ActionSerialIn  = "serial_in"
+	ActionSerialOut = "serial_out"
+
+	ActionTransferOut  = "transfer_out"
+	ActionTransferIn   = "transfer_in"
+	ActionTransferBack = "transfer_back"
+)
+
+// Statuses of a transfer
+const (
+	TransferRequested = "requested"
+	TransferShipped   = "shipped"
+	TransferReceived  = "received"
+	TransferCancelled = "cancelled"
+)
+
+// Statuses of an inbound supply
+const (
+	InboundExpected  = "expected"
+	InboundReceived  = "received"
+	InboundCancelled = "cancelled"
+)
+
+// Backorder policies of a sku
+const (
+	BackorderDisallowed = "disallowed"
+	BackorderUnlimited  = "unlimited"
+	BackorderCapped     = "capped"
+)
+
+// Key of the units shared by the channels without allocation
+const (
+	ChannelShared = "shared"
+)
+
+// Views of the stock of a sku
+const (
+	ViewAtp = "atp"
+)
+
+// Sorts of the stock listing
+const (
+	SortSku       = "sku"
+	SortUpdatedAt = "updated_at"
+	SortAvail     = "avail"
+)
+
+// Results of a row of a bulk stock update
+const (
+	RowChanged   = "changed"
+	RowUnchanged = "unchanged"
+	RowFailed    = "failed"
+)
+
 type Sku struct {
 	Sku       string `json:"sku"`
 	Quantity  int64  `json:"quantity"`
 	Warehouse string `json:"warehouse"`
+	Version   int64  `json:"-"`
+	RequestId string `json:"-"`
+	Caller    string `json:"-"`
+}
+
+type StockRow struct {
+	Row       int    `json:"-"`
+	Sku       string `json:"sku"`
+	Warehouse string `json:"warehouse"`
+	Quantity  int64  `json:"quantity"`
+	Action    string `json:"action,omitempty"`
+	RequestId string `json:"-"`
+	Caller    string `json:"-"`
+}
+
+type StockRowResult struct {
+	Row       int    `json:"row"`
+	Sku       string `json:"sku"`
+	Warehouse string `json:"warehouse"`
+	Status    string `json:"status"`
+	Quantity  int64  `json:"quantity"`
+	Error     string `json:"error,omitempty"`
+}
+
+type BulkStockReport struct {
+	Changed     int              `json:"changed"`
+	Unchanged   int              `json:"unchanged"`
+	Failed      int              `json:"failed"`
+	Rows        []StockRowResult `json:"rows"`
+	Unpublished []string         `json:"unpublished,omitempty"`
 }
 
 type SkuResponse struct {
-	Sku       string      `json:"sku"`
-	Values    []SkuValues `json:"values"`
-	Reserved  int64       `json:"reserved"`
-	Available int64       `json:"avail"`
+	Sku          string           `json:"sku"`
+	Channel      string           `json:"channel,omitempty"`
+	Values       []SkuValues      `json:"values"`
+	Reserved     int64            `json:"reserved"`
+	SafetyStock  int64            `json:"safety_stock"`
+	RawAvailable int64            `json:"raw_avail"`
+	Available    int64            `json:"avail"`
+	Backordered  int64            `json:"backordered"`
+	Expired      int64            `json:"expired,omitempty"`
+	InTransit    int64            `json:"in_transit,omitempty"`
+	Channels     map[string]int64 `json:"channels,omitempty"`
+	Components   []Component      `json:"components,omitempty"`
+}
+
+type SkuQuery struct {
+	Skus []string `json:"skus"`
+}
+
+type SkuQueryResponse struct {
+	Skus    map[string]*SkuResponse `json:"skus"`
+	Missing []string                `json:"missing"`
+}
+
+type StockItem struct {
+	Sku          string     `json:"sku"`
+	Warehouse    string     `json:"warehouse"`
+	Quantity     int64      `json:"quantity"`
+	Reserved     int64      `json:"reserved"`
+	SafetyStock  int64      `json:"safety_stock"`
+	RawAvailable int64      `json:"raw_avail"`
+	Available    int64      `json:"avail"`
+	Backordered  int64      `json:"backordered"`
+	Expired      int64      `json:"expired,omitempty"`
+	Version      int64      `json:"version"`
+	UpdatedAt    *time.Time `json:"updated_at,omitempty"`
+}
+
+type StockFilter struct {
+	Warehouse   string
+	SkuPrefix   string
+	MinAvail    *int64
+	MaxAvail    *int64
+	UpdatedFrom *time.Time
+	UpdatedTo   *time.Time
+	Sort        string
+	Desc        bool
+	After       *StockItem
+	Limit       int64
+}
+
+type StockList struct {
+	Items      []StockItem `json:"items"`
+	NextCursor string      `json:"next_cursor,omitempty"`
 }
 
 type SkuValues struct {
-	Quantity  int64  `json:"quantity"`
+	Quantity     int64            `json:"quantity"`
+	Warehouse    string           `json:"warehouse"`
+	Version      int64            `json:"version"`
+	Reserved     int64            `json:"reserved"`
+	SafetyStock  int64            `json:"safety_stock"`
+	RawAvailable int64            `json:"raw_avail"`
+	Available    int64            `json:"avail"`
+	Backordered  int64            `json:"backordered"`
+	Expired      int64            `json:"expired,omitempty"`
+	Channels     map[string]int64 `json:"channels,omitempty"`
+}
+
+type SkuSettings struct {
+	Sku            string `json:"sku"`
+	Preorder       bool   `json:"preorder"`
+	Backorder      string `json:"backorder"`
+	BackorderLimit int64  `json:"backorder_limit"`
+	Serialized     bool   `json:"serialized"`
+}
+
+type Bundle struct {
+	Sku        string      `json:"sku"`
+	Components []Component `json:"components"`
+}
+
+type Component struct {
+	Sku      string `json:"sku"`
+	Quantity int64  `json:"quantity"`
+}
+
+type SafetyStock struct {
+	Sku         string `json:"sku"`
+	Warehouse   string `json:"warehouse"`
+	SafetyStock *int64 `json:"safety_stock"`
+}
+
+type ChannelAllocation struct {
+	Sku        string `json:"sku"`
+	Warehouse  string `json:"warehouse"`
+	Channel    string `json:"channel"`
+	Quantity   *int64 `json:"quantity,omitempty"`
+	Percentage *int64 `json:"percentage,omitempty"`
+	Allocated  int64  `json:"allocated"`
+	Reserved   int64  `json:"reserved"`
+}
+
+type Lot struct {
+	Sku       string     `json:"sku"`
+	Warehouse string     `json:"warehouse"`
+	Lot       string     `json:"lot"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	Quantity  int64      `json:"quantity"`
+	Reserved  int64      `json:"reserved"`
+	Expired   bool       `json:"expired"`
+	RequestId string     `json:"-"`
+	Caller    string     `json:"-"`
+}
+
+type Serial struct {
+	Sku           string     `json:"sku"`
+	Warehouse     string     `json:"warehouse"`
+	Serial        string     `json:"serial"`
+	ReservationId int64      `json:"reservation_id,omitempty"`
+	CreatedAt     *time.Time `json:"created_at,omitempty"`
+	RequestId     string     `json:"-"`
+	Caller        string     `json:"-"`
+}
+
+type SerialRegistration struct {
+	Sku       string   `json:"sku"`
+	Warehouse string   `json:"warehouse"`
+	Serials   []string `json:"serials"`
+	RequestId string   `json:"-"`
+	Caller    string   `json:"-"`
+}
+
+type Allocation struct {
+	Id        int64  `json:"id"`
 	Warehouse string `json:"warehouse"`
+	Quantity  int64  `json:"quantity"`
+}
+
+type Warehouse struct {
+	Code        string `json:"code"`
+	Name        string `json:"name"`
+	Active      bool   `json:"active"`
+	Timezone    string `json:"timezone"`
+	Priority    int64  `json:"priority"`
+	SafetyStock *int64 `json:"safety_stock,omitempty"`
+	Address     string `json:"address,omitempty"`
 }
 
 type Reservation struct {
+	Id          int64         `json:"id"`
+	Sku         string        `json:"sku"`
+	Warehouse   string        `json:"warehouse"`
+	Quantity    int64         `json:"quantity"`
+	Reference   string        `json:"reference,omitempty"`
+	Channel     string        `json:"channel,omitempty"`
+	Ttl         int64         `json:"ttl,omitempty"`
+	ExpiresAt   *time.Time    `json:"expires_at,omitempty"`
+	Strategy    string        `json:"strategy,omitempty"`
+	Allocations []Allocation  `json:"allocations,omitempty"`
+	Preorder    bool          `json:"preorder,omitempty"`
+	Serials     []string      `json:"serials,omitempty"`
+	Components  []Reservation `json:"components,omitempty"`
+	RequestId   string        `json:"-"`
+	Caller      string        `json:"-"`
+}
+
+type Order struct {
+	Order     string        `json:"order"`
+	Channel   string        `json:"channel,omitempty"`
+	Ttl       int64         `json:"ttl,omitempty"`
+	Lines     []Reservation `json:"lines"`
+	RequestId string        `json:"-"`
+	Caller    string        `json:"-"`
+}
+
+type StockMovement struct {
+	Id           int64     `json:"id"`
+	Sku          string    `json:"sku"`
+	Warehouse    string    `json:"warehouse"`
+	Action       string    `json:"action"`
+	Delta        int64     `json:"delta"`
+	Quantity     int64     `json:"quantity"`
+	Reserved     int64     `json:"reserved"`
+	AdjustmentId int64     `json:"adjustment_id,omitempty"`
+	TransferId   int64     `json:"transfer_id,omitempty"`
+	InboundId    int64     `json:"inbound_id,omitempty"`
+	RequestId    string    `json:"request_id,omitempty"`
+	Caller       string    `json:"caller,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+type Adjustment struct {
+	Id        int64            `json:"id"`
+	Reason    string           `json:"reason"`
+	Note      string           `json:"note,omitempty"`
+	Lines     []AdjustmentLine `json:"lines"`
+	CreatedAt *time.Time       `json:"created_at,omitempty"`
+	RequestId string           `json:"-"`
+	Caller    string           `json:"-"`
+}
+
+type AdjustmentLine struct {
 	Sku       string `json:"sku"`
 	Warehouse string `json:"warehouse"`
+	Delta     int64  `json:"delta"`
+	Quantity  int64  `json:"quantity"`
+}
+
+type Transfer struct {
+	Id          int64      `json:"id"`
+	Sku         string     `json:"sku"`
+	Source      string     `json:"source"`
+	Destination string     `json:"destination"`
+	Quantity    int64      `json:"quantity"`
+	Status      string     `json:"status"`
+	Reference   string     `json:"reference,omitempty"`
+	CreatedAt   *time.Time `json:"created_at,omitempty"`
+	ShippedAt   *time.Time `json:"shipped_at,omitempty"`
+	ReceivedAt  *time.Time `json:"received_at,omitempty"`
+	CancelledAt *time.Time `json:"cancelled_at,omitempty"`
+	RequestId   string     `json:"-"`
+	Caller      string     `json:"-"`
+}
+
+type Inbound struct {
+	Id          int64      `json:"id"`
+	Sku         string     `json:"sku"`
+	Warehouse   string     `json:"warehouse"`
+	Quantity    int64      `json:"quantity"`
+	ExpectedAt  *time.Time `json:"expected_at"`
+	Status      string     `json:"status"`
+	Reference   string     `json:"reference,omitempty"`
+	CreatedAt   *time.Time `json:"created_at,omitempty"`
+	ReceivedAt  *time.Time `json:"received_at,omitempty"`
+	CancelledAt *time.Time `json:"cancelled_at,omitempty"`
+	RequestId   string     `json:"-"`
+	Caller      string     `json:"-"`
+}
+
+type Atp struct {
+	Sku       string     `json:"sku"`
+	Warehouse string     `json:"warehouse,omitempty"`
+	Points    []AtpPoint `json:"points"`
+}
+
+type AtpPoint struct {
+	Date      time.Time `json:"date"`
+	Inbound   int64     `json:"inbound"`
+	Available int64     `json:"avail"`
+}
+
+type MovementFilter struct {
+	Sku       string
+	Warehouse string
+	From      *time.Time
+	To        *time.Time
+	Cursor    int64
+	Limit     int64
+}
+
+type StockHistory struct {
+	Sku        string          `json:"sku"`
+	Movements  []StockMovement `json:"movements"`
+	NextCursor string          `json:"next_cursor,omitempty"`
+}
+
+type Idempotency struct {
+	Key         string
+	Fingerprint string
+	Status      int
+	ContentType string
+	Body        []byte
+	ExpiresAt   time.Time
 }
 
 type HealthStatus struct {
@@ -14,6 +14,7 @@ import (
 	mdw "github.com/pintobikez/stock-service/middleware"
 	pub "github.com/pintobikez/stock-service/publisher"
 	pb "github.com/pintobikez/stock-service/publisher/rabbitmq"
+	rea "github.com/pintobikez/stock-service/reaper"
 	rep "github.com/pintobikez/stock-service/repository"
 	mysql "github.com/pintobikez/stock-service/repository/mysql"
 	srv "github.com/pintobikez/stock-service/server"
@@ -65,6 +66,15 @@ func Handler(c *cli.Context) error {
 		}
 	}
 
+	//loads service config
+	srvConfig := new(cnfs.ServiceConfig)
+	if c.String("service-file") != "" {
+		err := uti.LoadConfigFile(c.String("service-file"), srvConfig)
+		if err != nil {
+			e.Logger.Fatal(err)
+		}
+	}
+
 	//loads db connection
 	dbConfig := new(cnfs.DatabaseConfig)
 	err := uti.LoadConfigFile(c.String("database-file"), dbConfig)
@@ -72,7 +82,7 @@ func Handler(c *cli.Context) error {
 		e.Logger.Fatal(err)
 	}
 
-	repo, err = mysql.New(dbConfig)
+	repo, err = mysql.New(dbConfig, &srvConfig.Stock)
 	if err != nil {
 		e.Logger.Fatal(err)
 	}
@@ -98,7 +108,15 @@ func Handler(c *cli.Context) error {
 	}
 	defer pubsub.Close()
 
-	apiStruct = api.New(repo, pubsub)
+	// Expired reservations cleanup
+	reaper := rea.New(repo, pubsub, &srvConfig.Reservation)
+	reaper.Start(e.Logger)
+	defer reaper.Stop()
+
+	apiStruct = api.New(repo, pubsub, srvConfig)
+
+	// Replays the responses of repeated requests on every mutating route
+	idempotency := mdw.Idempotency(repo, &srvConfig.Idempotency)
 
 	// Routes => api
 	e.GET("/health", apiStruct.HealthStatus(), mw.CORSWithConfig(
@@ -109,29 +127,247 @@ func Handler(c *cli.Context) error {
 	))
 
 	e.PUT("/stock/:sku/:action", apiStruct.PutStock(), mw.CORSWithConfig(
+		mw.CORSConfig{
+			AllowOrigins:  []string{"*"},
+			AllowMethods:  []string{echo.PUT, echo.OPTIONS, echo.HEAD},
+			ExposeHeaders: []string{"ETag"},
+		},
+	), idempotency)
+	e.PUT("/stock", apiStruct.PutStocks(), mw.CORSWithConfig(
 		mw.CORSConfig{
 			AllowOrigins: []string{"*"},
 			AllowMethods: []string{echo.PUT, echo.OPTIONS, echo.HEAD},
 		},
-	))
+	), idempotency)
 	e.PUT("/reservation/:sku", apiStruct.PutReservation(), mw.CORSWithConfig(
 		mw.CORSConfig{
 			AllowOrigins: []string{"*"},
 			AllowMethods: []string{echo.PUT, echo.OPTIONS, echo.HEAD},
 		},
+	), idempotency)
+	e.GET("/reservation/:id", apiStruct.GetReservation(), mw.CORSWithConfig(
+		mw.CORSConfig{
+			AllowOrigins: []string{"*"},
+			AllowMethods: []string{echo.GET, echo.OPTIONS, echo.HEAD},
+		},
 	))
-	e.DELETE("/reservation/:sku", apiStruct.RemoveReservation(), mw.CORSWithConfig(
+	e.DELETE("/reservation/:id", apiStruct.RemoveReservation(), mw.CORSWithConfig(
 		mw.CORSConfig{
 			AllowOrigins: []string{"*"},
 			AllowMethods: []string{echo.DELETE, echo.OPTIONS, echo.HEAD},
 		},
-	))
+	), idempotency)
+	e.POST("/reservation/:id/commit", apiStruct.CommitReservation(), mw.CORSWithConfig(
+		mw.CORSConfig{
+			AllowOrigins: []string{"*"},
+			AllowMethods: []string{echo.POST, echo.OPTIONS, echo.HEAD},
+		},
+	), idempotency)
+	e.POST("/reservations", apiStruct.PostOrder(), mw.CORSWithConfig(
+		mw.CORSConfig{
+			AllowOrigins: []string{"*"},
+			AllowMethods: []string{echo.POST, echo.OPTIONS, echo.HEAD},
+		},
+	), idempotency)
+	e.DELETE("/reservations/:order", apiStruct.DeleteOrder(), mw.CORSWithConfig(
+		mw.CORSConfig{
+			AllowOrigins: []string{"*"},
+			AllowMethods: []string{echo.DELETE, echo.OPTIONS, echo.HEAD},
+		},
+	), idempotency)
 	e.GET("/stock/:sku", apiStruct.GetStock(), mw.CORSWithConfig(
+		mw.CORSConfig{
+			AllowOrigins:  []string{"*"},
+			AllowMethods:  []string{echo.GET, echo.OPTIONS, echo.HEAD},
+			ExposeHeaders: []string{"ETag"},
+		},
+	))
+	e.GET("/stock", apiStruct.ListStock(), mw.CORSWithConfig(
+		mw.CORSConfig{
+			AllowOrigins: []string{"*"},
+			AllowMethods: []string{echo.GET, echo.OPTIONS, echo.HEAD},
+		},
+	))
+	e.POST("/stock/query", apiStruct.QueryStock(), mw.CORSWithConfig(
+		mw.CORSConfig{
+			AllowOrigins: []string{"*"},
+			AllowMethods: []string{echo.POST, echo.OPTIONS, echo.HEAD},
+		},
+	))
+	e.GET("/stock/:sku/history", apiStruct.GetStockHistory(), mw.CORSWithConfig(
+		mw.CORSConfig{
+			AllowOrigins: []string{"*"},
+			AllowMethods: []string{echo.GET, echo.OPTIONS, echo.HEAD},
+		},
+	))
+	e.PUT("/stock/:sku/safety", apiStruct.PutSafetyStock(), mw.CORSWithConfig(
+		mw.CORSConfig{
+			AllowOrigins: []string{"*"},
+			AllowMethods: []string{echo.PUT, echo.OPTIONS, echo.HEAD},
+		},
+	), idempotency)
+	e.GET("/stock/:sku/channels", apiStruct.GetChannelAllocations(), mw.CORSWithConfig(
+		mw.CORSConfig{
+			AllowOrigins: []string{"*"},
+			AllowMethods: []string{echo.GET, echo.OPTIONS, echo.HEAD},
+		},
+	))
+	e.PUT("/stock/:sku/channels", apiStruct.PutChannelAllocation(), mw.CORSWithConfig(
+		mw.CORSConfig{
+			AllowOrigins: []string{"*"},
+			AllowMethods: []string{echo.PUT, echo.OPTIONS, echo.HEAD},
+		},
+	), idempotency)
+	e.GET("/stock/:sku/lots", apiStruct.GetLots(), mw.CORSWithConfig(
+		mw.CORSConfig{
+			AllowOrigins: []string{"*"},
+			AllowMethods: []string{echo.GET, echo.OPTIONS, echo.HEAD},
+		},
+	))
+	e.PUT("/stock/:sku/lots", apiStruct.PutLot(), mw.CORSWithConfig(
+		mw.CORSConfig{
+			AllowOrigins: []string{"*"},
+			AllowMethods: []string{echo.PUT, echo.OPTIONS, echo.HEAD},
+		},
+	), idempotency)
+	e.GET("/stock/:sku/serials", apiStruct.GetSerials(), mw.CORSWithConfig(
+		mw.CORSConfig{
+			AllowOrigins: []string{"*"},
+			AllowMethods: []string{echo.GET, echo.OPTIONS, echo.HEAD},
+		},
+	))
+	e.POST("/stock/:sku/serials", apiStruct.PostSerials(), mw.CORSWithConfig(
+		mw.CORSConfig{
+			AllowOrigins: []string{"*"},
+			AllowMethods: []string{echo.POST, echo.OPTIONS, echo.HEAD},
+		},
+	), idempotency)
+	e.DELETE("/stock/:sku/serials/:serial", apiStruct.DeleteSerial(), mw.CORSWithConfig(
+		mw.CORSConfig{
+			AllowOrigins: []string{"*"},
+			AllowMethods: []string{echo.DELETE, echo.OPTIONS, echo.HEAD},
+		},
+	), idempotency)
+	e.POST("/adjustments", apiStruct.PostAdjustment(), mw.CORSWithConfig(
+		mw.CORSConfig{
+			AllowOrigins: []string{"*"},
+			AllowMethods: []string{echo.POST, echo.OPTIONS, echo.HEAD},
+		},
+	), idempotency)
+	e.GET("/adjustments/:id", apiStruct.GetAdjustment(), mw.CORSWithConfig(
+		mw.CORSConfig{
+			AllowOrigins: []string{"*"},
+			AllowMethods: []string{echo.GET, echo.OPTIONS, echo.HEAD},
+		},
+	))
+	e.GET("/warehouses", apiStruct.GetWarehouses(), mw.CORSWithConfig(
+		mw.CORSConfig{
+			AllowOrigins: []string{"*"},
+			AllowMethods: []string{echo.GET, echo.OPTIONS, echo.HEAD},
+		},
+	))
+	e.POST("/warehouses", apiStruct.PostWarehouse(), mw.CORSWithConfig(
+		mw.CORSConfig{
+			AllowOrigins: []string{"*"},
+			AllowMethods: []string{echo.POST, echo.OPTIONS, echo.HEAD},
+		},
+	), idempotency)
+	e.GET("/warehouses/:code", apiStruct.GetWarehouse(), mw.CORSWithConfig(
+		mw.CORSConfig{
+			AllowOrigins: []string{"*"},
+			AllowMethods: []string{echo.GET, echo.OPTIONS, echo.HEAD},
+		},
+	))
+	e.PUT("/warehouses/:code", apiStruct.PutWarehouse(), mw.CORSWithConfig(
+		mw.CORSConfig{
+			AllowOrigins: []string{"*"},
+			AllowMethods: []string{echo.PUT, echo.OPTIONS, echo.HEAD},
+		},
+	), idempotency)
+	e.DELETE("/warehouses/:code", apiStruct.RemoveWarehouse(), mw.CORSWithConfig(
+		mw.CORSConfig{
+			AllowOrigins: []string{"*"},
+			AllowMethods: []string{echo.DELETE, echo.OPTIONS, echo.HEAD},
+		},
+	), idempotency)
+	e.POST("/transfers", apiStruct.PostTransfer(), mw.CORSWithConfig(
+		mw.CORSConfig{
+			AllowOrigins: []string{"*"},
+			AllowMethods: []string{echo.POST, echo.OPTIONS, echo.HEAD},
+		},
+	), idempotency)
+	e.GET("/transfers/:id", apiStruct.GetTransfer(), mw.CORSWithConfig(
+		mw.CORSConfig{
+			AllowOrigins: []string{"*"},
+			AllowMethods: []string{echo.GET, echo.OPTIONS, echo.HEAD},
+		},
+	))
+	e.POST("/transfers/:id/ship", apiStruct.ShipTransfer(), mw.CORSWithConfig(
+		mw.CORSConfig{
+			AllowOrigins: []string{"*"},
+			AllowMethods: []string{echo.POST, echo.OPTIONS, echo.HEAD},
+		},
+	), idempotency)
+	e.POST("/transfers/:id/receive", apiStruct.ReceiveTransfer(), mw.CORSWithConfig(
+		mw.CORSConfig{
+			AllowOrigins: []string{"*"},
+			AllowMethods: []string{echo.POST, echo.OPTIONS, echo.HEAD},
+		},
+	), idempotency)
+	e.POST("/transfers/:id/cancel", apiStruct.CancelTransfer(), mw.CORSWithConfig(
+		mw.CORSConfig{
+			AllowOrigins: []string{"*"},
+			AllowMethods: []string{echo.POST, echo.OPTIONS, echo.HEAD},
+		},
+	), idempotency)
+	e.POST("/inbound", apiStruct.PostInbound(), mw.CORSWithConfig(
+		mw.CORSConfig{
+			AllowOrigins: []string{"*"},
+			AllowMethods: []string{echo.POST, echo.OPTIONS, echo.HEAD},
+		},
+	), idempotency)
+	e.GET("/inbound/:id", apiStruct.GetInbound(), mw.CORSWithConfig(
 		mw.CORSConfig{
 			AllowOrigins: []string{"*"},
 			AllowMethods: []string{echo.GET, echo.OPTIONS, echo.HEAD},
 		},
 	))
+	e.POST("/inbound/:id/receive", apiStruct.ReceiveInbound(), mw.CORSWithConfig(
+		mw.CORSConfig{
+			AllowOrigins: []string{"*"},
+			AllowMethods: []string{echo.POST, echo.OPTIONS, echo.HEAD},
+		},
+	), idempotency)
+	e.POST("/inbound/:id/cancel", apiStruct.CancelInbound(), mw.CORSWithConfig(
+		mw.CORSConfig{
+			AllowOrigins: []string{"*"},
+			AllowMethods: []string{echo.POST, echo.OPTIONS, echo.HEAD},
+		},
+	), idempotency)
+	e.GET("/skus/:sku", apiStruct.GetSkuSettings(), mw.CORSWithConfig(
+		mw.CORSConfig{
+			AllowOrigins: []string{"*"},
+			AllowMethods: []string{echo.GET, echo.OPTIONS, echo.HEAD},
+		},
+	))
+	e.PUT("/skus/:sku", apiStruct.PutSkuSettings(), mw.CORSWithConfig(
+		mw.CORSConfig{
+			AllowOrigins: []string{"*"},
+			AllowMethods: []string{echo.PUT, echo.OPTIONS, echo.HEAD},
+		},
+	), idempotency)
+	e.GET("/skus/:sku/bundle", apiStruct.GetBundle(), mw.CORSWithConfig(
+		mw.CORSConfig{
+			AllowOrigins: []string{"*"},
+			AllowMethods: []string{echo.GET, echo.OPTIONS, echo.HEAD},
+		},
+	))
+	e.PUT("/skus/:sku/bundle", apiStruct.PutBundle(), mw.CORSWithConfig(
+		mw.CORSConfig{
+			AllowOrigins: []string{"*"},
+			AllowMethods: []string{echo.PUT, echo.OPTIONS, echo.HEAD},
+		},
+	), idempotency)
 
 	if c.String("revision-file") != "" {
 		e.File("/rev.txt", c.String("revision-file"))
@@ -157,12 +393,12 @@ func Handler(c *cli.Context) error {
 
 	go func() {
 		if err := start(e, c); err != nil {
-			colorer.Printf(color.Red("⇛ shutting down the server\n"))
+			colorer.Print(color.Red("⇛ shutting down the server\n"))
 		}
 	}()
 
 	// Graceful Shutdown
-	quit := make(chan os.Signal)
+	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, os.Interrupt)
 	<-quit
 
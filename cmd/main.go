@@ -59,6 +59,12 @@ func main() {
 			Usage:  "Pubsub configuration used by Stock Service to connect to the Pubsub service",
 			EnvVar: "PUBLISHER_FILE",
 		},
+		cli.StringFlag{
+			Name:   "service-file, s",
+			Value:  "",
+			Usage:  "Service configuration like the reservations time to live",
+			EnvVar: "SERVICE_FILE",
+		},
 		cli.StringFlag{
 			Name:   "auth-file, a",
 			Value:  "",
@@ -13,6 +13,38 @@ type DatabaseConfig struct {
 	Schema string `yaml:"schema,omitempty"`
 }
 
+type ServiceConfig struct {
+	Stock       StockConfig       `yaml:"stock,omitempty"`
+	Reservation ReservationConfig `yaml:"reservation,omitempty"`
+	Idempotency IdempotencyConfig `yaml:"idempotency,omitempty"`
+	Adjustment  AdjustmentConfig  `yaml:"adjustment,omitempty"`
+	Bulk        BulkConfig        `yaml:"bulk,omitempty"`
+}
+
+type StockConfig struct {
+	SafetyStock int64 `yaml:"safety_stock,omitempty"`
+}
+
+type ReservationConfig struct {
+	Ttl      int64  `yaml:"ttl,omitempty"`
+	Interval int64  `yaml:"interval,omitempty"`
+	Batch    int64  `yaml:"batch,omitempty"`
+	Strategy string `yaml:"strategy,omitempty"`
+}
+
+type IdempotencyConfig struct {
+	Window int64 `yaml:"window,omitempty"`
+}
+
+type AdjustmentConfig struct {
+	Reasons []string `yaml:"reasons,omitempty"`
+}
+
+type BulkConfig struct {
+	Chunk   int64 `yaml:"chunk,omitempty"`
+	MaxRows int64 `yaml:"max_rows,omitempty"`
+}
+
 type PublisherConfig struct {
 	Host     string `yaml:"host,omitempty"`
 	User     string `yaml:"user,omitempty"`
@@ -2,18 +2,187 @@ CREATE DATABASE stockservice;
 
 USE stockservice;
 
+CREATE TABLE IF NOT EXISTS `warehouse` (
+  `code` varchar(45) CHARACTER SET utf8 COLLATE utf8_bin NOT NULL,
+  `name` varchar(128) NOT NULL,
+  `active` tinyint(1) NOT NULL DEFAULT '1',
+  `timezone` varchar(64) NOT NULL DEFAULT 'UTC',
+  `priority` int(11) NOT NULL DEFAULT '0',
+  `safety_stock` int(6) unsigned DEFAULT NULL,
+  `address` varchar(255) DEFAULT NULL,
+  `created_at` datetime DEFAULT CURRENT_TIMESTAMP,
+  `updated_at` datetime DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`code`),
+  KEY `wh_priority` (`priority`,`code`) USING BTREE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
 CREATE TABLE IF NOT EXISTS `stock` (
   `sku` varchar(16) NOT NULL,
   `warehouse` varchar(45) NOT NULL,
   `quantity` int(6) NOT NULL DEFAULT '0',
+  `version` int(11) unsigned NOT NULL DEFAULT '1',
+  `safety_stock` int(6) unsigned DEFAULT NULL,
   `updated_at` datetime DEFAULT CURRENT_TIMESTAMP,
-  KEY `skuWarehouse` (`sku`,`warehouse`) USING BTREE
+  UNIQUE KEY `skuWarehouse` (`sku`,`warehouse`) USING BTREE,
+  KEY `stock_warehouse_sku` (`warehouse`,`sku`) USING BTREE,
+  KEY `stock_updated_at` (`updated_at`,`sku`,`warehouse`) USING BTREE,
+  KEY `stock_warehouse_updated_at` (`warehouse`,`updated_at`) USING BTREE
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8;
 
 CREATE TABLE IF NOT EXISTS `reservation` (
+  `id` int(11) unsigned NOT NULL AUTO_INCREMENT,
   `sku` varchar(16) NOT NULL,
   `warehouse` varchar(45) NOT NULL,
+  `quantity` int(6) NOT NULL DEFAULT '1',
+  `reference` varchar(64) DEFAULT NULL,
+  `channel` varchar(32) DEFAULT NULL,
+  `preorder` tinyint(1) NOT NULL DEFAULT '0',
+  `expires_at` datetime DEFAULT NULL,
   `created_at` datetime DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
   KEY `skuWarehouse2` (`warehouse`,`sku`) USING BTREE,
-  KEY `res_create_at` (`created_at`) USING BTREE
+  KEY `res_create_at` (`created_at`) USING BTREE,
+  KEY `res_reference` (`reference`) USING BTREE,
+  KEY `res_expires_at` (`expires_at`) USING BTREE,
+  KEY `res_sku_warehouse_expires_at` (`sku`,`warehouse`,`expires_at`,`quantity`) USING BTREE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+CREATE TABLE IF NOT EXISTS `stock_movement` (
+  `id` bigint(20) unsigned NOT NULL AUTO_INCREMENT,
+  `sku` varchar(16) NOT NULL,
+  `warehouse` varchar(45) NOT NULL,
+  `action` varchar(16) NOT NULL,
+  `delta` int(11) NOT NULL,
+  `quantity` int(11) NOT NULL,
+  `reserved` int(11) NOT NULL,
+  `adjustment_id` bigint(20) unsigned DEFAULT NULL,
+  `transfer_id` bigint(20) unsigned DEFAULT NULL,
+  `inbound_id` bigint(20) unsigned DEFAULT NULL,
+  `request_id` varchar(64) DEFAULT NULL,
+  `caller` varchar(64) DEFAULT NULL,
+  `created_at` datetime NOT NULL,
+  PRIMARY KEY (`id`),
+  KEY `mov_sku_created_at` (`sku`,`created_at`) USING BTREE,
+  KEY `mov_sku_warehouse_created_at` (`sku`,`warehouse`,`created_at`) USING BTREE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+CREATE TABLE IF NOT EXISTS `adjustment` (
+  `id` bigint(20) unsigned NOT NULL AUTO_INCREMENT,
+  `reason` varchar(32) NOT NULL,
+  `note` varchar(255) DEFAULT NULL,
+  `request_id` varchar(64) DEFAULT NULL,
+  `caller` varchar(64) DEFAULT NULL,
+  `created_at` datetime NOT NULL,
+  PRIMARY KEY (`id`),
+  KEY `adj_reason_created_at` (`reason`,`created_at`) USING BTREE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+CREATE TABLE IF NOT EXISTS `adjustment_line` (
+  `adjustment_id` bigint(20) unsigned NOT NULL,
+  `sku` varchar(16) NOT NULL,
+  `warehouse` varchar(45) NOT NULL,
+  `delta` int(11) NOT NULL,
+  `quantity` int(11) NOT NULL,
+  PRIMARY KEY (`adjustment_id`,`sku`,`warehouse`),
+  KEY `adjl_sku_warehouse` (`sku`,`warehouse`) USING BTREE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+CREATE TABLE IF NOT EXISTS `transfer` (
+  `id` bigint(20) unsigned NOT NULL AUTO_INCREMENT,
+  `sku` varchar(16) NOT NULL,
+  `source` varchar(45) NOT NULL,
+  `destination` varchar(45) NOT NULL,
+  `quantity` int(6) NOT NULL,
+  `status` varchar(16) NOT NULL,
+  `reference` varchar(64) DEFAULT NULL,
+  `request_id` varchar(64) DEFAULT NULL,
+  `caller` varchar(64) DEFAULT NULL,
+  `created_at` datetime NOT NULL,
+  `shipped_at` datetime DEFAULT NULL,
+  `received_at` datetime DEFAULT NULL,
+  `cancelled_at` datetime DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `tr_sku_status` (`sku`,`status`) USING BTREE,
+  KEY `tr_reference` (`reference`) USING BTREE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+CREATE TABLE IF NOT EXISTS `inbound` (
+  `id` bigint(20) unsigned NOT NULL AUTO_INCREMENT,
+  `sku` varchar(16) NOT NULL,
+  `warehouse` varchar(45) NOT NULL,
+  `quantity` int(6) NOT NULL,
+  `expected_at` datetime NOT NULL,
+  `status` varchar(16) NOT NULL,
+  `reference` varchar(64) DEFAULT NULL,
+  `request_id` varchar(64) DEFAULT NULL,
+  `caller` varchar(64) DEFAULT NULL,
+  `created_at` datetime NOT NULL,
+  `received_at` datetime DEFAULT NULL,
+  `cancelled_at` datetime DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `in_sku_status_expected_at` (`sku`,`status`,`expected_at`) USING BTREE,
+  KEY `in_reference` (`reference`) USING BTREE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+CREATE TABLE IF NOT EXISTS `channel_allocation` (
+  `sku` varchar(16) NOT NULL,
+  `warehouse` varchar(45) NOT NULL,
+  `channel` varchar(32) NOT NULL,
+  `quantity` int(6) unsigned DEFAULT NULL,
+  `percentage` tinyint(3) unsigned DEFAULT NULL,
+  `updated_at` datetime DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`sku`,`warehouse`,`channel`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+CREATE TABLE IF NOT EXISTS `stock_lot` (
+  `sku` varchar(16) NOT NULL,
+  `warehouse` varchar(45) NOT NULL,
+  `lot` varchar(64) NOT NULL,
+  `expires_at` datetime NOT NULL,
+  `quantity` int(6) unsigned NOT NULL DEFAULT '0',
+  `updated_at` datetime DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`sku`,`warehouse`,`lot`),
+  KEY `in_sku_warehouse_expires_at` (`sku`,`warehouse`,`expires_at`) USING BTREE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+CREATE TABLE IF NOT EXISTS `stock_serial` (
+  `sku` varchar(16) NOT NULL,
+  `warehouse` varchar(45) NOT NULL,
+  `serial` varchar(64) NOT NULL,
+  `reservation_id` int(11) unsigned DEFAULT NULL,
+  `created_at` datetime DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`sku`,`serial`),
+  KEY `in_sku_warehouse` (`sku`,`warehouse`) USING BTREE,
+  KEY `in_reservation_id` (`reservation_id`) USING BTREE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+CREATE TABLE IF NOT EXISTS `sku_settings` (
+  `sku` varchar(16) NOT NULL,
+  `preorder` tinyint(1) NOT NULL DEFAULT '0',
+  `backorder` varchar(16) NOT NULL DEFAULT 'disallowed',
+  `backorder_limit` int(6) unsigned NOT NULL DEFAULT '0',
+  `serialized` tinyint(1) NOT NULL DEFAULT '0',
+  `updated_at` datetime DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`sku`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+CREATE TABLE IF NOT EXISTS `bundle_component` (
+  `bundle` varchar(16) NOT NULL,
+  `component` varchar(16) NOT NULL,
+  `quantity` int(6) unsigned NOT NULL DEFAULT '1',
+  `updated_at` datetime DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`bundle`,`component`),
+  KEY `in_component` (`component`) USING BTREE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+CREATE TABLE IF NOT EXISTS `idempotency` (
+  `idem_key` varchar(64) NOT NULL,
+  `fingerprint` char(64) NOT NULL,
+  `status` smallint(3) NOT NULL DEFAULT '0',
+  `content_type` varchar(64) DEFAULT NULL,
+  `body` mediumblob,
+  `expires_at` datetime NOT NULL,
+  `created_at` datetime DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`idem_key`),
+  KEY `idem_expires_at` (`expires_at`) USING BTREE
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8;
\ No newline at end of file
@@ -0,0 +1,110 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/labstack/echo"
+	strut "github.com/pintobikez/stock-service/api/structures"
+	cnfs "github.com/pintobikez/stock-service/config/structures"
+	repo "github.com/pintobikez/stock-service/repository"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+const (
+	HeaderIdempotencyKey      = "Idempotency-Key"
+	HeaderIdempotencyReplayed = "Idempotency-Replayed"
+
+	DefaultIdempotencyWindow = 86400
+)
+
+// Writer that keeps a copy of the response body
+type bodyRecorder struct {
+	http.ResponseWriter
+	body *bytes.Buffer
+}
+
+func (w *bodyRecorder) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+// Idempotency Middleware
+// Stores the response of every request sent with an Idempotency-Key header and replays it when the key is repeated
+func Idempotency(rp repo.Repository, cnfg *cnfs.IdempotencyConfig) echo.MiddlewareFunc {
+	window := time.Duration(DefaultIdempotencyWindow) * time.Second
+	if cnfg != nil && cnfg.Window > 0 {
+		window = time.Duration(cnfg.Window) * time.Second
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			key := c.Request().Header.Get(HeaderIdempotencyKey)
+			if key == "" {
+				return next(c)
+			}
+			if len(key) > 64 {
+				return c.JSON(http.StatusBadRequest, &strut.ErrResponse{strut.ErrContent{http.StatusBadRequest, "Idempotency-Key is longer than 64 characters"}})
+			}
+
+			body, err := ioutil.ReadAll(c.Request().Body)
+			if err != nil {
+				return c.JSON(http.StatusBadRequest, &strut.ErrResponse{strut.ErrContent{http.StatusBadRequest, "Request body could not be read"}})
+			}
+			c.Request().Body = ioutil.NopCloser(bytes.NewReader(body))
+
+			sum := sha256.Sum256(append([]byte(c.Request().Method+" "+c.Request().URL.Path+"\n"), body...))
+			fingerprint := hex.EncodeToString(sum[:])
+
+			found, err := rp.FindIdempotency(key)
+			if err != nil {
+				return c.JSON(http.StatusInternalServerError, &strut.ErrResponse{strut.ErrContent{http.StatusInternalServerError, err.Error()}})
+			}
+
+			if found.Key != "" {
+				if found.Fingerprint != fingerprint {
+					return c.JSON(http.StatusUnprocessableEntity, &strut.ErrResponse{strut.ErrContent{http.StatusUnprocessableEntity, "Idempotency-Key was already used with a different request"}})
+				}
+				if found.Status == 0 {
+					return c.JSON(http.StatusConflict, &strut.ErrResponse{strut.ErrContent{http.StatusConflict, "A request with the same Idempotency-Key is in progress"}})
+				}
+
+				c.Response().Header().Set(HeaderIdempotencyReplayed, "true")
+				if len(found.Body) == 0 {
+					return c.NoContent(found.Status)
+				}
+				return c.Blob(found.Status, found.ContentType, found.Body)
+			}
+
+			i := &strut.Idempotency{Key: key, Fingerprint: fingerprint, ExpiresAt: time.Now().UTC().Add(window)}
+			if err := rp.InsertIdempotency(i); err != nil {
+				if err.Error() == "409" {
+					return c.JSON(http.StatusConflict, &strut.ErrResponse{strut.ErrContent{http.StatusConflict, "A request with the same Idempotency-Key is in progress"}})
+				}
+				return c.JSON(http.StatusInternalServerError, &strut.ErrResponse{strut.ErrContent{http.StatusInternalServerError, err.Error()}})
+			}
+
+			rec := &bodyRecorder{ResponseWriter: c.Response().Writer, body: new(bytes.Buffer)}
+			c.Response().Writer = rec
+
+			err = next(c)
+
+			// server errors are not kept so the request can be retried
+			if err != nil || c.Response().Status >= http.StatusInternalServerError {
+				rp.DeleteIdempotency(key)
+				return err
+			}
+
+			i.Status = c.Response().Status
+			i.ContentType = c.Response().Header().Get(echo.HeaderContentType)
+			i.Body = rec.body.Bytes()
+			if err := rp.UpdateIdempotency(i); err != nil {
+				c.Logger().Errorf("Could not store the response of Idempotency-Key %s: %s", key, err.Error())
+			}
+
+			return nil
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package middleware
+
+import (
+	"encoding/json"
+	"github.com/labstack/echo"
+	gen "github.com/pintobikez/stock-service/api/structures"
+	mock "github.com/pintobikez/stock-service/mocks"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+/*
+Tests for Idempotency middleware
+*/
+type idempotencyProvider struct {
+	key      string
+	json     string
+	result   int
+	calls    int
+	replayed string
+}
+
+// every request of a provider runs against the same repository, in order
+var testIdempotencyProvider = [][]idempotencyProvider{
+	{
+		{"", `{"quantity":1}`, http.StatusOK, 1, ""}, // no key, handler runs
+		{"", `{"quantity":1}`, http.StatusOK, 2, ""}, // no key, handler runs again
+	},
+	{
+		{"K1", `{"quantity":1}`, http.StatusOK, 1, ""},                  // first request, handler runs
+		{"K1", `{"quantity":1}`, http.StatusOK, 1, "true"},              // repeated request replayed
+		{"K1", `{"quantity":2}`, http.StatusUnprocessableEntity, 1, ""}, // same key with a different body
+	},
+	{
+		{"FAIL", `{"quantity":1}`, http.StatusInternalServerError, 1, ""}, // server error is not kept
+		{"FAIL", `{"quantity":1}`, http.StatusInternalServerError, 2, ""}, // so the request runs again
+	},
+	{
+		{"ERR", `{"quantity":1}`, http.StatusInternalServerError, 0, ""},  // RepoFindIdempotency error
+		{"ERRI", `{"quantity":1}`, http.StatusInternalServerError, 0, ""}, // RepoInsertIdempotency error
+		{strings.Repeat("K", 65), `{}`, http.StatusBadRequest, 0, ""},     // key too long
+	},
+}
+
+func TestIdempotency(t *testing.T) {
+	for _, requests := range testIdempotencyProvider {
+		r := new(mock.RepositoryMock)
+		calls := 0
+
+		// Setup
+		e := echo.New()
+		e.PUT("/stock/:sku", func(c echo.Context) error {
+			calls++
+			if c.Request().Header.Get(HeaderIdempotencyKey) == "FAIL" {
+				return c.JSON(http.StatusInternalServerError, &gen.ErrResponse{gen.ErrContent{1004, "Erro"}})
+			}
+			return c.JSON(http.StatusOK, map[string]int{"calls": calls})
+		}, Idempotency(r, nil))
+
+		for _, pair := range requests {
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest("PUT", "/stock/SCC", strings.NewReader(pair.json))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set(HeaderIdempotencyKey, pair.key)
+			e.ServeHTTP(rec, req)
+
+			assert.Equal(t, pair.result, rec.Code, "Http Code doesn't match")
+			assert.Equal(t, pair.calls, calls, "Handler calls don't match")
+			assert.Equal(t, pair.replayed, rec.Header().Get(HeaderIdempotencyReplayed), "Replayed header doesn't match")
+
+			if pair.replayed != "" {
+				val := make(map[string]int)
+				_ = json.Unmarshal([]byte(rec.Body.String()), &val)
+				assert.Equal(t, 1, val["calls"], "Replayed body doesn't match")
+			}
+		}
+	}
+}
@@ -3,18 +3,44 @@ package mocks
 import (
 	"fmt"
 	gen "github.com/pintobikez/stock-service/api/structures"
+	repo "github.com/pintobikez/stock-service/repository"
+	"sort"
+	"strings"
+	"time"
 )
 
 // MOCK STRUCTURES DEFINITION
 type (
 	RepositoryMock struct {
-		Iserror bool
+		Iserror    bool
+		Expired    int64
+		FailAfter  int64
+		Batches    int64
+		KeysReaped bool
+		Keys       map[string]*gen.Idempotency
+		Movements  []gen.StockMovement
+		Warehouses map[string]*gen.Warehouse
 	}
 	PublisherMock struct {
-		Iserror bool
+		Iserror   bool
+		Published []string
 	}
 )
 
+// Stock listed by the mock ListStock
+var listedStock = []gen.StockItem{
+	{Sku: "SCA", Warehouse: "A", Quantity: 0, Available: 0, UpdatedAt: mockTime(5)},
+	{Sku: "SCC", Warehouse: "A", Quantity: 10, Reserved: 2, Available: 8, UpdatedAt: mockTime(1)},
+	{Sku: "SCC", Warehouse: "B", Quantity: 3, Available: 3, UpdatedAt: mockTime(4)},
+	{Sku: "SCD", Warehouse: "A", Quantity: 7, Available: 7, UpdatedAt: mockTime(2)},
+	{Sku: "XYZ", Warehouse: "B", Quantity: 1, Available: 1, UpdatedAt: mockTime(3)},
+}
+
+func mockTime(day int) *time.Time {
+	t := time.Date(2017, 1, day, 0, 0, 0, 0, time.UTC)
+	return &t
+}
+
 // MOCK Repository - START
 func (c *RepositoryMock) Connect() error {
 	return nil
@@ -35,12 +61,182 @@ func (c *RepositoryMock) FindSku(sku string) (*gen.SkuResponse, error) {
 	if sku == "SCA" || sku == "SCCC" {
 		return new(gen.SkuResponse), fmt.Errorf("Erro")
 	}
-	return &gen.SkuResponse{Sku: sku}, nil
+	if b, _ := c.FindBundle(sku); len(b.Components) > 0 {
+		components := make(map[string]*gen.SkuResponse)
+		for _, comp := range b.Components {
+			components[comp.Sku], _ = c.FindSku(comp.Sku)
+		}
+		return repo.BundleStock(b, components), nil
+	}
+	if sku == "SCH" {
+		resp := &gen.SkuResponse{Sku: sku, Values: []gen.SkuValues{{Quantity: 10, Warehouse: "A", Version: 1, RawAvailable: 10, Available: 10}, {Quantity: 5, Warehouse: "B", Version: 1, RawAvailable: 5, Available: 5}}, RawAvailable: 15, Available: 15}
+		allocations, _ := c.FindChannelAllocations(sku)
+		repo.ApplyChannels(resp, allocations)
+		return resp, nil
+	}
+	if sku == "SCM" {
+		return &gen.SkuResponse{Sku: sku, Values: []gen.SkuValues{{Quantity: 3, Warehouse: "A", Version: 1, RawAvailable: 3, Available: 3}, {Quantity: 4, Warehouse: "B", Version: 1, RawAvailable: 4, Available: 4}}, RawAvailable: 7, Available: 7}, nil
+	}
+	return &gen.SkuResponse{Sku: sku, Values: []gen.SkuValues{{Quantity: 10, Warehouse: "A", Version: 3, RawAvailable: 10, Available: 10}}, RawAvailable: 10, Available: 10}, nil
+}
+func (c *RepositoryMock) FindSkus(skus []string) (map[string]*gen.SkuResponse, error) {
+	found := make(map[string]*gen.SkuResponse)
+	for _, sku := range skus {
+		if sku == "SAC" {
+			return nil, fmt.Errorf("Erro")
+		}
+		if sku != "SCA" {
+			found[sku] = &gen.SkuResponse{Sku: sku, Values: []gen.SkuValues{{Quantity: 10, Warehouse: "A", Version: 3}}, Available: 10}
+		}
+	}
+	return found, nil
+}
+func (c *RepositoryMock) UpdateSafetyStock(s *gen.SafetyStock) error {
+	if s.Sku == "SAC" {
+		return fmt.Errorf("Erro")
+	}
+	if s.Sku == "SCA" {
+		return fmt.Errorf("404")
+	}
+	return nil
+}
+func (c *RepositoryMock) FindChannelAllocations(sku string) ([]gen.ChannelAllocation, error) {
+	if sku == "SAC" {
+		return nil, fmt.Errorf("Erro")
+	}
+	if sku == "SCH" {
+		web, marketplace := int64(4), int64(20)
+		return []gen.ChannelAllocation{
+			{Sku: sku, Warehouse: "A", Channel: "marketplace", Percentage: &marketplace, Allocated: 2},
+			{Sku: sku, Warehouse: "A", Channel: "web", Quantity: &web, Allocated: 4, Reserved: 1},
+		}, nil
+	}
+	return []gen.ChannelAllocation{}, nil
+}
+func (c *RepositoryMock) UpdateChannelAllocation(ch *gen.ChannelAllocation) error {
+	if ch.Sku == "SAC" {
+		return fmt.Errorf("Erro")
+	}
+	if ch.Sku == "SCA" {
+		return fmt.Errorf("404")
+	}
+	return nil
+}
+func (c *RepositoryMock) FindLots(sku string) ([]gen.Lot, error) {
+	if sku == "SAC" {
+		return nil, fmt.Errorf("Erro")
+	}
+	if sku == "SLT" {
+		fresh, old := time.Now().UTC().AddDate(0, 1, 0), time.Now().UTC().AddDate(0, -1, 0)
+		return []gen.Lot{
+			{Sku: sku, Warehouse: "A", Lot: "L2", ExpiresAt: &old, Quantity: 2, Expired: true},
+			{Sku: sku, Warehouse: "A", Lot: "L1", ExpiresAt: &fresh, Quantity: 8, Reserved: 3},
+		}, nil
+	}
+	return []gen.Lot{}, nil
+}
+func (c *RepositoryMock) UpdateLot(l *gen.Lot) error {
+	if l.Sku == "SAC" {
+		return fmt.Errorf("Erro")
+	}
+	if l.Sku == "SCF" {
+		return fmt.Errorf("409")
+	}
+	return nil
+}
+func (c *RepositoryMock) FindSerials(sku string, warehouse string) ([]gen.Serial, error) {
+	if sku == "SAC" {
+		return nil, fmt.Errorf("Erro")
+	}
+	if sku == "SSN" {
+		serials := []gen.Serial{
+			{Sku: sku, Warehouse: "A", Serial: "SN1", ReservationId: 6},
+			{Sku: sku, Warehouse: "A", Serial: "SN2"},
+			{Sku: sku, Warehouse: "B", Serial: "SN3"},
+		}
+		found := []gen.Serial{}
+		for _, s := range serials {
+			if warehouse == "" || s.Warehouse == warehouse {
+				found = append(found, s)
+			}
+		}
+		return found, nil
+	}
+	return []gen.Serial{}, nil
+}
+func (c *RepositoryMock) InsertSerials(s *gen.SerialRegistration) error {
+	switch s.Sku {
+	case "SSNE":
+		return fmt.Errorf("Erro")
+	case "SSNC":
+		return fmt.Errorf("409")
+	}
+	return nil
+}
+func (c *RepositoryMock) DeleteSerial(s *gen.Serial) error {
+	switch s.Serial {
+	case "ERR":
+		return fmt.Errorf("Erro")
+	case "NONE":
+		return fmt.Errorf("404")
+	case "HELD":
+		return fmt.Errorf("409")
+	}
+	s.Warehouse = "A"
+	return nil
+}
+func (c *RepositoryMock) FindSkuAsOf(sku string, asOf time.Time) (*gen.SkuResponse, error) {
+	return repo.SkuAsOf(sku, c.Movements, asOf)
+}
+func (c *RepositoryMock) ListStock(f *gen.StockFilter) ([]gen.StockItem, error) {
+	if f.Warehouse == "ERR" {
+		return nil, fmt.Errorf("Erro")
+	}
+
+	// key compares two items by the sort of the filter, then by sku and warehouse
+	key := func(i gen.StockItem) string {
+		switch f.Sort {
+		case gen.SortUpdatedAt:
+			return i.UpdatedAt.Format(time.RFC3339) + "|" + i.Sku + "|" + i.Warehouse
+		case gen.SortAvail:
+			return fmt.Sprintf("%010d|%s|%s", i.Available, i.Sku, i.Warehouse)
+		}
+		return i.Sku + "|" + i.Warehouse
+	}
+	before := func(a, b gen.StockItem) bool {
+		if f.Desc {
+			return key(a) > key(b)
+		}
+		return key(a) < key(b)
+	}
+
+	items := []gen.StockItem{}
+	for _, i := range listedStock {
+		if (f.Warehouse != "" && i.Warehouse != f.Warehouse) ||
+			!strings.HasPrefix(i.Sku, f.SkuPrefix) ||
+			(f.MinAvail != nil && i.Available < *f.MinAvail) ||
+			(f.MaxAvail != nil && i.Available > *f.MaxAvail) ||
+			(f.UpdatedFrom != nil && i.UpdatedAt.Before(*f.UpdatedFrom)) ||
+			(f.UpdatedTo != nil && i.UpdatedAt.After(*f.UpdatedTo)) ||
+			(f.After != nil && !before(*f.After, i)) {
+			continue
+		}
+		items = append(items, i)
+	}
+
+	sort.Slice(items, func(a, b int) bool { return before(items[a], items[b]) })
+	if int64(len(items)) > f.Limit {
+		items = items[:f.Limit]
+	}
+	return items, nil
 }
 func (c *RepositoryMock) UpdateSku(s *gen.Sku) (int64, error) {
 	if s.Sku == "SC" {
 		return 0, fmt.Errorf("Erro")
 	}
+	if s.Version == 99 {
+		return 0, fmt.Errorf("412")
+	}
 	return 1, nil
 }
 func (c *RepositoryMock) InsertSku(s *gen.Sku) error {
@@ -52,12 +248,359 @@ func (c *RepositoryMock) InsertSku(s *gen.Sku) error {
 	}
 	return nil
 }
-func (c *RepositoryMock) InsertReservation(re *gen.Reservation) error {
-	if re.Sku == "SC" {
+func (c *RepositoryMock) FindMovements(f *gen.MovementFilter) ([]gen.StockMovement, error) {
+	if f.Sku == "SAC" {
+		return nil, fmt.Errorf("Erro")
+	}
+	movements := []gen.StockMovement{}
+	for _, id := range []int64{30, 20, 10} {
+		if int64(len(movements)) < f.Limit && (f.Cursor == 0 || id < f.Cursor) {
+			movements = append(movements, gen.StockMovement{Id: id, Sku: f.Sku, Warehouse: "A", Action: gen.ActionAdd, Delta: 1})
+		}
+	}
+	return movements, nil
+}
+func (c *RepositoryMock) FindAdjustment(id int64) (*gen.Adjustment, error) {
+	switch id {
+	case 1:
+		return new(gen.Adjustment), fmt.Errorf("Erro")
+	case 2:
+		return &gen.Adjustment{}, nil
+	}
+	return &gen.Adjustment{Id: id, Reason: "damage", Lines: []gen.AdjustmentLine{{Sku: "SCC", Warehouse: "A", Delta: -1, Quantity: 9}}}, nil
+}
+func (c *RepositoryMock) InsertAdjustment(a *gen.Adjustment) (int64, error) {
+	for i, l := range a.Lines {
+		if l.Sku == "SAC" {
+			return 0, fmt.Errorf("Erro")
+		}
+		if l.Sku == "SCN" {
+			return 0, fmt.Errorf("409")
+		}
+		if l.Sku == "SCW" {
+			return 0, fmt.Errorf("404")
+		}
+		a.Lines[i].Quantity = 10 + l.Delta
+	}
+	a.Id = 1
+	return 1, nil
+}
+func (c *RepositoryMock) FindWarehouses() ([]gen.Warehouse, error) {
+	if c.Iserror {
+		return nil, fmt.Errorf("Erro")
+	}
+	// without registered warehouses A and B are active
+	if c.Warehouses == nil {
+		return []gen.Warehouse{{Code: "A", Name: "A", Active: true, Timezone: "UTC"}, {Code: "B", Name: "B", Active: true, Timezone: "UTC"}}, nil
+	}
+	warehouses := []gen.Warehouse{}
+	for _, w := range c.Warehouses {
+		warehouses = append(warehouses, *w)
+	}
+	sort.Slice(warehouses, func(i, j int) bool {
+		if warehouses[i].Priority != warehouses[j].Priority {
+			return warehouses[i].Priority < warehouses[j].Priority
+		}
+		return warehouses[i].Code < warehouses[j].Code
+	})
+	return warehouses, nil
+}
+func (c *RepositoryMock) FindWarehouse(code string) (*gen.Warehouse, error) {
+	if w, ok := c.Warehouses[code]; ok {
+		return w, nil
+	}
+	switch code {
+	case "ERR":
+		return new(gen.Warehouse), fmt.Errorf("Erro")
+	case "X":
+		return &gen.Warehouse{}, nil
+	case "I":
+		return &gen.Warehouse{Code: code, Name: code, Timezone: "UTC"}, nil
+	}
+	// without registered warehouses every other code is an active warehouse
+	if c.Warehouses == nil {
+		return &gen.Warehouse{Code: code, Name: code, Active: true, Timezone: "UTC"}, nil
+	}
+	return &gen.Warehouse{}, nil
+}
+func (c *RepositoryMock) InsertWarehouse(w *gen.Warehouse) error {
+	if w.Code == "ERR" {
+		return fmt.Errorf("Erro")
+	}
+	if _, ok := c.Warehouses[w.Code]; ok {
+		return fmt.Errorf("409")
+	}
+	if c.Warehouses == nil {
+		c.Warehouses = make(map[string]*gen.Warehouse)
+	}
+	c.Warehouses[w.Code] = w
+	return nil
+}
+func (c *RepositoryMock) UpdateWarehouse(w *gen.Warehouse) error {
+	if w.Code == "ERR" {
+		return fmt.Errorf("Erro")
+	}
+	if _, ok := c.Warehouses[w.Code]; !ok {
+		return fmt.Errorf("404")
+	}
+	c.Warehouses[w.Code] = w
+	return nil
+}
+func (c *RepositoryMock) DeleteWarehouse(code string) error {
+	if code == "ERR" {
 		return fmt.Errorf("Erro")
 	}
+	if code == "A" {
+		return fmt.Errorf("409")
+	}
+	if _, ok := c.Warehouses[code]; !ok {
+		return fmt.Errorf("404")
+	}
+	delete(c.Warehouses, code)
 	return nil
 }
+func (c *RepositoryMock) FindTransfer(id int64) (*gen.Transfer, error) {
+	switch id {
+	case 1:
+		return new(gen.Transfer), fmt.Errorf("Erro")
+	case 2:
+		return &gen.Transfer{}, nil
+	case 3:
+		return &gen.Transfer{Id: id, Sku: "SC", Source: "A", Destination: "B", Quantity: 1, Status: gen.TransferRequested}, nil
+	case 4:
+		return &gen.Transfer{Id: id, Sku: "SCF", Source: "A", Destination: "B", Quantity: 50, Status: gen.TransferRequested}, nil
+	case 5:
+		return &gen.Transfer{Id: id, Sku: "SCC", Source: "A", Destination: "B", Quantity: 1, Status: gen.TransferReceived}, nil
+	case 6:
+		return &gen.Transfer{Id: id, Sku: "SCD", Source: "A", Destination: "B", Quantity: 1, Status: gen.TransferShipped}, nil
+	case 7:
+		return &gen.Transfer{Id: id, Sku: "SCC", Source: "A", Destination: "B", Quantity: 1, Status: gen.TransferShipped}, nil
+	}
+	return &gen.Transfer{Id: id, Sku: "SCC", Source: "A", Destination: "B", Quantity: 1, Status: gen.TransferRequested}, nil
+}
+func (c *RepositoryMock) InsertTransfer(t *gen.Transfer) (int64, error) {
+	if t.Sku == "SC" {
+		return 0, fmt.Errorf("Erro")
+	}
+	return 1, nil
+}
+func (c *RepositoryMock) ShipTransfer(t *gen.Transfer) error {
+	return c.moveTransfer(t, gen.TransferShipped, gen.TransferRequested)
+}
+func (c *RepositoryMock) ReceiveTransfer(t *gen.Transfer) error {
+	return c.moveTransfer(t, gen.TransferReceived, gen.TransferShipped)
+}
+func (c *RepositoryMock) CancelTransfer(t *gen.Transfer) error {
+	return c.moveTransfer(t, gen.TransferCancelled, gen.TransferRequested, gen.TransferShipped)
+}
+func (c *RepositoryMock) moveTransfer(t *gen.Transfer, status string, from ...string) error {
+	if t.Sku == "SC" {
+		return fmt.Errorf("Erro")
+	}
+	for _, s := range from {
+		if t.Status == s {
+			if status == gen.TransferShipped && t.Sku == "SCF" {
+				return fmt.Errorf("409")
+			}
+			t.Status = status
+			return nil
+		}
+	}
+	return fmt.Errorf("412")
+}
+func (c *RepositoryMock) FindInbound(id int64) (*gen.Inbound, error) {
+	expected := time.Date(2017, 11, 20, 0, 0, 0, 0, time.UTC)
+	switch id {
+	case 1:
+		return new(gen.Inbound), fmt.Errorf("Erro")
+	case 2:
+		return &gen.Inbound{}, nil
+	case 3:
+		return &gen.Inbound{Id: id, Sku: "SC", Warehouse: "A", Quantity: 1, ExpectedAt: &expected, Status: gen.InboundExpected}, nil
+	case 4:
+		return &gen.Inbound{Id: id, Sku: "SCF", Warehouse: "A", Quantity: 5, ExpectedAt: &expected, Status: gen.InboundExpected}, nil
+	case 5:
+		return &gen.Inbound{Id: id, Sku: "SCC", Warehouse: "A", Quantity: 5, ExpectedAt: &expected, Status: gen.InboundReceived}, nil
+	case 6:
+		return &gen.Inbound{Id: id, Sku: "SCD", Warehouse: "A", Quantity: 5, ExpectedAt: &expected, Status: gen.InboundExpected}, nil
+	}
+	return &gen.Inbound{Id: id, Sku: "SCC", Warehouse: "A", Quantity: 5, ExpectedAt: &expected, Status: gen.InboundExpected}, nil
+}
+func (c *RepositoryMock) FindInbounds(sku string, warehouse string) ([]gen.Inbound, error) {
+	if sku == "SAC" {
+		return nil, fmt.Errorf("Erro")
+	}
+	// supply expected in a month
+	expected := time.Now().UTC().AddDate(0, 1, 0)
+	return []gen.Inbound{{Id: 7, Sku: sku, Warehouse: "A", Quantity: 5, ExpectedAt: &expected, Status: gen.InboundExpected}}, nil
+}
+func (c *RepositoryMock) InsertInbound(i *gen.Inbound) (int64, error) {
+	if i.Sku == "SC" {
+		return 0, fmt.Errorf("Erro")
+	}
+	return 1, nil
+}
+func (c *RepositoryMock) ReceiveInbound(i *gen.Inbound) error {
+	return c.moveInbound(i, gen.InboundReceived)
+}
+func (c *RepositoryMock) CancelInbound(i *gen.Inbound) error {
+	if i.Sku == "SCF" {
+		return fmt.Errorf("409")
+	}
+	return c.moveInbound(i, gen.InboundCancelled)
+}
+func (c *RepositoryMock) moveInbound(i *gen.Inbound, status string) error {
+	if i.Sku == "SC" {
+		return fmt.Errorf("Erro")
+	}
+	if i.Status != gen.InboundExpected {
+		return fmt.Errorf("412")
+	}
+	i.Status = status
+	return nil
+}
+func (c *RepositoryMock) FindBundle(sku string) (*gen.Bundle, error) {
+	switch sku {
+	case "SBE":
+		return new(gen.Bundle), fmt.Errorf("Erro")
+	case "SBN":
+		return &gen.Bundle{Sku: sku, Components: []gen.Component{{Sku: "SBC", Quantity: 2}, {Sku: "SCM", Quantity: 1}}}, nil
+	case "SBNF":
+		return &gen.Bundle{Sku: sku, Components: []gen.Component{{Sku: "SBC", Quantity: 1}, {Sku: "SCF", Quantity: 1}}}, nil
+	case "SBNA":
+		return &gen.Bundle{Sku: sku, Components: []gen.Component{{Sku: "SBC", Quantity: 1}, {Sku: "SCA", Quantity: 1}}}, nil
+	// a bundle flagged as serialized
+	case "SSNB":
+		return &gen.Bundle{Sku: sku, Components: []gen.Component{{Sku: "SBC", Quantity: 1}}}, nil
+	}
+	return &gen.Bundle{Sku: sku, Components: []gen.Component{}}, nil
+}
+func (c *RepositoryMock) FindBundlesWith(sku string) ([]string, error) {
+	switch sku {
+	case "SBCE":
+		return nil, fmt.Errorf("Erro")
+	case "SBC":
+		return []string{"SBN"}, nil
+	}
+	return nil, nil
+}
+func (c *RepositoryMock) UpdateBundle(b *gen.Bundle) error {
+	if b.Sku == "SAC" {
+		return fmt.Errorf("Erro")
+	}
+	// the sku holds stock of its own
+	if b.Sku == "SBS" {
+		return fmt.Errorf("409")
+	}
+	return nil
+}
+func (c *RepositoryMock) FindSkuSettings(sku string) (*gen.SkuSettings, error) {
+	if sku == "SSE" {
+		return new(gen.SkuSettings), fmt.Errorf("Erro")
+	}
+	switch sku {
+	case "SBO":
+		return &gen.SkuSettings{Sku: sku, Backorder: gen.BackorderCapped, BackorderLimit: 5}, nil
+	case "SBU":
+		return &gen.SkuSettings{Sku: sku, Backorder: gen.BackorderUnlimited}, nil
+	}
+	return &gen.SkuSettings{Sku: sku, Preorder: sku == "SCP", Backorder: gen.BackorderDisallowed, Serialized: strings.HasPrefix(sku, "SSN")}, nil
+}
+func (c *RepositoryMock) UpdateSkuSettings(s *gen.SkuSettings) error {
+	if s.Sku == "SAC" {
+		return fmt.Errorf("Erro")
+	}
+	// SCC and the serialized skus hold stock
+	stored, _ := c.FindSkuSettings(s.Sku)
+	if stored.Serialized != s.Serialized && (s.Sku == "SCC" || strings.HasPrefix(s.Sku, "SSN")) {
+		return fmt.Errorf("409")
+	}
+	return nil
+}
+func (c *RepositoryMock) FindReservation(id int64) (*gen.Reservation, error) {
+	switch id {
+	case 1:
+		return new(gen.Reservation), fmt.Errorf("Erro")
+	case 2:
+		return &gen.Reservation{}, nil
+	case 3:
+		return &gen.Reservation{Id: id, Sku: "SC", Warehouse: "C", Quantity: 1}, nil
+	case 4:
+		return &gen.Reservation{Id: id, Sku: "SCE", Warehouse: "D", Quantity: 1}, nil
+	case 5:
+		return &gen.Reservation{Id: id, Sku: "SCD", Warehouse: "A", Quantity: 1}, nil
+	case 7:
+		return &gen.Reservation{Id: id, Sku: "SCP", Warehouse: "A", Quantity: 5, Preorder: true}, nil
+	}
+	return &gen.Reservation{Id: id, Sku: "SCC", Warehouse: "A", Quantity: 10}, nil
+}
+func (c *RepositoryMock) AdjustSku(s *gen.Sku, delta int64) (int64, error) {
+	if s.Sku == "SAC" {
+		return 0, fmt.Errorf("Erro")
+	}
+	if s.Version == 99 {
+		return 0, fmt.Errorf("412")
+	}
+	if s.Sku == "SCN" {
+		return 0, fmt.Errorf("409")
+	}
+	// the sku is not stored in the warehouse
+	if s.Sku == "SCW" {
+		return 0, fmt.Errorf("404")
+	}
+	return 10 + delta, nil
+}
+func (c *RepositoryMock) BulkSku(rows []gen.StockRow, chunk int64) []gen.StockRowResult {
+	results := make([]gen.StockRowResult, len(rows))
+	for i, row := range rows {
+		results[i] = gen.StockRowResult{Row: row.Row, Sku: row.Sku, Warehouse: row.Warehouse, Status: gen.RowChanged, Quantity: row.Quantity}
+		switch row.Sku {
+		case "SAC":
+			results[i].Status, results[i].Quantity, results[i].Error = gen.RowFailed, 0, "Erro"
+		case "SCN":
+			results[i].Status, results[i].Quantity, results[i].Error = gen.RowFailed, 0, "409"
+		case "SCW":
+			results[i].Status, results[i].Quantity, results[i].Error = gen.RowFailed, 0, "404"
+		case "SCU":
+			results[i].Status = gen.RowUnchanged
+		}
+	}
+	return results
+}
+func (c *RepositoryMock) InsertReservation(re *gen.Reservation) (int64, error) {
+	if re.Sku == "SC" {
+		return 0, fmt.Errorf("Erro")
+	}
+	if re.Sku == "SCA" {
+		return 0, fmt.Errorf("404")
+	}
+	if re.Sku == "SCF" {
+		return 0, fmt.Errorf("409")
+	}
+	return 1, nil
+}
+func (c *RepositoryMock) InsertReservations(res []*gen.Reservation) error {
+	for i, re := range res {
+		if re.Sku == "SC" {
+			return fmt.Errorf("Erro")
+		}
+		if re.Sku == "SCA" {
+			return fmt.Errorf("404")
+		}
+		if re.Sku == "SCF" {
+			return fmt.Errorf("409")
+		}
+		re.Id = int64(i + 1)
+	}
+	return nil
+}
+func (c *RepositoryMock) InsertOrder(o *gen.Order, res []*gen.Reservation) error {
+	// the order already holds reservations
+	if o.Order == "OX" {
+		return fmt.Errorf("412")
+	}
+	return c.InsertReservations(res)
+}
 func (c *RepositoryMock) DeleteReservation(re *gen.Reservation) error {
 	if re.Sku == "SC" {
 		return fmt.Errorf("Erro")
@@ -67,6 +610,91 @@ func (c *RepositoryMock) DeleteReservation(re *gen.Reservation) error {
 	}
 	return nil
 }
+func (c *RepositoryMock) CommitReservation(re *gen.Reservation) error {
+	if re.Sku == "SC" {
+		return fmt.Errorf("Erro")
+	}
+	// the inbound supply of the pre-order was not received
+	if re.Sku == "SCP" {
+		return fmt.Errorf("409")
+	}
+	if re.Sku == "SCE" {
+		return fmt.Errorf("404")
+	}
+	return nil
+}
+func (c *RepositoryMock) DeleteReservations(o *gen.Order) ([]string, error) {
+	switch o.Order {
+	case "ERR":
+		return nil, fmt.Errorf("Erro")
+	case "NONE":
+		return nil, fmt.Errorf("404")
+	case "PUB":
+		return []string{"SCC", "SCD"}, nil
+	}
+	return []string{"SCC", "SCM"}, nil
+}
+func (c *RepositoryMock) DeleteExpiredReservations(limit int64) (int64, []string, error) {
+	if c.Iserror {
+		return 0, nil, fmt.Errorf("Erro")
+	}
+	// fails once the given number of batches were deleted
+	if c.FailAfter > 0 && c.Batches == c.FailAfter {
+		return 0, nil, fmt.Errorf("Erro")
+	}
+	c.Batches++
+	deleted := c.Expired
+	if deleted > limit {
+		deleted = limit
+	}
+	c.Expired -= deleted
+	if deleted == 0 {
+		return 0, nil, nil
+	}
+	if c.Expired > 0 {
+		return deleted, []string{"SCC"}, nil
+	}
+	return deleted, []string{"SCC", "SCD"}, nil
+}
+func (c *RepositoryMock) FindIdempotency(key string) (*gen.Idempotency, error) {
+	if key == "ERR" {
+		return new(gen.Idempotency), fmt.Errorf("Erro")
+	}
+	if i, ok := c.Keys[key]; ok {
+		return i, nil
+	}
+	return &gen.Idempotency{}, nil
+}
+func (c *RepositoryMock) InsertIdempotency(i *gen.Idempotency) error {
+	if i.Key == "ERRI" {
+		return fmt.Errorf("Erro")
+	}
+	if c.Keys == nil {
+		c.Keys = make(map[string]*gen.Idempotency)
+	}
+	if _, ok := c.Keys[i.Key]; ok {
+		return fmt.Errorf("409")
+	}
+	aux := *i
+	c.Keys[i.Key] = &aux
+	return nil
+}
+func (c *RepositoryMock) UpdateIdempotency(i *gen.Idempotency) error {
+	aux := *i
+	c.Keys[i.Key] = &aux
+	return nil
+}
+func (c *RepositoryMock) DeleteIdempotency(key string) error {
+	delete(c.Keys, key)
+	return nil
+}
+func (c *RepositoryMock) DeleteExpiredIdempotency(limit int64) (int64, error) {
+	if c.Iserror {
+		return 0, fmt.Errorf("Erro")
+	}
+	c.KeysReaped = true
+	return 0, nil
+}
 func (c *RepositoryMock) Health() error {
 	if c.Iserror {
 		return fmt.Errorf("Erro Health")
@@ -87,6 +715,7 @@ func (c *PublisherMock) Publish(s *gen.SkuResponse) error {
 	if s.Sku == "SCD" {
 		return fmt.Errorf("Erro")
 	}
+	c.Published = append(c.Published, s.Sku)
 	return nil
 }
 func (c *PublisherMock) Health() error {
@@ -0,0 +1,130 @@
+package reaper
+
+import (
+	"fmt"
+	"github.com/labstack/echo"
+	cnfs "github.com/pintobikez/stock-service/config/structures"
+	pub "github.com/pintobikez/stock-service/publisher"
+	repo "github.com/pintobikez/stock-service/repository"
+	"time"
+)
+
+const (
+	DefaultInterval = 60
+	DefaultBatch    = 500
+)
+
+type Reaper struct {
+	rp       repo.Repository
+	pb       pub.PubSub
+	interval time.Duration
+	batch    int64
+	quit     chan struct{}
+}
+
+// Creates a pointer to a new Reaper struct
+func New(rpo repo.Repository, p pub.PubSub, cnfg *cnfs.ReservationConfig) *Reaper {
+	r := &Reaper{rp: rpo, pb: p, interval: DefaultInterval * time.Second, batch: DefaultBatch}
+
+	if cnfg != nil && cnfg.Interval > 0 {
+		r.interval = time.Duration(cnfg.Interval) * time.Second
+	}
+	if cnfg != nil && cnfg.Batch > 0 {
+		r.batch = cnfg.Batch
+	}
+
+	return r
+}
+
+// Starts deleting the expired reservations on every interval until Stop is called
+func (r *Reaper) Start(l echo.Logger) {
+	r.quit = make(chan struct{})
+
+	go func() {
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if err := r.Reap(); err != nil {
+					l.Errorf("Error reaping expired reservations and idempotency keys: %s", err.Error())
+				}
+			case <-r.quit:
+				return
+			}
+		}
+	}()
+}
+
+// Stops the Reaper
+func (r *Reaper) Stop() {
+	if r.quit != nil {
+		close(r.quit)
+	}
+}
+
+// Deletes every expired reservation and idempotency key in batches and publishes the stock of the skus released,
+// and then of the bundles made of them
+// A batch that fails stops the deletion of the reservations, but the skus of the batches already deleted are still
+// published and the idempotency keys still deleted before the error is returned
+func (r *Reaper) Reap() error {
+	var skus []string
+	var reapErr error
+	seen := make(map[string]bool)
+
+	for {
+		deleted, found, err := r.rp.DeleteExpiredReservations(r.batch)
+		if err != nil {
+			reapErr = err
+			break
+		}
+
+		for _, sku := range found {
+			if !seen[sku] {
+				seen[sku] = true
+				skus = append(skus, sku)
+			}
+		}
+
+		if deleted < r.batch {
+			break
+		}
+	}
+
+	skus, failed := repo.WithBundles(r.rp, skus)
+	for _, sku := range skus {
+		skuResponse, err := r.rp.FindSku(sku)
+		if err != nil {
+			failed = append(failed, sku)
+			continue
+		}
+
+		if err := r.pb.Publish(skuResponse); err != nil {
+			failed = append(failed, sku)
+		}
+	}
+
+	for {
+		deleted, err := r.rp.DeleteExpiredIdempotency(r.batch)
+		if err != nil {
+			if reapErr == nil {
+				reapErr = err
+			}
+			break
+		}
+
+		if deleted < r.batch {
+			break
+		}
+	}
+
+	if reapErr != nil {
+		return reapErr
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("Could not publish the stock of Skus %v", failed)
+	}
+
+	return nil
+}
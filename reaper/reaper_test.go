@@ -0,0 +1,54 @@
+package reaper
+
+import (
+	"fmt"
+	cnfs "github.com/pintobikez/stock-service/config/structures"
+	mock "github.com/pintobikez/stock-service/mocks"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+/*
+Tests for Reap method
+*/
+type reapProvider struct {
+	expired   int64
+	batch     int64
+	iserror   bool
+	failAfter int64
+	left      int64
+	published []string
+	reaped    bool
+	result    error
+}
+
+var testReapProvider = []reapProvider{
+	{0, 10, true, 0, 0, nil, false, fmt.Errorf("Erro")},                                                   // RepoDeleteExpiredReservations error
+	{0, 10, false, 0, 0, nil, true, nil},                                                                  // nothing expired
+	{5, 10, false, 0, 0, []string{"SCC"}, true, fmt.Errorf("Could not publish the stock of Skus [SCD]")},  // Error Publish
+	{25, 10, false, 0, 0, []string{"SCC"}, true, fmt.Errorf("Could not publish the stock of Skus [SCD]")}, // several batches
+	{25, 10, false, 1, 15, []string{"SCC"}, true, fmt.Errorf("Erro")},                                     // later batch error, the deleted ones published
+}
+
+func TestReap(t *testing.T) {
+	for _, pair := range testReapProvider {
+		p := new(mock.PublisherMock)
+		r := &mock.RepositoryMock{Iserror: pair.iserror, Expired: pair.expired, FailAfter: pair.failAfter}
+		rp := New(r, p, &cnfs.ReservationConfig{Batch: pair.batch})
+
+		assert.Equal(t, pair.result, rp.Reap(), "Error message doesn't match")
+		assert.Equal(t, pair.left, r.Expired, "Expired reservations left doesn't match")
+		assert.Equal(t, pair.published, p.Published, "Published skus don't match")
+		assert.Equal(t, pair.reaped, r.KeysReaped, "Idempotency keys reaped doesn't match")
+	}
+}
+
+/* Test for New method */
+func TestNew(t *testing.T) {
+	rp := New(new(mock.RepositoryMock), new(mock.PublisherMock), nil)
+	assert.Equal(t, int64(DefaultBatch), rp.batch)
+
+	rp = New(new(mock.RepositoryMock), new(mock.PublisherMock), &cnfs.ReservationConfig{Interval: 5, Batch: 20})
+	assert.Equal(t, int64(20), rp.batch)
+	assert.Equal(t, "5s", rp.interval.String())
+}
@@ -0,0 +1,147 @@
+package mysql
+
+import (
+	"database/sql"
+	"fmt"
+	gen "github.com/pintobikez/stock-service/api/structures"
+	"sort"
+	"time"
+)
+
+// Inserts an Adjustment and applies the delta of every line in a single transaction
+// Fails with 404 when a line takes units from a sku not stored in its warehouse, and with 409 when a line takes the quantity
+// below the backorder limit of its sku, and nothing is applied
+func (r *Client) InsertAdjustment(a *gen.Adjustment) (int64, error) {
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("Could not insert adjustment")
+	}
+	defer tx.Rollback()
+
+	createdAt := time.Now().UTC().Truncate(time.Second)
+	res, err := tx.Exec("INSERT INTO adjustment (reason, note, request_id, caller, created_at) VALUES (?,NULLIF(?,''),NULLIF(?,''),NULLIF(?,''),?)", a.Reason, a.Note, a.RequestId, a.Caller, createdAt)
+	if err != nil {
+		return 0, fmt.Errorf("Could not insert adjustment")
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("Could not insert adjustment")
+	}
+
+	// the lines are applied in the same order by every transaction so they do not deadlock
+	lines := make([]*gen.AdjustmentLine, len(a.Lines))
+	for i := range a.Lines {
+		lines[i] = &a.Lines[i]
+	}
+	sort.Slice(lines, func(i, j int) bool {
+		if lines[i].Sku != lines[j].Sku {
+			return lines[i].Sku < lines[j].Sku
+		}
+		return lines[i].Warehouse < lines[j].Warehouse
+	})
+
+	for _, l := range lines {
+		if l.Delta < 0 {
+			if err := lockAdjustedRow(tx, l); err != nil {
+				return 0, err
+			}
+			_, err = tx.Exec("UPDATE stock SET quantity=quantity+?, version=version+1, updated_at=now() WHERE sku=? AND warehouse=?", l.Delta, l.Sku, l.Warehouse)
+		} else {
+			_, err = tx.Exec("INSERT INTO stock (sku, warehouse, quantity, updated_at) VALUES (?,?,?,now()) ON DUPLICATE KEY UPDATE quantity=quantity+VALUES(quantity), version=version+1, updated_at=now()", l.Sku, l.Warehouse, l.Delta)
+		}
+		if err != nil {
+			return 0, fmt.Errorf("Could not adjust stock for Sku %s", l.Sku)
+		}
+
+		if l.Delta < 0 {
+			if err := takeLots(tx, l.Sku, l.Warehouse, -l.Delta); err != nil {
+				return 0, err
+			}
+		}
+
+		err = tx.QueryRow("SELECT quantity FROM stock WHERE sku=? AND warehouse=?", l.Sku, l.Warehouse).Scan(&l.Quantity)
+		if err != nil {
+			return 0, fmt.Errorf("Could not adjust stock for Sku %s", l.Sku)
+		}
+
+		_, err = tx.Exec("INSERT INTO adjustment_line (adjustment_id, sku, warehouse, delta, quantity) VALUES (?,?,?,?,?)", id, l.Sku, l.Warehouse, l.Delta, l.Quantity)
+		if err != nil {
+			return 0, fmt.Errorf("Could not insert adjustment line for Sku %s", l.Sku)
+		}
+
+		err = insertMovement(tx, &gen.StockMovement{Sku: l.Sku, Warehouse: l.Warehouse, Action: gen.ActionAdjust, Delta: l.Delta, AdjustmentId: id, RequestId: a.RequestId, Caller: a.Caller})
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("Could not insert adjustment")
+	}
+
+	a.Id = id
+	a.CreatedAt = &createdAt
+
+	return id, nil
+}
+
+// Locks the stock row a negative AdjustmentLine takes units from inside the given transaction
+// Fails with 404 when the sku is not stored in the warehouse and with 409 when the line takes the quantity below its backorder limit
+func lockAdjustedRow(tx *sql.Tx, l *gen.AdjustmentLine) error {
+	var quantity int64
+
+	err := tx.QueryRow("SELECT quantity FROM stock WHERE sku=? AND warehouse=? FOR UPDATE", l.Sku, l.Warehouse).Scan(&quantity)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("404")
+	}
+	if err != nil {
+		return fmt.Errorf("Could not adjust stock for Sku %s", l.Sku)
+	}
+
+	floor, err := backorderFloor(tx, l.Sku)
+	if err != nil {
+		return err
+	}
+	if quantity+l.Delta < floor {
+		return fmt.Errorf("409")
+	}
+
+	return nil
+}
+
+// Finds an Adjustment with its lines by its id
+func (r *Client) FindAdjustment(id int64) (*gen.Adjustment, error) {
+	a := new(gen.Adjustment)
+	var note sql.NullString
+	var createdAt time.Time
+
+	err := r.db.QueryRow("SELECT id, reason, note, created_at FROM adjustment WHERE id=?", id).Scan(&a.Id, &a.Reason, &note, &createdAt)
+	if err == sql.ErrNoRows {
+		return &gen.Adjustment{}, nil
+	}
+	if err != nil {
+		return &gen.Adjustment{}, fmt.Errorf("Could not find adjustment %d: %s", id, err.Error())
+	}
+	a.Note = note.String
+	a.CreatedAt = &createdAt
+
+	rows, err := r.db.Query("SELECT sku, warehouse, delta, quantity FROM adjustment_line WHERE adjustment_id=? ORDER BY sku, warehouse", id)
+	if err != nil {
+		return &gen.Adjustment{}, fmt.Errorf("Could not find adjustment %d: %s", id, err.Error())
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var l gen.AdjustmentLine
+
+		if err := rows.Scan(&l.Sku, &l.Warehouse, &l.Delta, &l.Quantity); err != nil {
+			return &gen.Adjustment{}, fmt.Errorf("Error reading rows: %s", err.Error())
+		}
+
+		a.Lines = append(a.Lines, l)
+	}
+
+	return a, nil
+}
@@ -0,0 +1,145 @@
+package mysql
+
+import (
+	"database/sql"
+	"fmt"
+	gen "github.com/pintobikez/stock-service/api/structures"
+	"sort"
+)
+
+// Applies the given StockRows in transactions of up to chunk rows and Retrieves the result of each row
+// A row that would take its quantity below the backorder limit of its sku fails alone with 409, and one subtracting from a sku
+// not stored in its warehouse with 404, a chunk that can not be stored fails every row in it
+func (r *Client) BulkSku(rows []gen.StockRow, chunk int64) []gen.StockRowResult {
+	results := make([]gen.StockRowResult, 0, len(rows))
+
+	for start := 0; start < len(rows); start += int(chunk) {
+		end := start + int(chunk)
+		if end > len(rows) {
+			end = len(rows)
+		}
+
+		results = append(results, r.bulkChunk(rows[start:end])...)
+	}
+
+	return results
+}
+
+// Applies the given StockRows in a single transaction
+func (r *Client) bulkChunk(rows []gen.StockRow) []gen.StockRowResult {
+	results := make([]gen.StockRowResult, len(rows))
+	for i, row := range rows {
+		results[i] = gen.StockRowResult{Row: row.Row, Sku: row.Sku, Warehouse: row.Warehouse, Status: gen.RowFailed}
+	}
+
+	failAll := func(err error) []gen.StockRowResult {
+		for i := range results {
+			results[i].Status = gen.RowFailed
+			results[i].Quantity = 0
+			results[i].Error = err.Error()
+		}
+		return results
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return failAll(fmt.Errorf("Could not store the stock of the chunk"))
+	}
+	defer tx.Rollback()
+
+	// the rows are locked in the same order by every transaction so they do not deadlock,
+	// rows of the same sku and warehouse keep the order they were sent in
+	order := make([]int, len(rows))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := rows[order[i]], rows[order[j]]
+		if a.Sku != b.Sku {
+			return a.Sku < b.Sku
+		}
+		return a.Warehouse < b.Warehouse
+	})
+
+	for _, i := range order {
+		quantity, changed, err := applyStockRow(tx, &rows[i])
+		if err != nil {
+			if err.Error() == "404" || err.Error() == "409" {
+				results[i].Error = err.Error()
+				continue
+			}
+			return failAll(err)
+		}
+
+		results[i].Quantity = quantity
+		results[i].Status = gen.RowUnchanged
+		if changed {
+			results[i].Status = gen.RowChanged
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return failAll(fmt.Errorf("Could not store the stock of the chunk"))
+	}
+
+	return results
+}
+
+// Applies a StockRow inside the given transaction and Retrieves the resulting quantity and if it changed
+// Units can only be subtracted from a sku stored in the warehouse, as a single subtraction
+func applyStockRow(tx *sql.Tx, row *gen.StockRow) (int64, bool, error) {
+	var quantity int64
+
+	err := tx.QueryRow("SELECT quantity FROM stock WHERE sku=? AND warehouse=? FOR UPDATE", row.Sku, row.Warehouse).Scan(&quantity)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, false, fmt.Errorf("Could not update stock for Sku %s", row.Sku)
+	}
+	exists := err == nil
+	if !exists && row.Action == gen.ActionSub && row.Quantity > 0 {
+		return 0, false, fmt.Errorf("404")
+	}
+
+	target := row.Quantity
+	switch row.Action {
+	case gen.ActionAdd:
+		target = quantity + row.Quantity
+	case gen.ActionSub:
+		target = quantity - row.Quantity
+	}
+
+	if target < 0 {
+		floor, err := backorderFloor(tx, row.Sku)
+		if err != nil {
+			return 0, false, err
+		}
+		if target < floor {
+			return 0, false, fmt.Errorf("409")
+		}
+	}
+	// adding or subtracting zero units does not create the sku
+	if (exists && target == quantity) || (!exists && row.Action != gen.ActionSet && row.Quantity == 0) {
+		return quantity, false, nil
+	}
+
+	if exists {
+		_, err = tx.Exec("UPDATE stock SET quantity=?, version=version+1, updated_at=now() WHERE sku=? AND warehouse=?", target, row.Sku, row.Warehouse)
+	} else {
+		_, err = tx.Exec("INSERT INTO stock (sku, warehouse, quantity, updated_at) VALUES (?,?,?,now())", row.Sku, row.Warehouse, target)
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("Could not update stock for Sku %s", row.Sku)
+	}
+
+	if exists && target < quantity {
+		if err := takeLots(tx, row.Sku, row.Warehouse, quantity-target); err != nil {
+			return 0, false, err
+		}
+	}
+
+	err = insertMovement(tx, &gen.StockMovement{Sku: row.Sku, Warehouse: row.Warehouse, Action: row.Action, Delta: target - quantity, RequestId: row.RequestId, Caller: row.Caller})
+	if err != nil {
+		return 0, false, err
+	}
+
+	return target, true, nil
+}
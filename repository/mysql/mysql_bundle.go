@@ -0,0 +1,118 @@
+package mysql
+
+import (
+	"fmt"
+	gen "github.com/pintobikez/stock-service/api/structures"
+)
+
+// Finds the Bundles matching the where clause with their components
+func bundles(q queryer, where string, args ...interface{}) ([]*gen.Bundle, error) {
+	rows, err := q.Query("SELECT bundle, component, quantity FROM bundle_component WHERE "+where+" ORDER BY bundle, component", args...)
+	if err != nil {
+		return nil, fmt.Errorf("Could not find the bundles: %s", err.Error())
+	}
+	defer rows.Close()
+
+	var found []*gen.Bundle
+	for rows.Next() {
+		var sku string
+		var c gen.Component
+
+		if err := rows.Scan(&sku, &c.Sku, &c.Quantity); err != nil {
+			return nil, fmt.Errorf("Error reading rows: %s", err.Error())
+		}
+
+		if len(found) == 0 || found[len(found)-1].Sku != sku {
+			found = append(found, &gen.Bundle{Sku: sku})
+		}
+		b := found[len(found)-1]
+		b.Components = append(b.Components, c)
+	}
+
+	return found, nil
+}
+
+// Finds the Bundle of a sku, without components when the sku is not a bundle
+func (r *Client) FindBundle(sku string) (*gen.Bundle, error) {
+	found, err := bundles(r.db, "bundle=?", sku)
+	if err != nil {
+		return &gen.Bundle{}, err
+	}
+	if len(found) == 0 {
+		return &gen.Bundle{Sku: sku, Components: []gen.Component{}}, nil
+	}
+
+	return found[0], nil
+}
+
+// Finds the bundles a sku is a component of
+func (r *Client) FindBundlesWith(sku string) ([]string, error) {
+
+	rows, err := r.db.Query("SELECT bundle FROM bundle_component WHERE component=? ORDER BY bundle", sku)
+	if err != nil {
+		return nil, fmt.Errorf("Could not find the bundles of Sku %s", sku)
+	}
+	defer rows.Close()
+
+	var skus []string
+	for rows.Next() {
+		var bundle string
+		if err := rows.Scan(&bundle); err != nil {
+			return nil, fmt.Errorf("Error reading rows: %s", err.Error())
+		}
+		skus = append(skus, bundle)
+	}
+
+	return skus, nil
+}
+
+// Replaces the components of a Bundle, a bundle without components is no longer a bundle
+// Fails with 409 when the sku still holds stock rows or live reservations of its own, as a bundle holds no stock
+func (r *Client) UpdateBundle(b *gen.Bundle) error {
+	var held int64
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("Could not update bundle %s", b.Sku)
+	}
+	defer tx.Rollback()
+
+	if len(b.Components) > 0 {
+		err = tx.QueryRow("SELECT (SELECT COUNT(*) FROM stock WHERE sku=? FOR UPDATE) + (SELECT COUNT(*) FROM reservation WHERE sku=? AND (expires_at IS NULL OR expires_at>UTC_TIMESTAMP()))", b.Sku, b.Sku).Scan(&held)
+		if err != nil {
+			return fmt.Errorf("Could not update bundle %s", b.Sku)
+		}
+		if held > 0 {
+			return fmt.Errorf("409")
+		}
+	}
+
+	_, err = tx.Exec("DELETE FROM bundle_component WHERE bundle=?", b.Sku)
+	if err != nil {
+		return fmt.Errorf("Could not update bundle %s", b.Sku)
+	}
+
+	for _, c := range b.Components {
+		_, err = tx.Exec("INSERT INTO bundle_component (bundle, component, quantity, updated_at) VALUES (?,?,?,now())", b.Sku, c.Sku, c.Quantity)
+		if err != nil {
+			return fmt.Errorf("Could not update bundle %s", b.Sku)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("Could not update bundle %s", b.Sku)
+	}
+
+	return nil
+}
+
+// Retrieves the skus of the components of the given bundles
+func componentSkus(found []*gen.Bundle) []string {
+	var skus []string
+	for _, b := range found {
+		for _, c := range b.Components {
+			skus = append(skus, c.Sku)
+		}
+	}
+	return skus
+}
@@ -0,0 +1,90 @@
+package mysql
+
+import (
+	"database/sql"
+	"fmt"
+	gen "github.com/pintobikez/stock-service/api/structures"
+)
+
+// Runs a query in or out of a transaction
+type queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// Builds the query of the channel allocations matching the where clause, with their allocated units and the units
+// reserved by their channel. A percentage allocates that share of the quantity of the sku in the warehouse
+func channelQuery(where string) string {
+	return "SELECT c.sku, c.warehouse, c.channel, c.quantity, c.percentage, " +
+		"IFNULL(c.quantity, FLOOR(GREATEST(IFNULL(s.quantity,0),0)*c.percentage/100)) as allocated, " +
+		"(select IFNULL(SUM(quantity),0) from reservation where sku=c.sku and warehouse=c.warehouse and channel=c.channel and (expires_at IS NULL OR expires_at>UTC_TIMESTAMP())) as reserved " +
+		"FROM channel_allocation c LEFT JOIN stock s ON s.sku=c.sku AND s.warehouse=c.warehouse WHERE " + where + " ORDER BY c.sku, c.warehouse, c.channel"
+}
+
+// Finds the ChannelAllocations matching the where clause
+func channelAllocations(q queryer, where string, args ...interface{}) ([]gen.ChannelAllocation, error) {
+	rows, err := q.Query(channelQuery(where), args...)
+	if err != nil {
+		return nil, fmt.Errorf("Could not find the channel allocations: %s", err.Error())
+	}
+	defer rows.Close()
+
+	allocations := []gen.ChannelAllocation{}
+	for rows.Next() {
+		var c gen.ChannelAllocation
+
+		err = rows.Scan(&c.Sku, &c.Warehouse, &c.Channel, &c.Quantity, &c.Percentage, &c.Allocated, &c.Reserved)
+		if err != nil {
+			return nil, fmt.Errorf("Error reading rows: %s", err.Error())
+		}
+
+		allocations = append(allocations, c)
+	}
+
+	return allocations, nil
+}
+
+// Finds the ChannelAllocations of a sku in every warehouse
+func (r *Client) FindChannelAllocations(sku string) ([]gen.ChannelAllocation, error) {
+	return channelAllocations(r.db, "c.sku=?", sku)
+}
+
+// Sets the allocation of a channel to a sku in a warehouse, failing with 404 when the sku is not stored in the warehouse
+// An allocation without quantity nor percentage is removed
+func (r *Client) UpdateChannelAllocation(c *gen.ChannelAllocation) error {
+	var found int64
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("Could not update the allocation of channel %s to Sku %s", c.Channel, c.Sku)
+	}
+	defer tx.Rollback()
+
+	// the stock row is locked as the reservations do, so none is checked against a changing allocation
+	err = tx.QueryRow("SELECT 1 FROM stock WHERE sku=? AND warehouse=? FOR UPDATE", c.Sku, c.Warehouse).Scan(&found)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("404")
+	}
+	if err != nil {
+		return fmt.Errorf("Could not update the allocation of channel %s to Sku %s", c.Channel, c.Sku)
+	}
+
+	if c.Quantity == nil && c.Percentage == nil {
+		_, err = tx.Exec("DELETE FROM channel_allocation WHERE sku=? AND warehouse=? AND channel=?", c.Sku, c.Warehouse, c.Channel)
+	} else {
+		_, err = tx.Exec("INSERT INTO channel_allocation (sku, warehouse, channel, quantity, percentage, updated_at) VALUES (?,?,?,?,?,now()) ON DUPLICATE KEY UPDATE quantity=VALUES(quantity), percentage=VALUES(percentage), updated_at=now()", c.Sku, c.Warehouse, c.Channel, c.Quantity, c.Percentage)
+	}
+	if err != nil {
+		return fmt.Errorf("Could not update the allocation of channel %s to Sku %s", c.Channel, c.Sku)
+	}
+
+	_, err = tx.Exec("UPDATE stock SET updated_at=now() WHERE sku=? AND warehouse=?", c.Sku, c.Warehouse)
+	if err != nil {
+		return fmt.Errorf("Could not update the allocation of channel %s to Sku %s", c.Channel, c.Sku)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("Could not update the allocation of channel %s to Sku %s", c.Channel, c.Sku)
+	}
+
+	return nil
+}
@@ -0,0 +1,87 @@
+package mysql
+
+import (
+	"database/sql"
+	"fmt"
+	gen "github.com/pintobikez/stock-service/api/structures"
+)
+
+// Finds a not expired Idempotency by its key
+func (r *Client) FindIdempotency(key string) (*gen.Idempotency, error) {
+	i := new(gen.Idempotency)
+	var contentType sql.NullString
+
+	err := r.db.QueryRow("SELECT idem_key, fingerprint, status, content_type, body, expires_at FROM idempotency WHERE idem_key=? AND expires_at>UTC_TIMESTAMP()", key).Scan(&i.Key, &i.Fingerprint, &i.Status, &contentType, &i.Body, &i.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return &gen.Idempotency{}, nil
+	}
+	if err != nil {
+		return &gen.Idempotency{}, fmt.Errorf("Could not find idempotency key %s: %s", key, err.Error())
+	}
+	i.ContentType = contentType.String
+
+	return i, nil
+}
+
+// Inserts a pending Idempotency, failing with 409 when the key is already in use
+func (r *Client) InsertIdempotency(i *gen.Idempotency) error {
+
+	// an expired key can be used again
+	if _, err := r.db.Exec("DELETE FROM idempotency WHERE idem_key=? AND expires_at<=UTC_TIMESTAMP()", i.Key); err != nil {
+		return fmt.Errorf("Could not insert idempotency key %s", i.Key)
+	}
+
+	res, err := r.db.Exec("INSERT IGNORE INTO idempotency (idem_key, fingerprint, status, expires_at, created_at) VALUES (?,?,?,?,now())", i.Key, i.Fingerprint, i.Status, i.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("Could not insert idempotency key %s", i.Key)
+	}
+
+	affect, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("Could not insert idempotency key %s", i.Key)
+	}
+
+	if affect == 0 {
+		return fmt.Errorf("409")
+	}
+
+	return nil
+}
+
+// Stores the response of an Idempotency
+func (r *Client) UpdateIdempotency(i *gen.Idempotency) error {
+
+	_, err := r.db.Exec("UPDATE idempotency SET status=?, content_type=?, body=? WHERE idem_key=?", i.Status, i.ContentType, i.Body, i.Key)
+	if err != nil {
+		return fmt.Errorf("Could not update idempotency key %s", i.Key)
+	}
+
+	return nil
+}
+
+// Deletes an Idempotency
+func (r *Client) DeleteIdempotency(key string) error {
+
+	_, err := r.db.Exec("DELETE FROM idempotency WHERE idem_key=?", key)
+	if err != nil {
+		return fmt.Errorf("Could not delete idempotency key %s", key)
+	}
+
+	return nil
+}
+
+// Deletes up to limit expired Idempotency keys and Retrieves how many were deleted
+func (r *Client) DeleteExpiredIdempotency(limit int64) (int64, error) {
+
+	res, err := r.db.Exec("DELETE FROM idempotency WHERE expires_at<=UTC_TIMESTAMP() LIMIT ?", limit)
+	if err != nil {
+		return 0, fmt.Errorf("Could not delete expired idempotency keys: %s", err.Error())
+	}
+
+	affect, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("Could not delete expired idempotency keys: %s", err.Error())
+	}
+
+	return affect, nil
+}
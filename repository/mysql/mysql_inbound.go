@@ -0,0 +1,194 @@
+package mysql
+
+import (
+	"database/sql"
+	"fmt"
+	gen "github.com/pintobikez/stock-service/api/structures"
+	repo "github.com/pintobikez/stock-service/repository"
+	"time"
+)
+
+// Finds an Inbound supply by its id
+func (r *Client) FindInbound(id int64) (*gen.Inbound, error) {
+	i := new(gen.Inbound)
+
+	err := r.db.QueryRow("SELECT id, sku, warehouse, quantity, expected_at, status, IFNULL(reference,''), created_at, received_at, cancelled_at FROM inbound WHERE id=?", id).Scan(&i.Id, &i.Sku, &i.Warehouse, &i.Quantity, &i.ExpectedAt, &i.Status, &i.Reference, &i.CreatedAt, &i.ReceivedAt, &i.CancelledAt)
+	if err == sql.ErrNoRows {
+		return &gen.Inbound{}, nil
+	}
+	if err != nil {
+		return &gen.Inbound{}, fmt.Errorf("Could not find inbound %d: %s", id, err.Error())
+	}
+
+	return i, nil
+}
+
+// Finds the expected Inbound supplies of a sku, in every warehouse when none is given, the earliest first
+func (r *Client) FindInbounds(sku string, warehouse string) ([]gen.Inbound, error) {
+
+	query := "SELECT id, sku, warehouse, quantity, expected_at, status, IFNULL(reference,''), created_at FROM inbound WHERE sku=? AND status=?"
+	args := []interface{}{sku, gen.InboundExpected}
+
+	if warehouse != "" {
+		query += " AND warehouse=?"
+		args = append(args, warehouse)
+	}
+
+	rows, err := r.db.Query(query+" ORDER BY expected_at, id", args...)
+	if err != nil {
+		return nil, fmt.Errorf("Could not find the inbound supply of Sku %s", sku)
+	}
+	defer rows.Close()
+
+	inbounds := []gen.Inbound{}
+	for rows.Next() {
+		var i gen.Inbound
+
+		err = rows.Scan(&i.Id, &i.Sku, &i.Warehouse, &i.Quantity, &i.ExpectedAt, &i.Status, &i.Reference, &i.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("Error reading rows: %s", err.Error())
+		}
+
+		inbounds = append(inbounds, i)
+	}
+
+	return inbounds, nil
+}
+
+// Inserts an expected Inbound supply, the stock only changes once it is received
+// The stock row of the sku is created without units when missing, so the supply can be pre-ordered
+func (r *Client) InsertInbound(i *gen.Inbound) (int64, error) {
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("Could not insert inbound for Sku %s", i.Sku)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("INSERT IGNORE INTO stock (sku, warehouse, quantity, updated_at) VALUES (?,?,0,now())", i.Sku, i.Warehouse)
+	if err != nil {
+		return 0, fmt.Errorf("Could not insert inbound for Sku %s", i.Sku)
+	}
+
+	res, err := tx.Exec("INSERT INTO inbound (sku, warehouse, quantity, expected_at, status, reference, request_id, caller, created_at) VALUES (?,?,?,?,?,NULLIF(?,''),NULLIF(?,''),NULLIF(?,''),UTC_TIMESTAMP())", i.Sku, i.Warehouse, i.Quantity, i.ExpectedAt.UTC(), gen.InboundExpected, i.Reference, i.RequestId, i.Caller)
+	if err != nil {
+		return 0, fmt.Errorf("Could not insert inbound for Sku %s", i.Sku)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("Could not insert inbound for Sku %s", i.Sku)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("Could not insert inbound for Sku %s", i.Sku)
+	}
+
+	return id, nil
+}
+
+// Receives an expected Inbound supply, adding its units to the warehouse
+// Fails with 404 when the inbound does not exist and 412 when it is not expected
+func (r *Client) ReceiveInbound(i *gen.Inbound) error {
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("Could not receive inbound %d", i.Id)
+	}
+	defer tx.Rollback()
+
+	if err := lockInbound(tx, i); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("INSERT INTO stock (sku, warehouse, quantity, updated_at) VALUES (?,?,?,now()) ON DUPLICATE KEY UPDATE quantity=quantity+VALUES(quantity), version=version+1, updated_at=now()", i.Sku, i.Warehouse, i.Quantity)
+	if err != nil {
+		return fmt.Errorf("Could not receive inbound %d", i.Id)
+	}
+
+	return closeInboundStep(tx, i, gen.InboundReceived, "received_at", &i.ReceivedAt, &gen.StockMovement{Sku: i.Sku, Warehouse: i.Warehouse, Action: gen.ActionReceive, Delta: i.Quantity})
+}
+
+// Cancels an expected Inbound supply
+// Fails with 404 when the inbound does not exist, 412 when it is not expected and 409 while the pre-orders of the sku need its units
+func (r *Client) CancelInbound(i *gen.Inbound) error {
+	var quantity int64
+	var reserved int64
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("Could not cancel inbound %d", i.Id)
+	}
+	defer tx.Rollback()
+
+	if err := lockInbound(tx, i); err != nil {
+		return err
+	}
+
+	// the stock row is locked as the reservations do, so no pre-order takes the units meanwhile
+	err = tx.QueryRow("SELECT quantity FROM stock WHERE sku=? AND warehouse=? FOR UPDATE", i.Sku, i.Warehouse).Scan(&quantity)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("Could not cancel inbound %d", i.Id)
+	}
+
+	err = tx.QueryRow("SELECT IFNULL(SUM(quantity),0) FROM reservation WHERE sku=? AND warehouse=? AND (expires_at IS NULL OR expires_at>UTC_TIMESTAMP())", i.Sku, i.Warehouse).Scan(&reserved)
+	if err != nil {
+		return fmt.Errorf("Could not cancel inbound %d", i.Id)
+	}
+
+	// the supply of a pre-orderable sku is promisable, this expected one included
+	promised, err := promisable(tx, i.Sku, i.Warehouse)
+	if err != nil {
+		return err
+	}
+	if repo.PreordersShort(quantity, reserved, promised-i.Quantity, promised > 0) {
+		return fmt.Errorf("409")
+	}
+
+	return closeInboundStep(tx, i, gen.InboundCancelled, "cancelled_at", &i.CancelledAt, nil)
+}
+
+// Retrieves the units of the expected inbound supply of a sku in a warehouse that can be pre-ordered
+// Only a sku flagged as pre-orderable can promise them
+func promisable(tx *sql.Tx, sku string, warehouse string) (int64, error) {
+	var inbound int64
+
+	err := tx.QueryRow("SELECT IFNULL(SUM(i.quantity),0) FROM inbound i JOIN sku_settings s ON s.sku=i.sku AND s.preorder=1 WHERE i.sku=? AND i.warehouse=? AND i.status=?", sku, warehouse, gen.InboundExpected).Scan(&inbound)
+	if err != nil {
+		return 0, fmt.Errorf("Could not find the inbound supply of Sku %s", sku)
+	}
+
+	return inbound, nil
+}
+
+// Locks the expected Inbound supply inside the given transaction and loads it into i, failing with 412 when it is not expected
+func lockInbound(tx *sql.Tx, i *gen.Inbound) error {
+
+	err := tx.QueryRow("SELECT sku, warehouse, quantity, expected_at, status FROM inbound WHERE id=? FOR UPDATE", i.Id).Scan(&i.Sku, &i.Warehouse, &i.Quantity, &i.ExpectedAt, &i.Status)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("404")
+	}
+	if err != nil {
+		return fmt.Errorf("Could not find inbound %d: %s", i.Id, err.Error())
+	}
+
+	if i.Status != gen.InboundExpected {
+		return fmt.Errorf("412")
+	}
+
+	return nil
+}
+
+// Moves the Inbound supply to the given status, records the stock movement if any and commits the transaction
+func closeInboundStep(tx *sql.Tx, i *gen.Inbound, status string, column string, at **time.Time, m *gen.StockMovement) error {
+	if m != nil {
+		m.InboundId, m.RequestId, m.Caller = i.Id, i.RequestId, i.Caller
+	}
+
+	if err := closeStep(tx, "inbound", i.Id, status, column, at, m); err != nil {
+		return err
+	}
+
+	i.Status = status
+	return nil
+}
@@ -0,0 +1,102 @@
+package mysql
+
+import (
+	"fmt"
+	gen "github.com/pintobikez/stock-service/api/structures"
+	"strings"
+)
+
+// Finds the StockItems matching the filter, sorted by the filter sort and then by sku and warehouse
+// The listing continues after the filter cursor item, if any
+func (r *Client) ListStock(f *gen.StockFilter) ([]gen.StockItem, error) {
+
+	inner := []string{"1=1"}
+	outer := []string{"1=1"}
+	var innerArgs, outerArgs []interface{}
+
+	if f.Warehouse != "" {
+		inner = append(inner, "s.warehouse=?")
+		innerArgs = append(innerArgs, f.Warehouse)
+	}
+	if f.SkuPrefix != "" {
+		inner = append(inner, "s.sku LIKE ?")
+		innerArgs = append(innerArgs, likeEscaper.Replace(f.SkuPrefix)+"%")
+	}
+	if f.UpdatedFrom != nil {
+		inner = append(inner, "s.updated_at>=?")
+		innerArgs = append(innerArgs, f.UpdatedFrom.UTC())
+	}
+	if f.UpdatedTo != nil {
+		inner = append(inner, "s.updated_at<=?")
+		innerArgs = append(innerArgs, f.UpdatedTo.UTC())
+	}
+	if f.MinAvail != nil {
+		outer = append(outer, sellable+">=?")
+		outerArgs = append(outerArgs, *f.MinAvail)
+	}
+	if f.MaxAvail != nil {
+		outer = append(outer, sellable+"<=?")
+		outerArgs = append(outerArgs, *f.MaxAvail)
+	}
+
+	column := "sku"
+	switch f.Sort {
+	case gen.SortUpdatedAt:
+		column = "updated_at"
+	case gen.SortAvail:
+		column = sellable
+	}
+
+	direction, compare := "ASC", ">"
+	if f.Desc {
+		direction, compare = "DESC", "<"
+	}
+
+	if f.After != nil {
+		switch f.Sort {
+		case gen.SortUpdatedAt:
+			outer = append(outer, "(updated_at, sku, warehouse)"+compare+"(?, ?, ?)")
+			outerArgs = append(outerArgs, f.After.UpdatedAt, f.After.Sku, f.After.Warehouse)
+		case gen.SortAvail:
+			outer = append(outer, "("+sellable+", sku, warehouse)"+compare+"(?, ?, ?)")
+			outerArgs = append(outerArgs, f.After.Available, f.After.Sku, f.After.Warehouse)
+		default:
+			outer = append(outer, "(sku, warehouse)"+compare+"(?, ?)")
+			outerArgs = append(outerArgs, f.After.Sku, f.After.Warehouse)
+		}
+	}
+
+	order := fmt.Sprintf("%s %s, sku %s, warehouse %s", column, direction, direction, direction)
+	if column == "sku" {
+		order = fmt.Sprintf("sku %s, warehouse %s", direction, direction)
+	}
+
+	query := stockQuery(strings.Join(inner, " AND ")) + " WHERE " + strings.Join(outer, " AND ") + " ORDER BY " + order + " LIMIT ?"
+
+	args := append([]interface{}{r.safety}, innerArgs...)
+	args = append(args, outerArgs...)
+	args = append(args, f.Limit)
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("Could not list the stock: %s", err.Error())
+	}
+	defer rows.Close()
+
+	items := []gen.StockItem{}
+	for rows.Next() {
+		var i gen.StockItem
+
+		err = rows.Scan(&i.Sku, &i.Warehouse, &i.Quantity, &i.Version, &i.Reserved, &i.SafetyStock, &i.RawAvailable, &i.Available, &i.Backordered, &i.Expired, &i.UpdatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("Error reading rows: %s", err.Error())
+		}
+
+		items = append(items, i)
+	}
+
+	return items, nil
+}
+
+// Escapes the wildcards of a LIKE pattern
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
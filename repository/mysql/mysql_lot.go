@@ -0,0 +1,215 @@
+package mysql
+
+import (
+	"database/sql"
+	"fmt"
+	gen "github.com/pintobikez/stock-service/api/structures"
+	repo "github.com/pintobikez/stock-service/repository"
+)
+
+// Finds the Lots of a sku in every warehouse, the earliest expiry first, with the reserved units spread over them
+func (r *Client) FindLots(sku string) ([]gen.Lot, error) {
+
+	rows, err := r.db.Query("SELECT sku, warehouse, lot, expires_at, quantity, expires_at<=UTC_TIMESTAMP() FROM stock_lot WHERE sku=? ORDER BY warehouse, expires_at, lot", sku)
+	if err != nil {
+		return nil, fmt.Errorf("Could not find the lots of Sku %s", sku)
+	}
+	defer rows.Close()
+
+	lots := []gen.Lot{}
+	for rows.Next() {
+		var l gen.Lot
+
+		err = rows.Scan(&l.Sku, &l.Warehouse, &l.Lot, &l.ExpiresAt, &l.Quantity, &l.Expired)
+		if err != nil {
+			return nil, fmt.Errorf("Error reading rows: %s", err.Error())
+		}
+
+		lots = append(lots, l)
+	}
+	rows.Close()
+
+	reserved := make(map[string]int64)
+	rows, err = r.db.Query("SELECT warehouse, IFNULL(SUM(quantity),0) FROM reservation WHERE sku=? AND (expires_at IS NULL OR expires_at>UTC_TIMESTAMP()) GROUP BY warehouse", sku)
+	if err != nil {
+		return nil, fmt.Errorf("Could not find the reservations of Sku %s", sku)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var warehouse string
+		var units int64
+
+		if err := rows.Scan(&warehouse, &units); err != nil {
+			return nil, fmt.Errorf("Error reading rows: %s", err.Error())
+		}
+		reserved[warehouse] = units
+	}
+
+	repo.AssignLots(lots, reserved)
+
+	return lots, nil
+}
+
+// Sets the quantity and expiry date of a lot of a sku in a warehouse, changing the quantity of the stock by the same units
+// Fails with 409 when the stock would go below the backorder limit of the sku. A lot without units is removed
+func (r *Client) UpdateLot(l *gen.Lot) error {
+	var quantity int64
+	var current int64
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("Could not update lot %s of Sku %s", l.Lot, l.Sku)
+	}
+	defer tx.Rollback()
+
+	// the stock row is locked before the lot, as the reservations do
+	_, err = tx.Exec("INSERT IGNORE INTO stock (sku, warehouse, quantity, updated_at) VALUES (?,?,0,now())", l.Sku, l.Warehouse)
+	if err != nil {
+		return fmt.Errorf("Could not update lot %s of Sku %s", l.Lot, l.Sku)
+	}
+
+	err = tx.QueryRow("SELECT quantity FROM stock WHERE sku=? AND warehouse=? FOR UPDATE", l.Sku, l.Warehouse).Scan(&quantity)
+	if err != nil {
+		return fmt.Errorf("Could not update lot %s of Sku %s", l.Lot, l.Sku)
+	}
+
+	err = tx.QueryRow("SELECT quantity FROM stock_lot WHERE sku=? AND warehouse=? AND lot=? FOR UPDATE", l.Sku, l.Warehouse, l.Lot).Scan(&current)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("Could not update lot %s of Sku %s", l.Lot, l.Sku)
+	}
+
+	delta := l.Quantity - current
+	if delta < 0 {
+		floor, err := backorderFloor(tx, l.Sku)
+		if err != nil {
+			return err
+		}
+		if quantity+delta < floor {
+			return fmt.Errorf("409")
+		}
+	}
+
+	if l.Quantity == 0 {
+		_, err = tx.Exec("DELETE FROM stock_lot WHERE sku=? AND warehouse=? AND lot=?", l.Sku, l.Warehouse, l.Lot)
+	} else {
+		_, err = tx.Exec("INSERT INTO stock_lot (sku, warehouse, lot, expires_at, quantity, updated_at) VALUES (?,?,?,?,?,now()) ON DUPLICATE KEY UPDATE expires_at=VALUES(expires_at), quantity=VALUES(quantity), updated_at=now()", l.Sku, l.Warehouse, l.Lot, l.ExpiresAt.UTC(), l.Quantity)
+	}
+	if err != nil {
+		return fmt.Errorf("Could not update lot %s of Sku %s", l.Lot, l.Sku)
+	}
+
+	// the expiry date alone changes the available units too
+	_, err = tx.Exec("UPDATE stock SET quantity=quantity+?, version=version+1, updated_at=now() WHERE sku=? AND warehouse=?", delta, l.Sku, l.Warehouse)
+	if err != nil {
+		return fmt.Errorf("Could not update lot %s of Sku %s", l.Lot, l.Sku)
+	}
+
+	if delta != 0 {
+		err = insertMovement(tx, &gen.StockMovement{Sku: l.Sku, Warehouse: l.Warehouse, Action: gen.ActionLot, Delta: delta, RequestId: l.RequestId, Caller: l.Caller})
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("Could not update lot %s of Sku %s", l.Lot, l.Sku)
+	}
+
+	return nil
+}
+
+// Retrieves the units of the expired lots of a sku in a warehouse inside the given transaction
+func expiredLots(tx *sql.Tx, sku string, warehouse string) (int64, error) {
+	var expired int64
+
+	err := tx.QueryRow("SELECT IFNULL(SUM(quantity),0) FROM stock_lot WHERE sku=? AND warehouse=? AND expires_at<=UTC_TIMESTAMP()", sku, warehouse).Scan(&expired)
+	if err != nil {
+		return 0, fmt.Errorf("Could not find the expired lots of Sku %s", sku)
+	}
+
+	return expired, nil
+}
+
+// Takes the units that left the stock of a sku in a warehouse out of its lots, first-expiry-first-out,
+// inside the given transaction and once the quantity of the stock was lowered
+// The units held by no lot are taken after the unexpired lots and before the expired ones
+func takeLots(tx *sql.Tx, sku string, warehouse string, units int64) error {
+	var quantity int64
+	var total int64
+
+	type held struct {
+		lot      string
+		quantity int64
+		expired  bool
+		taken    int64
+	}
+
+	err := tx.QueryRow("SELECT quantity FROM stock WHERE sku=? AND warehouse=?", sku, warehouse).Scan(&quantity)
+	if err != nil {
+		return fmt.Errorf("Could not take the lots of Sku %s", sku)
+	}
+
+	rows, err := tx.Query("SELECT lot, quantity, expires_at<=UTC_TIMESTAMP() FROM stock_lot WHERE sku=? AND warehouse=? ORDER BY expires_at, lot FOR UPDATE", sku, warehouse)
+	if err != nil {
+		return fmt.Errorf("Could not take the lots of Sku %s", sku)
+	}
+
+	var lots []*held
+	for rows.Next() {
+		h := new(held)
+		if err := rows.Scan(&h.lot, &h.quantity, &h.expired); err != nil {
+			rows.Close()
+			return fmt.Errorf("Error reading rows: %s", err.Error())
+		}
+		lots = append(lots, h)
+		total += h.quantity
+	}
+	rows.Close()
+
+	if len(lots) == 0 {
+		return nil
+	}
+
+	// the units held by no lot before the stock was lowered
+	loose := quantity + units - total
+	if loose < 0 {
+		loose = 0
+	}
+
+	left := units
+	for _, expired := range []bool{false, true} {
+		if expired {
+			if left <= loose {
+				break
+			}
+			left -= loose
+		}
+		for _, h := range lots {
+			if h.expired != expired || left == 0 {
+				continue
+			}
+			h.taken = h.quantity
+			if left < h.taken {
+				h.taken = left
+			}
+			left -= h.taken
+		}
+	}
+
+	for _, h := range lots {
+		switch {
+		case h.taken == 0:
+			continue
+		case h.taken == h.quantity:
+			_, err = tx.Exec("DELETE FROM stock_lot WHERE sku=? AND warehouse=? AND lot=?", sku, warehouse, h.lot)
+		default:
+			_, err = tx.Exec("UPDATE stock_lot SET quantity=quantity-?, updated_at=now() WHERE sku=? AND warehouse=? AND lot=?", h.taken, sku, warehouse, h.lot)
+		}
+		if err != nil {
+			return fmt.Errorf("Could not take the lots of Sku %s", sku)
+		}
+	}
+
+	return nil
+}
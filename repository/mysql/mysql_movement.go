@@ -0,0 +1,126 @@
+package mysql
+
+import (
+	"database/sql"
+	"fmt"
+	gen "github.com/pintobikez/stock-service/api/structures"
+	repo "github.com/pintobikez/stock-service/repository"
+	"time"
+)
+
+// Moves the row of the given table to the given status, records the stock movement if any and commits the transaction
+// The moment of the change is stored in the given column and in at
+func closeStep(tx *sql.Tx, table string, id int64, status string, column string, at **time.Time, m *gen.StockMovement) error {
+	now := time.Now().UTC().Truncate(time.Second)
+
+	_, err := tx.Exec("UPDATE "+table+" SET status=?, "+column+"=? WHERE id=?", status, now, id)
+	if err != nil {
+		return fmt.Errorf("Could not update %s %d", table, id)
+	}
+
+	if m != nil {
+		if err := insertMovement(tx, m); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("Could not update %s %d", table, id)
+	}
+
+	*at = &now
+	return nil
+}
+
+// Appends a StockMovement inside the given transaction
+// The resulting quantity and reserved units are read in the same statement, after the change was applied
+func insertMovement(tx *sql.Tx, m *gen.StockMovement) error {
+
+	_, err := tx.Exec(`INSERT INTO stock_movement (sku, warehouse, action, delta, quantity, reserved, adjustment_id, transfer_id, inbound_id, request_id, caller, created_at)
+		SELECT ?, ?, ?, ?,
+			IFNULL((SELECT quantity FROM stock WHERE sku=? AND warehouse=?),0),
+			(SELECT IFNULL(SUM(quantity),0) FROM reservation WHERE sku=? AND warehouse=? AND (expires_at IS NULL OR expires_at>UTC_TIMESTAMP())),
+			NULLIF(?,0), NULLIF(?,0), NULLIF(?,0), NULLIF(?,''), NULLIF(?,''), UTC_TIMESTAMP()`,
+		m.Sku, m.Warehouse, m.Action, m.Delta,
+		m.Sku, m.Warehouse,
+		m.Sku, m.Warehouse,
+		m.AdjustmentId, m.TransferId, m.InboundId, m.RequestId, m.Caller)
+
+	if err != nil {
+		return fmt.Errorf("Could not record the stock movement for Sku %s", m.Sku)
+	}
+
+	return nil
+}
+
+// Finds the StockMovements matching the filter, newest first
+func (r *Client) FindMovements(f *gen.MovementFilter) ([]gen.StockMovement, error) {
+
+	query := "SELECT id, sku, warehouse, action, delta, quantity, reserved, IFNULL(adjustment_id,0), IFNULL(transfer_id,0), IFNULL(inbound_id,0), IFNULL(request_id,''), IFNULL(caller,''), created_at FROM stock_movement WHERE sku=?"
+	args := []interface{}{f.Sku}
+
+	if f.Warehouse != "" {
+		query += " AND warehouse=?"
+		args = append(args, f.Warehouse)
+	}
+	if f.From != nil {
+		query += " AND created_at>=?"
+		args = append(args, f.From.UTC())
+	}
+	if f.To != nil {
+		query += " AND created_at<=?"
+		args = append(args, f.To.UTC())
+	}
+	if f.Cursor > 0 {
+		query += " AND id<?"
+		args = append(args, f.Cursor)
+	}
+
+	query += " ORDER BY id DESC LIMIT ?"
+	args = append(args, f.Limit)
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("Could not find the stock movements for Sku %s", f.Sku)
+	}
+	defer rows.Close()
+
+	movements := []gen.StockMovement{}
+	for rows.Next() {
+		var m gen.StockMovement
+
+		err = rows.Scan(&m.Id, &m.Sku, &m.Warehouse, &m.Action, &m.Delta, &m.Quantity, &m.Reserved, &m.AdjustmentId, &m.TransferId, &m.InboundId, &m.RequestId, &m.Caller, &m.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("Error reading rows: %s", err.Error())
+		}
+
+		movements = append(movements, m)
+	}
+
+	return movements, nil
+}
+
+// Finds by the sku value and Retrieves the SkuResponse it had at the given moment
+func (r *Client) FindSkuAsOf(sku string, asOf time.Time) (*gen.SkuResponse, error) {
+
+	rows, err := r.db.Query(`SELECT m.id, m.sku, m.warehouse, m.action, m.delta, m.quantity, m.reserved, m.created_at FROM stock_movement m
+		JOIN (SELECT MAX(id) as id FROM stock_movement WHERE sku=? AND created_at<=? GROUP BY warehouse) l ON l.id=m.id`, sku, asOf.UTC())
+	if err != nil {
+		return new(gen.SkuResponse), fmt.Errorf("Could not find the stock movements for Sku %s", sku)
+	}
+	defer rows.Close()
+
+	var movements []gen.StockMovement
+	for rows.Next() {
+		var m gen.StockMovement
+
+		err = rows.Scan(&m.Id, &m.Sku, &m.Warehouse, &m.Action, &m.Delta, &m.Quantity, &m.Reserved, &m.CreatedAt)
+		if err != nil {
+			return new(gen.SkuResponse), fmt.Errorf("Error reading rows: %s", err.Error())
+		}
+
+		movements = append(movements, m)
+	}
+
+	return repo.SkuAsOf(sku, movements, asOf)
+}
@@ -6,7 +6,12 @@ import (
 	_ "github.com/go-sql-driver/mysql"
 	gen "github.com/pintobikez/stock-service/api/structures"
 	cnfs "github.com/pintobikez/stock-service/config/structures"
+	repo "github.com/pintobikez/stock-service/repository"
+	"math"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 )
 
 const (
@@ -16,14 +21,20 @@ const (
 type Client struct {
 	config *cnfs.DatabaseConfig
 	db     *sql.DB
+	safety int64
 }
 
-func New(cnfg *cnfs.DatabaseConfig) (*Client, error) {
+// Creates a Client, the stock configuration holds the global safety stock and is optional
+func New(cnfg *cnfs.DatabaseConfig, stock *cnfs.StockConfig) (*Client, error) {
 	if cnfg == nil {
 		return nil, fmt.Errorf("Client configuration not loaded")
 	}
 
-	return &Client{config: cnfg}, nil
+	c := &Client{config: cnfg}
+	if stock != nil {
+		c.safety = stock.SafetyStock
+	}
+	return c, nil
 }
 
 // Connects to the mysql database
@@ -49,31 +60,38 @@ func (r *Client) Disconnect() {
 // Find by the sku value and a warehouse and Retrives an Sku
 func (r *Client) FindBySkuAndWharehouse(sku string, warehouse string) (*gen.Sku, error) {
 	var quantity int64
-	var found bool
-
-	err := r.db.QueryRow("SELECT IF(COUNT(*),'true','false') FROM stock WHERE sku=? AND warehouse=?", sku, warehouse).Scan(&found)
-	if err != nil {
-		return &gen.Sku{}, fmt.Errorf(err.Error())
-	}
+	var version int64
 
-	if !found {
+	err := r.db.QueryRow("SELECT quantity, version FROM stock WHERE sku=? AND warehouse=?", sku, warehouse).Scan(&quantity, &version)
+	if err == sql.ErrNoRows {
 		return &gen.Sku{}, nil
 	}
-
-	err = r.db.QueryRow("SELECT quantity FROM stock WHERE sku=? AND warehouse=?", sku, warehouse).Scan(&quantity)
 	if err != nil {
-		return &gen.Sku{}, fmt.Errorf(err.Error())
+		return &gen.Sku{}, err
 	}
 
-	return &gen.Sku{Sku: sku, Warehouse: warehouse, Quantity: quantity}, nil
+	return &gen.Sku{Sku: sku, Warehouse: warehouse, Quantity: quantity, Version: version}, nil
 }
 
 // Finds by the sku value and Retrives an SkuResponse
+// The stock of a bundle is derived from the stock of its components
 func (r *Client) FindSku(sku string) (*gen.SkuResponse, error) {
 
 	var resp *gen.SkuResponse = new(gen.SkuResponse)
 
-	rows, err := r.db.Query("SELECT sku, warehouse, quantity, reserved, (quantity-reserved) as avail FROM (select s.sku, s.quantity, s.warehouse, (select count(*) from reservation where sku=s.sku and warehouse=s.warehouse) as reserved from stock s where s.sku=?) as t", sku)
+	b, err := r.FindBundle(sku)
+	if err != nil {
+		return resp, err
+	}
+	if len(b.Components) > 0 {
+		components, err := r.FindSkus(componentSkus([]*gen.Bundle{b}))
+		if err != nil {
+			return resp, err
+		}
+		return repo.BundleStock(b, components), nil
+	}
+
+	rows, err := r.db.Query(stockQuery("s.sku=?"), r.safety, sku)
 
 	if err != nil {
 		return resp, err
@@ -83,22 +101,23 @@ func (r *Client) FindSku(sku string) (*gen.SkuResponse, error) {
 
 	for rows.Next() {
 		var sku string
-		var warehouse string
-		var quantity int64
-		var reserved int64
-		var avail int64
+		var v gen.SkuValues
+		var updated *time.Time
 
-		err = rows.Scan(&sku, &warehouse, &quantity, &reserved, &avail)
+		err = rows.Scan(&sku, &v.Warehouse, &v.Quantity, &v.Version, &v.Reserved, &v.SafetyStock, &v.RawAvailable, &v.Available, &v.Backordered, &v.Expired, &updated)
 		if err != nil {
 			return resp, fmt.Errorf("Error reading rows: %s", err.Error())
 		}
 
-		aux := gen.SkuValues{Quantity: quantity, Warehouse: warehouse}
-		arr = append(arr, aux)
+		arr = append(arr, v)
 
 		resp.Sku = sku
-		resp.Reserved += reserved
-		resp.Available += avail
+		resp.Reserved += v.Reserved
+		resp.SafetyStock += v.SafetyStock
+		resp.RawAvailable += v.RawAvailable
+		resp.Available += v.Available
+		resp.Backordered += v.Backordered
+		resp.Expired += v.Expired
 		resp.Values = arr
 	}
 
@@ -108,109 +127,768 @@ func (r *Client) FindSku(sku string) (*gen.SkuResponse, error) {
 		return resp, fmt.Errorf("%s not found", sku)
 	}
 
+	// units shipped between warehouses and not received yet
+	err = r.db.QueryRow("SELECT IFNULL(SUM(quantity),0) FROM transfer WHERE sku=? AND status=?", sku, gen.TransferShipped).Scan(&resp.InTransit)
+	if err != nil {
+		return resp, fmt.Errorf("Could not find the transfers of Sku %s", sku)
+	}
+
+	allocations, err := r.FindChannelAllocations(sku)
+	if err != nil {
+		return resp, err
+	}
+	repo.ApplyChannels(resp, allocations)
+
 	return resp, nil
 }
 
-// Updates the given Sku
-func (r *Client) UpdateSku(s *gen.Sku) (int64, error) {
+// Finds by the sku values in a single query and Retrieves the SkuResponse of each sku found
+func (r *Client) FindSkus(skus []string) (map[string]*gen.SkuResponse, error) {
+	found := make(map[string]*gen.SkuResponse)
+	if len(skus) == 0 {
+		return found, nil
+	}
+
+	args := make([]interface{}, len(skus))
+	for i, sku := range skus {
+		args[i] = sku
+	}
+	in := strings.TrimSuffix(strings.Repeat("?,", len(skus)), ",")
+
+	// the stock of a bundle is derived from the stock of its components, which are never bundles
+	derived, err := bundles(r.db, "bundle IN ("+in+")", args...)
+	if err != nil {
+		return nil, err
+	}
+	if len(derived) > 0 {
+		components, err := r.FindSkus(componentSkus(derived))
+		if err != nil {
+			return nil, err
+		}
+
+		bundled := make(map[string]bool)
+		for _, b := range derived {
+			bundled[b.Sku] = true
+		}
+		var others []string
+		for _, sku := range skus {
+			if !bundled[sku] {
+				others = append(others, sku)
+			}
+		}
+
+		found, err = r.FindSkus(others)
+		if err != nil {
+			return nil, err
+		}
+		for _, b := range derived {
+			found[b.Sku] = repo.BundleStock(b, components)
+		}
+		return found, nil
+	}
+
+	rows, err := r.db.Query(stockQuery("s.sku IN ("+in+")"), append([]interface{}{r.safety}, args...)...)
+	if err != nil {
+		return nil, fmt.Errorf("Could not find Skus: %s", err.Error())
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var v gen.SkuValues
+		var sku string
+		var updated *time.Time
 
-	stmt, err := r.db.Prepare("UPDATE stock SET quantity=? WHERE sku=? AND warehouse=?")
+		err = rows.Scan(&sku, &v.Warehouse, &v.Quantity, &v.Version, &v.Reserved, &v.SafetyStock, &v.RawAvailable, &v.Available, &v.Backordered, &v.Expired, &updated)
+		if err != nil {
+			return nil, fmt.Errorf("Error reading rows: %s", err.Error())
+		}
 
+		resp, ok := found[sku]
+		if !ok {
+			resp = &gen.SkuResponse{Sku: sku}
+			found[sku] = resp
+		}
+		resp.Values = append(resp.Values, v)
+		resp.Reserved += v.Reserved
+		resp.SafetyStock += v.SafetyStock
+		resp.RawAvailable += v.RawAvailable
+		resp.Available += v.Available
+		resp.Backordered += v.Backordered
+		resp.Expired += v.Expired
+	}
+
+	// units shipped between warehouses and not received yet
+	transit, err := r.db.Query("SELECT sku, SUM(quantity) FROM transfer WHERE sku IN ("+in+") AND status=? GROUP BY sku", append(args, gen.TransferShipped)...)
 	if err != nil {
-		return 0, fmt.Errorf("Error in update stock prepared statement: %s", err.Error())
+		return nil, fmt.Errorf("Could not find the transfers of Skus: %s", err.Error())
 	}
+	defer transit.Close()
 
-	res, err := stmt.Exec(s.Quantity, s.Sku, s.Warehouse)
+	for transit.Next() {
+		var sku string
+		var quantity int64
+
+		if err := transit.Scan(&sku, &quantity); err != nil {
+			return nil, fmt.Errorf("Error reading rows: %s", err.Error())
+		}
+		if resp, ok := found[sku]; ok {
+			resp.InTransit = quantity
+		}
+	}
 
+	allocations, err := channelAllocations(r.db, "c.sku IN ("+in+")", args...)
+	if err != nil {
+		return nil, err
+	}
+	bySku := make(map[string][]gen.ChannelAllocation)
+	for _, c := range allocations {
+		bySku[c.Sku] = append(bySku[c.Sku], c)
+	}
+	for sku, resp := range found {
+		repo.ApplyChannels(resp, bySku[sku])
+	}
+
+	return found, nil
+}
+
+// Updates the given Sku
+// When the Sku carries a version the update only happens if the stored version still matches it
+func (r *Client) UpdateSku(s *gen.Sku) (int64, error) {
+	var quantity int64
+	var version int64
+
+	tx, err := r.db.Begin()
 	if err != nil {
 		return 0, fmt.Errorf("Could not update stock for Sku %s", s.Sku)
 	}
+	defer tx.Rollback()
 
-	affect, err := res.RowsAffected()
+	err = tx.QueryRow("SELECT quantity, version FROM stock WHERE sku=? AND warehouse=? FOR UPDATE", s.Sku, s.Warehouse).Scan(&quantity, &version)
+	if err == sql.ErrNoRows {
+		if s.Version > 0 {
+			return 0, fmt.Errorf("412")
+		}
+		return 0, nil
+	}
 	if err != nil {
 		return 0, fmt.Errorf("Could not update stock for Sku %s", s.Sku)
 	}
 
-	if affect < 0 {
-		return affect, fmt.Errorf("Error updating stock for Sku %s", s.Sku)
+	if s.Version > 0 && s.Version != version {
+		return 0, fmt.Errorf("412")
+	}
+	if s.Quantity == quantity {
+		return 0, nil
 	}
 
-	defer stmt.Close()
+	_, err = tx.Exec("UPDATE stock SET quantity=?, version=version+1, updated_at=now() WHERE sku=? AND warehouse=?", s.Quantity, s.Sku, s.Warehouse)
+	if err != nil {
+		return 0, fmt.Errorf("Could not update stock for Sku %s", s.Sku)
+	}
 
-	return affect, nil
+	if s.Quantity < quantity {
+		if err := takeLots(tx, s.Sku, s.Warehouse, quantity-s.Quantity); err != nil {
+			return 0, err
+		}
+	}
+
+	err = insertMovement(tx, &gen.StockMovement{Sku: s.Sku, Warehouse: s.Warehouse, Action: gen.ActionSet, Delta: s.Quantity - quantity, RequestId: s.RequestId, Caller: s.Caller})
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("Could not update stock for Sku %s", s.Sku)
+	}
+
+	return 1, nil
 }
 
 // Inserts the given Sku
 func (r *Client) InsertSku(s *gen.Sku) error {
 
-	stmt, err := r.db.Prepare("INSERT INTO stock VALUES (?,?,?,now())")
-
+	tx, err := r.db.Begin()
 	if err != nil {
-		return fmt.Errorf("Error in insert stock prepared statement: %s", err.Error())
+		return fmt.Errorf("Could not insert stock for Sku %s", s.Sku)
 	}
+	defer tx.Rollback()
 
-	res, err := stmt.Exec(s.Sku, s.Warehouse, s.Quantity)
-
+	_, err = tx.Exec("INSERT INTO stock (sku, warehouse, quantity, updated_at) VALUES (?,?,?,now())", s.Sku, s.Warehouse, s.Quantity)
 	if err != nil {
 		return fmt.Errorf("Could not insert stock for Sku %s", s.Sku)
 	}
-	res.LastInsertId()
 
-	defer stmt.Close()
+	err = insertMovement(tx, &gen.StockMovement{Sku: s.Sku, Warehouse: s.Warehouse, Action: gen.ActionSet, Delta: s.Quantity, RequestId: s.RequestId, Caller: s.Caller})
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("Could not insert stock for Sku %s", s.Sku)
+	}
 
 	return nil
 }
 
-// Inserts an Sku Reservation
-func (r *Client) InsertReservation(re *gen.Reservation) error {
+// Adds the delta to the quantity of the given Sku and Retrieves the resulting quantity
+// The change runs as a single statement so concurrent adjustments are not lost, and never takes the quantity below
+// the backorder limit of the sku, which is zero unless the sku can be backordered
+// When the Sku carries a version the adjustment only happens if the stored version still matches it
+// Fails with 404 when the sku is not stored in the warehouse and the adjustment can not add it
+func (r *Client) AdjustSku(s *gen.Sku, delta int64) (int64, error) {
+	var quantity int64
+	var res sql.Result
+	var floor int64 = math.MinInt64
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("Could not adjust stock for Sku %s", s.Sku)
+	}
+	defer tx.Rollback()
+
+	if delta < 0 {
+		floor, err = backorderFloor(tx, s.Sku)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	switch {
+	case s.Version > 0:
+		res, err = tx.Exec("UPDATE stock SET quantity=quantity+?, version=version+1, updated_at=now() WHERE sku=? AND warehouse=? AND quantity+?>=? AND version=?", delta, s.Sku, s.Warehouse, delta, floor, s.Version)
+	case delta >= 0:
+		res, err = tx.Exec("INSERT INTO stock (sku, warehouse, quantity, updated_at) VALUES (?,?,?,now()) ON DUPLICATE KEY UPDATE quantity=quantity+VALUES(quantity), version=version+1, updated_at=now()", s.Sku, s.Warehouse, delta)
+	default:
+		res, err = tx.Exec("UPDATE stock SET quantity=quantity+?, version=version+1, updated_at=now() WHERE sku=? AND warehouse=? AND quantity+?>=?", delta, s.Sku, s.Warehouse, delta, floor)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("Could not adjust stock for Sku %s", s.Sku)
+	}
+
+	affect, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("Could not adjust stock for Sku %s", s.Sku)
+	}
+
+	if affect == 0 {
+		var current int64
+
+		// tells apart a missing row and a version that moved on from a quantity that would go below the backorder limit
+		err = tx.QueryRow("SELECT version FROM stock WHERE sku=? AND warehouse=?", s.Sku, s.Warehouse).Scan(&current)
+		if err == sql.ErrNoRows {
+			return 0, fmt.Errorf("404")
+		}
+		if err != nil {
+			return 0, fmt.Errorf("Could not adjust stock for Sku %s", s.Sku)
+		}
+		if s.Version > 0 && current != s.Version {
+			return 0, fmt.Errorf("412")
+		}
+		return 0, fmt.Errorf("409")
+	}
+
+	action := gen.ActionAdd
+	if delta < 0 {
+		action = gen.ActionSub
+
+		if err := takeLots(tx, s.Sku, s.Warehouse, -delta); err != nil {
+			return 0, err
+		}
+	}
+
+	err = insertMovement(tx, &gen.StockMovement{Sku: s.Sku, Warehouse: s.Warehouse, Action: action, Delta: delta, RequestId: s.RequestId, Caller: s.Caller})
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.QueryRow("SELECT quantity FROM stock WHERE sku=? AND warehouse=?", s.Sku, s.Warehouse).Scan(&quantity)
+	if err != nil {
+		return 0, fmt.Errorf("Could not adjust stock for Sku %s", s.Sku)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("Could not adjust stock for Sku %s", s.Sku)
+	}
+
+	return quantity, nil
+}
+
+// Finds a Reservation by its id
+func (r *Client) FindReservation(id int64) (*gen.Reservation, error) {
+	re := new(gen.Reservation)
+
+	err := r.db.QueryRow("SELECT id, sku, warehouse, quantity, IFNULL(reference,''), IFNULL(channel,''), preorder, expires_at FROM reservation WHERE id=? AND (expires_at IS NULL OR expires_at>UTC_TIMESTAMP())", id).Scan(&re.Id, &re.Sku, &re.Warehouse, &re.Quantity, &re.Reference, &re.Channel, &re.Preorder, &re.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return &gen.Reservation{}, nil
+	}
+	if err != nil {
+		return &gen.Reservation{}, fmt.Errorf("Could not find reservation %d: %s", id, err.Error())
+	}
+
+	re.Serials, err = reservationSerials(r.db, id)
+	if err != nil {
+		return &gen.Reservation{}, err
+	}
+
+	return re, nil
+}
+
+// Inserts an Sku Reservation and Retrieves its id
+// The stock row is locked while checking the available quantity so concurrent reservations can not oversell
+func (r *Client) InsertReservation(re *gen.Reservation) (int64, error) {
 
-	stmt, err := r.db.Prepare("INSERT INTO reservation VALUES (?,?,now())")
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("Could not insert reservation for Sku %s", re.Sku)
+	}
+	defer tx.Rollback()
 
+	id, err := r.insertReservation(tx, re)
 	if err != nil {
-		return fmt.Errorf("Error in insert reservation prepared statement: %s", err.Error())
+		return 0, err
 	}
 
-	res, err := stmt.Exec(re.Sku, re.Warehouse)
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("Could not insert reservation for Sku %s", re.Sku)
+	}
+
+	return id, nil
+}
 
+// Inserts several Sku Reservations at once, setting their ids
+// Every reservation is stored or none
+func (r *Client) InsertReservations(res []*gen.Reservation) error {
+
+	tx, err := r.db.Begin()
 	if err != nil {
-		return fmt.Errorf("Could not insert reservation for Sku %s", re.Sku)
+		return fmt.Errorf("Could not insert the reservations")
 	}
-	res.LastInsertId()
+	defer tx.Rollback()
+
+	return r.commitReservations(tx, res)
+}
 
-	defer stmt.Close()
+// Inserts the Reservations of the lines of a new Order at once, setting their ids
+// Fails with 412 when the order already holds unexpired reservations, and nothing is stored
+func (r *Client) InsertOrder(o *gen.Order, res []*gen.Reservation) error {
+	var held int64
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("Could not insert the reservations of order %s", o.Order)
+	}
+	defer tx.Rollback()
+
+	// the reference index is locked so a concurrent order with the same reference waits for this one
+	err = tx.QueryRow("SELECT COUNT(*) FROM reservation WHERE reference=? AND (expires_at IS NULL OR expires_at>UTC_TIMESTAMP()) FOR UPDATE", o.Order).Scan(&held)
+	if err != nil {
+		return fmt.Errorf("Could not insert the reservations of order %s", o.Order)
+	}
+	if held > 0 {
+		return fmt.Errorf("412")
+	}
+
+	return r.commitReservations(tx, res)
+}
+
+// Inserts the given Reservations inside the given transaction and commits it, setting their ids
+// The stock rows are locked in sku and warehouse order to not deadlock
+func (r *Client) commitReservations(tx *sql.Tx, res []*gen.Reservation) error {
+
+	sorted := make([]*gen.Reservation, len(res))
+	copy(sorted, res)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Sku != sorted[j].Sku {
+			return sorted[i].Sku < sorted[j].Sku
+		}
+		return sorted[i].Warehouse < sorted[j].Warehouse
+	})
+
+	ids := make(map[*gen.Reservation]int64)
+	for _, re := range sorted {
+		id, err := r.insertReservation(tx, re)
+		if err != nil {
+			return err
+		}
+		ids[re] = id
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("Could not insert the reservations")
+	}
+
+	for re, id := range ids {
+		re.Id = id
+	}
 
 	return nil
 }
 
-// Deletes an Sku Reservation
+// Inserts an Sku Reservation inside the given transaction and Retrieves its id
+// The safety stock of the sku is kept aside from the units that can be reserved, and a serialized sku holds serial numbers
+func (r *Client) insertReservation(tx *sql.Tx, re *gen.Reservation) (int64, error) {
+	var quantity int64
+	var reserved int64
+
+	err := tx.QueryRow("SELECT quantity FROM stock WHERE sku=? AND warehouse=? FOR UPDATE", re.Sku, re.Warehouse).Scan(&quantity)
+	if err == sql.ErrNoRows {
+		return 0, fmt.Errorf("404")
+	}
+	if err != nil {
+		return 0, fmt.Errorf("Could not insert reservation for Sku %s", re.Sku)
+	}
+
+	err = tx.QueryRow("SELECT IFNULL(SUM(quantity),0) FROM reservation WHERE sku=? AND warehouse=? AND (expires_at IS NULL OR expires_at>UTC_TIMESTAMP())", re.Sku, re.Warehouse).Scan(&reserved)
+	if err != nil {
+		return 0, fmt.Errorf("Could not insert reservation for Sku %s", re.Sku)
+	}
+
+	safety, err := r.safetyStock(tx, re.Sku, re.Warehouse)
+	if err != nil {
+		return 0, err
+	}
+
+	// the units of the expired lots can not be sold
+	expired, err := expiredLots(tx, re.Sku, re.Warehouse)
+	if err != nil {
+		return 0, err
+	}
+
+	// the units ring-fenced for the other channels can not be taken, nor more than the allocation of the channel
+	allocations, err := channelAllocations(tx, "c.sku=? AND c.warehouse=?", re.Sku, re.Warehouse)
+	if err != nil {
+		return 0, err
+	}
+	others, own, fenced := repo.ChannelFences(allocations, re.Channel)
+	if fenced && own < re.Quantity {
+		return 0, fmt.Errorf("409")
+	}
+
+	// a pre-orderable sku can also promise the units of its inbound supply,
+	// and a backorderable one can be short of the units down to its backorder limit
+	// The backorder limit is counted from the stock without the safety stock, which a backorder already goes past
+	re.Preorder = false
+	short := quantity - expired - reserved - others - re.Quantity
+	if short-safety < 0 {
+		inbound, err := promisable(tx, re.Sku, re.Warehouse)
+		if err != nil {
+			return 0, err
+		}
+		re.Preorder = inbound > 0
+		short += inbound
+	}
+	if short-safety < 0 {
+		floor, err := backorderFloor(tx, re.Sku)
+		if err != nil {
+			return 0, err
+		}
+		if floor == 0 || short < floor {
+			return 0, fmt.Errorf("409")
+		}
+	}
+
+	res, err := tx.Exec("INSERT INTO reservation (sku, warehouse, quantity, reference, channel, preorder, expires_at, created_at) VALUES (?,?,?,NULLIF(?,''),NULLIF(?,''),?,?,now())", re.Sku, re.Warehouse, re.Quantity, re.Reference, re.Channel, re.Preorder, re.ExpiresAt)
+	if err != nil {
+		return 0, fmt.Errorf("Could not insert reservation for Sku %s", re.Sku)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("Could not insert reservation for Sku %s", re.Sku)
+	}
+
+	// the units of a serialized sku are its serial numbers
+	tracked, err := serialized(tx, re.Sku)
+	if err != nil {
+		return 0, err
+	}
+	if tracked || len(re.Serials) > 0 {
+		if err := holdSerials(tx, re, id); err != nil {
+			return 0, err
+		}
+	}
+
+	err = insertMovement(tx, &gen.StockMovement{Sku: re.Sku, Warehouse: re.Warehouse, Action: gen.ActionReserve, Delta: re.Quantity, RequestId: re.RequestId, Caller: re.Caller})
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// Releases the given quantity of a Reservation, deleting it once every unit is released
+// The serial numbers of the released units are free again
 func (r *Client) DeleteReservation(re *gen.Reservation) error {
 
-	stmt, err := r.db.Prepare("DELETE FROM reservation WHERE sku=? AND warehouse=? ORDER BY created_at ASC LIMIT 1")
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("Could not delete reservation %d", re.Id)
+	}
+	defer tx.Rollback()
+
+	if err := takeReservation(tx, re); err != nil {
+		return err
+	}
+
+	if err := takeSerials(tx, re, false); err != nil {
+		return err
+	}
 
+	err = insertMovement(tx, &gen.StockMovement{Sku: re.Sku, Warehouse: re.Warehouse, Action: gen.ActionRelease, Delta: -re.Quantity, RequestId: re.RequestId, Caller: re.Caller})
 	if err != nil {
-		return fmt.Errorf("Error in delete reservation prepared statement: %s", err.Error())
+		return err
 	}
 
-	res, err := stmt.Exec(re.Sku, re.Warehouse)
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("Could not delete reservation %d", re.Id)
+	}
+
+	return nil
+}
+
+// Releases every unexpired Reservation of an order and Retrieves the skus they were holding
+// The serial numbers they hold are free again
+// Fails with 404 when the order holds no reservation
+func (r *Client) DeleteReservations(o *gen.Order) ([]string, error) {
 
+	tx, err := r.db.Begin()
 	if err != nil {
-		return fmt.Errorf("Could not delete reservation for Sku %s", re.Sku)
+		return nil, fmt.Errorf("Could not delete the reservations of order %s", o.Order)
 	}
+	defer tx.Rollback()
 
-	affect, err := res.RowsAffected()
+	rows, err := tx.Query("SELECT id, sku, warehouse, quantity FROM reservation WHERE reference=? AND (expires_at IS NULL OR expires_at>UTC_TIMESTAMP()) ORDER BY sku, warehouse, id FOR UPDATE", o.Order)
 	if err != nil {
-		return fmt.Errorf("Could not delete reservation forSku %s", re.Sku)
+		return nil, fmt.Errorf("Could not find the reservations of order %s: %s", o.Order, err.Error())
 	}
 
-	if affect == 0 {
+	var found []gen.Reservation
+	for rows.Next() {
+		var re gen.Reservation
+		if err := rows.Scan(&re.Id, &re.Sku, &re.Warehouse, &re.Quantity); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("Error reading rows: %s", err.Error())
+		}
+		found = append(found, re)
+	}
+	rows.Close()
+
+	if len(found) == 0 {
+		return nil, fmt.Errorf("404")
+	}
+
+	var ids []interface{}
+	for _, re := range found {
+		ids = append(ids, re.Id)
+	}
+	if err := freeSerials(tx, ids); err != nil {
+		return nil, err
+	}
+
+	var skus []string
+	seen := make(map[string]bool)
+	for _, re := range found {
+		_, err = tx.Exec("DELETE FROM reservation WHERE id=?", re.Id)
+		if err != nil {
+			return nil, fmt.Errorf("Could not delete the reservations of order %s", o.Order)
+		}
+
+		err = insertMovement(tx, &gen.StockMovement{Sku: re.Sku, Warehouse: re.Warehouse, Action: gen.ActionRelease, Delta: -re.Quantity, RequestId: o.RequestId, Caller: o.Caller})
+		if err != nil {
+			return nil, err
+		}
+
+		if !seen[re.Sku] {
+			seen[re.Sku] = true
+			skus = append(skus, re.Sku)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("Could not delete the reservations of order %s", o.Order)
+	}
+
+	return skus, nil
+}
+
+// Takes the given quantity of a Reservation and the same units from the stock, deleting it once every unit is taken
+// The serial numbers of the taken units leave the stock
+// Fails with 404 when the reservation expired or does not hold the units, and with 409 when the units are not on hand
+// and the stock would go below the backorder limit of the sku, as for a pre-order whose inbound supply was not received
+func (r *Client) CommitReservation(re *gen.Reservation) error {
+	var found int64
+	var quantity int64
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("Could not commit reservation %d", re.Id)
+	}
+	defer tx.Rollback()
+
+	// the stock row is locked before the reservation, as the reservations do
+	_, err = tx.Exec("UPDATE stock SET quantity=quantity-?, version=version+1, updated_at=now() WHERE sku=? AND warehouse=?", re.Quantity, re.Sku, re.Warehouse)
+	if err != nil {
+		return fmt.Errorf("Could not commit reservation %d", re.Id)
+	}
+
+	err = tx.QueryRow("SELECT 1 FROM reservation WHERE id=? AND sku=? AND warehouse=? AND (expires_at IS NULL OR expires_at>UTC_TIMESTAMP()) FOR UPDATE", re.Id, re.Sku, re.Warehouse).Scan(&found)
+	if err == sql.ErrNoRows {
 		return fmt.Errorf("404")
 	}
+	if err != nil {
+		return fmt.Errorf("Could not commit reservation %d", re.Id)
+	}
+
+	err = tx.QueryRow("SELECT quantity FROM stock WHERE sku=? AND warehouse=?", re.Sku, re.Warehouse).Scan(&quantity)
+	if err != nil {
+		return fmt.Errorf("Could not commit reservation %d", re.Id)
+	}
+
+	floor, err := backorderFloor(tx, re.Sku)
+	if err != nil {
+		return err
+	}
+	if quantity < floor {
+		return fmt.Errorf("409")
+	}
 
-	defer stmt.Close()
+	if err := takeReservation(tx, re); err != nil {
+		return err
+	}
+
+	if err := takeSerials(tx, re, true); err != nil {
+		return err
+	}
+
+	// the shipped units leave the lots that expire first
+	if err := takeLots(tx, re.Sku, re.Warehouse, re.Quantity); err != nil {
+		return err
+	}
+
+	err = insertMovement(tx, &gen.StockMovement{Sku: re.Sku, Warehouse: re.Warehouse, Action: gen.ActionCommit, Delta: -re.Quantity, RequestId: re.RequestId, Caller: re.Caller})
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("Could not commit reservation %d", re.Id)
+	}
 
 	return nil
 }
 
+// Takes the given quantity of a Reservation inside the given transaction, deleting it once every unit is taken
+func takeReservation(tx *sql.Tx, re *gen.Reservation) error {
+
+	res, err := tx.Exec("UPDATE reservation SET quantity=quantity-? WHERE id=? AND quantity>?", re.Quantity, re.Id, re.Quantity)
+	if err != nil {
+		return fmt.Errorf("Could not take units of reservation %d", re.Id)
+	}
+
+	affect, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("Could not take units of reservation %d", re.Id)
+	}
+
+	if affect == 0 {
+		res, err = tx.Exec("DELETE FROM reservation WHERE id=? AND quantity=?", re.Id, re.Quantity)
+		if err != nil {
+			return fmt.Errorf("Could not take units of reservation %d", re.Id)
+		}
+
+		affect, err = res.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("Could not take units of reservation %d", re.Id)
+		}
+
+		if affect == 0 {
+			return fmt.Errorf("404")
+		}
+	}
+
+	return nil
+}
+
+// Deletes up to limit expired Reservations and Retrieves how many were deleted and the skus they were holding
+// The serial numbers they hold are free again
+func (r *Client) DeleteExpiredReservations(limit int64) (int64, []string, error) {
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, nil, fmt.Errorf("Could not delete expired reservations: %s", err.Error())
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query("SELECT id, sku, warehouse, quantity FROM reservation WHERE expires_at<=UTC_TIMESTAMP() ORDER BY expires_at ASC LIMIT ? FOR UPDATE", limit)
+	if err != nil {
+		return 0, nil, fmt.Errorf("Could not find expired reservations: %s", err.Error())
+	}
+
+	var ids []interface{}
+	var skus []string
+	var released []*gen.StockMovement
+	seen := make(map[string]bool)
+	movements := make(map[[2]string]*gen.StockMovement)
+
+	for rows.Next() {
+		var id int64
+		var quantity int64
+		var sku string
+		var warehouse string
+
+		if err := rows.Scan(&id, &sku, &warehouse, &quantity); err != nil {
+			rows.Close()
+			return 0, nil, fmt.Errorf("Error reading rows: %s", err.Error())
+		}
+
+		ids = append(ids, id)
+		if !seen[sku] {
+			seen[sku] = true
+			skus = append(skus, sku)
+		}
+
+		// one movement per sku and warehouse with every unit released
+		m, ok := movements[[2]string{sku, warehouse}]
+		if !ok {
+			m = &gen.StockMovement{Sku: sku, Warehouse: warehouse, Action: gen.ActionExpire}
+			movements[[2]string{sku, warehouse}] = m
+			released = append(released, m)
+		}
+		m.Delta -= quantity
+	}
+	rows.Close()
+
+	if len(ids) == 0 {
+		return 0, skus, nil
+	}
+
+	if err := freeSerials(tx, ids); err != nil {
+		return 0, nil, err
+	}
+
+	res, err := tx.Exec("DELETE FROM reservation WHERE id IN (?"+strings.Repeat(",?", len(ids)-1)+")", ids...)
+	if err != nil {
+		return 0, nil, fmt.Errorf("Could not delete expired reservations: %s", err.Error())
+	}
+
+	affect, err := res.RowsAffected()
+	if err != nil {
+		return 0, nil, fmt.Errorf("Could not delete expired reservations: %s", err.Error())
+	}
+
+	for _, m := range released {
+		if err := insertMovement(tx, m); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, nil, fmt.Errorf("Could not delete expired reservations: %s", err.Error())
+	}
+
+	return affect, skus, nil
+}
+
 // Health Endpoint of the Client
 func (r *Client) Health() error {
 
@@ -0,0 +1,69 @@
+package mysql
+
+import (
+	"database/sql"
+	"fmt"
+	gen "github.com/pintobikez/stock-service/api/structures"
+)
+
+// Units of a stock row that can be sold, the available units less the expired lots and the safety stock
+// The safety stock never turns the available units negative, but a row already short of stock stays so
+const sellable = "LEAST(quantity-expired-reserved, GREATEST(quantity-expired-reserved-safety_stock, 0))"
+
+// Builds the query of the stock rows matching the where clause, with their reserved units, safety stock,
+// raw and sellable available units, units sold beyond the quantity and units of expired lots. The safety stock of the sku wins over the one of its warehouse and over the
+// global one, which is the first argument of the query
+func stockQuery(where string) string {
+	return "SELECT sku, warehouse, quantity, version, reserved, safety_stock, (quantity-expired-reserved) as raw_avail, " + sellable + " as avail, GREATEST(reserved-quantity, 0) as backordered, expired, updated_at FROM (" +
+		"select s.sku, s.warehouse, s.quantity, s.version, s.updated_at, " +
+		"(select IFNULL(SUM(quantity),0) from reservation where sku=s.sku and warehouse=s.warehouse and (expires_at IS NULL OR expires_at>UTC_TIMESTAMP())) as reserved, " +
+		"(select IFNULL(SUM(quantity),0) from stock_lot where sku=s.sku and warehouse=s.warehouse and expires_at<=UTC_TIMESTAMP()) as expired, " +
+		"COALESCE(s.safety_stock, w.safety_stock, ?) as safety_stock " +
+		"from stock s LEFT JOIN warehouse w ON w.code=s.warehouse WHERE " + where + ") as t"
+}
+
+// Retrieves the safety stock of a sku in a warehouse inside the given transaction
+func (r *Client) safetyStock(tx *sql.Tx, sku string, warehouse string) (int64, error) {
+	var safety sql.NullInt64
+
+	err := tx.QueryRow("SELECT COALESCE((SELECT safety_stock FROM stock WHERE sku=? AND warehouse=?), (SELECT safety_stock FROM warehouse WHERE code=?))", sku, warehouse, warehouse).Scan(&safety)
+	if err != nil {
+		return 0, fmt.Errorf("Could not find the safety stock of Sku %s", sku)
+	}
+
+	if !safety.Valid {
+		return r.safety, nil
+	}
+	return safety.Int64, nil
+}
+
+// Sets the safety stock of a sku in a warehouse, failing with 404 when the sku is not stored in the warehouse
+// A nil safety stock falls back to the one of the warehouse
+func (r *Client) UpdateSafetyStock(s *gen.SafetyStock) error {
+	var found int64
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("Could not update the safety stock of Sku %s", s.Sku)
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow("SELECT 1 FROM stock WHERE sku=? AND warehouse=? FOR UPDATE", s.Sku, s.Warehouse).Scan(&found)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("404")
+	}
+	if err != nil {
+		return fmt.Errorf("Could not update the safety stock of Sku %s", s.Sku)
+	}
+
+	_, err = tx.Exec("UPDATE stock SET safety_stock=?, updated_at=now() WHERE sku=? AND warehouse=?", s.SafetyStock, s.Sku, s.Warehouse)
+	if err != nil {
+		return fmt.Errorf("Could not update the safety stock of Sku %s", s.Sku)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("Could not update the safety stock of Sku %s", s.Sku)
+	}
+
+	return nil
+}
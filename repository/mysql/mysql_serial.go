@@ -0,0 +1,270 @@
+package mysql
+
+import (
+	"database/sql"
+	"fmt"
+	gen "github.com/pintobikez/stock-service/api/structures"
+	"strings"
+)
+
+// A serial number is free unless an unexpired reservation holds it
+const serialFree = "NOT EXISTS (SELECT 1 FROM reservation r WHERE r.id=stock_serial.reservation_id AND (r.expires_at IS NULL OR r.expires_at>UTC_TIMESTAMP()))"
+
+// Finds the serial numbers of a sku, in every warehouse when none is given, with the reservation holding each one
+func (r *Client) FindSerials(sku string, warehouse string) ([]gen.Serial, error) {
+
+	query := "SELECT sku, warehouse, serial, IF(" + serialFree + ", 0, reservation_id), created_at FROM stock_serial WHERE sku=?"
+	args := []interface{}{sku}
+
+	if warehouse != "" {
+		query += " AND warehouse=?"
+		args = append(args, warehouse)
+	}
+
+	rows, err := r.db.Query(query+" ORDER BY warehouse, serial", args...)
+	if err != nil {
+		return nil, fmt.Errorf("Could not find the serials of Sku %s", sku)
+	}
+	defer rows.Close()
+
+	serials := []gen.Serial{}
+	for rows.Next() {
+		var s gen.Serial
+
+		err = rows.Scan(&s.Sku, &s.Warehouse, &s.Serial, &s.ReservationId, &s.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("Error reading rows: %s", err.Error())
+		}
+
+		serials = append(serials, s)
+	}
+
+	return serials, nil
+}
+
+// Registers serial numbers of a sku received in a warehouse, adding a unit to its stock for each one
+// Fails with 409 when a serial number is already registered for the sku
+func (r *Client) InsertSerials(s *gen.SerialRegistration) error {
+	var found int64
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("Could not register the serials of Sku %s", s.Sku)
+	}
+	defer tx.Rollback()
+
+	units := int64(len(s.Serials))
+
+	// the stock row is locked before the serial numbers, as the reservations do
+	_, err = tx.Exec("INSERT INTO stock (sku, warehouse, quantity, updated_at) VALUES (?,?,?,now()) ON DUPLICATE KEY UPDATE quantity=quantity+VALUES(quantity), version=version+1, updated_at=now()", s.Sku, s.Warehouse, units)
+	if err != nil {
+		return fmt.Errorf("Could not register the serials of Sku %s", s.Sku)
+	}
+
+	in, args := serialArgs(s.Serials, s.Sku)
+	err = tx.QueryRow("SELECT COUNT(*) FROM stock_serial WHERE sku=? AND serial IN ("+in+")", args...).Scan(&found)
+	if err != nil {
+		return fmt.Errorf("Could not register the serials of Sku %s", s.Sku)
+	}
+	if found > 0 {
+		return fmt.Errorf("409")
+	}
+
+	values := make([]string, len(s.Serials))
+	args = nil
+	for i, serial := range s.Serials {
+		values[i] = "(?,?,?,UTC_TIMESTAMP())"
+		args = append(args, s.Sku, s.Warehouse, serial)
+	}
+
+	_, err = tx.Exec("INSERT INTO stock_serial (sku, warehouse, serial, created_at) VALUES "+strings.Join(values, ","), args...)
+	if err != nil {
+		return fmt.Errorf("Could not register the serials of Sku %s", s.Sku)
+	}
+
+	err = insertMovement(tx, &gen.StockMovement{Sku: s.Sku, Warehouse: s.Warehouse, Action: gen.ActionSerialIn, Delta: units, RequestId: s.RequestId, Caller: s.Caller})
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("Could not register the serials of Sku %s", s.Sku)
+	}
+
+	return nil
+}
+
+// Removes a free serial number of a sku, taking its unit from the stock, and sets the warehouse it was in
+// Fails with 404 when the serial number is not registered and 409 when a reservation holds it
+func (r *Client) DeleteSerial(s *gen.Serial) error {
+	var quantity int64
+
+	err := r.db.QueryRow("SELECT warehouse FROM stock_serial WHERE sku=? AND serial=?", s.Sku, s.Serial).Scan(&s.Warehouse)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("404")
+	}
+	if err != nil {
+		return fmt.Errorf("Could not remove serial %s of Sku %s", s.Serial, s.Sku)
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("Could not remove serial %s of Sku %s", s.Serial, s.Sku)
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow("SELECT quantity FROM stock WHERE sku=? AND warehouse=? FOR UPDATE", s.Sku, s.Warehouse).Scan(&quantity)
+	if err != nil {
+		return fmt.Errorf("Could not remove serial %s of Sku %s", s.Serial, s.Sku)
+	}
+
+	res, err := tx.Exec("DELETE FROM stock_serial WHERE sku=? AND warehouse=? AND serial=? AND "+serialFree, s.Sku, s.Warehouse, s.Serial)
+	if err != nil {
+		return fmt.Errorf("Could not remove serial %s of Sku %s", s.Serial, s.Sku)
+	}
+
+	affect, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("Could not remove serial %s of Sku %s", s.Serial, s.Sku)
+	}
+	if affect == 0 {
+		return fmt.Errorf("409")
+	}
+
+	_, err = tx.Exec("UPDATE stock SET quantity=quantity-1, version=version+1, updated_at=now() WHERE sku=? AND warehouse=?", s.Sku, s.Warehouse)
+	if err != nil {
+		return fmt.Errorf("Could not remove serial %s of Sku %s", s.Serial, s.Sku)
+	}
+
+	err = insertMovement(tx, &gen.StockMovement{Sku: s.Sku, Warehouse: s.Warehouse, Action: gen.ActionSerialOut, Delta: -1, RequestId: s.RequestId, Caller: s.Caller})
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("Could not remove serial %s of Sku %s", s.Serial, s.Sku)
+	}
+
+	return nil
+}
+
+// Finds the serial numbers a reservation holds
+func reservationSerials(q queryer, id int64) ([]string, error) {
+	rows, err := q.Query("SELECT serial FROM stock_serial WHERE reservation_id=? ORDER BY serial", id)
+	if err != nil {
+		return nil, fmt.Errorf("Could not find the serials of reservation %d", id)
+	}
+	defer rows.Close()
+
+	var serials []string
+	for rows.Next() {
+		var serial string
+		if err := rows.Scan(&serial); err != nil {
+			return nil, fmt.Errorf("Error reading rows: %s", err.Error())
+		}
+		serials = append(serials, serial)
+	}
+
+	return serials, nil
+}
+
+// Holds the serial numbers of a stored Reservation inside the given transaction, the given ones or else
+// the earliest registered free ones, and sets them in the reservation
+// Fails with 409 when they are not free in the warehouse of the reservation
+func holdSerials(tx *sql.Tx, re *gen.Reservation, id int64) error {
+	var res sql.Result
+	var err error
+
+	if len(re.Serials) > 0 {
+		in, args := serialArgs(re.Serials, id, re.Sku, re.Warehouse)
+		res, err = tx.Exec("UPDATE stock_serial SET reservation_id=? WHERE sku=? AND warehouse=? AND serial IN ("+in+") AND "+serialFree, args...)
+	} else {
+		res, err = tx.Exec("UPDATE stock_serial SET reservation_id=? WHERE sku=? AND warehouse=? AND "+serialFree+" ORDER BY created_at, serial LIMIT ?", id, re.Sku, re.Warehouse, re.Quantity)
+	}
+	if err != nil {
+		return fmt.Errorf("Could not hold the serials of Sku %s", re.Sku)
+	}
+
+	affect, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("Could not hold the serials of Sku %s", re.Sku)
+	}
+	if affect != re.Quantity {
+		return fmt.Errorf("409")
+	}
+
+	re.Serials, err = reservationSerials(tx, id)
+	return err
+}
+
+// Frees every serial number held by the given reservations inside the given transaction, as they are deleted
+func freeSerials(tx *sql.Tx, ids []interface{}) error {
+
+	_, err := tx.Exec("UPDATE stock_serial SET reservation_id=NULL WHERE reservation_id IN (?"+strings.Repeat(",?", len(ids)-1)+")", ids...)
+	if err != nil {
+		return fmt.Errorf("Could not free the serials of the reservations")
+	}
+
+	return nil
+}
+
+// Takes the serial numbers of the units taken from a Reservation inside the given transaction, once they were taken from it
+// Shipped serial numbers leave the stock and released ones are free again. Without serial numbers the last ones held go first
+// Fails with 404 when the reservation does not hold the given serial numbers
+func takeSerials(tx *sql.Tx, re *gen.Reservation, ship bool) error {
+	var held int64
+	var left int64
+
+	statement := "UPDATE stock_serial SET reservation_id=NULL"
+	if ship {
+		statement = "DELETE FROM stock_serial"
+	}
+
+	if len(re.Serials) > 0 {
+		in, args := serialArgs(re.Serials, re.Id)
+		res, err := tx.Exec(statement+" WHERE reservation_id=? AND serial IN ("+in+")", args...)
+		if err != nil {
+			return fmt.Errorf("Could not take the serials of reservation %d", re.Id)
+		}
+
+		affect, err := res.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("Could not take the serials of reservation %d", re.Id)
+		}
+		if affect != int64(len(re.Serials)) {
+			return fmt.Errorf("404")
+		}
+		return nil
+	}
+
+	err := tx.QueryRow("SELECT COUNT(*) FROM stock_serial WHERE reservation_id=?", re.Id).Scan(&held)
+	if err != nil {
+		return fmt.Errorf("Could not take the serials of reservation %d", re.Id)
+	}
+
+	// a reservation taken whole is deleted
+	err = tx.QueryRow("SELECT quantity FROM reservation WHERE id=?", re.Id).Scan(&left)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("Could not take the serials of reservation %d", re.Id)
+	}
+
+	if held <= left {
+		return nil
+	}
+
+	_, err = tx.Exec(statement+" WHERE reservation_id=? ORDER BY serial DESC LIMIT ?", re.Id, held-left)
+	if err != nil {
+		return fmt.Errorf("Could not take the serials of reservation %d", re.Id)
+	}
+
+	return nil
+}
+
+// Builds the placeholders of the given serial numbers and the arguments of a query, the serial numbers after the leading ones
+func serialArgs(serials []string, leading ...interface{}) (string, []interface{}) {
+	args := leading
+	for _, serial := range serials {
+		args = append(args, serial)
+	}
+	return strings.TrimSuffix(strings.Repeat("?,", len(serials)), ","), args
+}
@@ -0,0 +1,84 @@
+package mysql
+
+import (
+	"database/sql"
+	"fmt"
+	gen "github.com/pintobikez/stock-service/api/structures"
+	repo "github.com/pintobikez/stock-service/repository"
+)
+
+// Finds the SkuSettings of a sku, the defaults when none were stored
+func (r *Client) FindSkuSettings(sku string) (*gen.SkuSettings, error) {
+	s := &gen.SkuSettings{Sku: sku, Backorder: gen.BackorderDisallowed}
+
+	err := r.db.QueryRow("SELECT preorder, backorder, backorder_limit, serialized FROM sku_settings WHERE sku=?", sku).Scan(&s.Preorder, &s.Backorder, &s.BackorderLimit, &s.Serialized)
+	if err != nil && err != sql.ErrNoRows {
+		return &gen.SkuSettings{}, fmt.Errorf("Could not find the settings of Sku %s: %s", sku, err.Error())
+	}
+
+	return s, nil
+}
+
+// Stores the SkuSettings of a sku
+// Fails with 409 when the sku is made serialized or no longer serialized while it holds stock or serial numbers
+func (r *Client) UpdateSkuSettings(s *gen.SkuSettings) error {
+	var stored bool
+	var held int64
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("Could not update the settings of Sku %s", s.Sku)
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow("SELECT serialized FROM sku_settings WHERE sku=? FOR UPDATE", s.Sku).Scan(&stored)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("Could not update the settings of Sku %s", s.Sku)
+	}
+
+	// the quantity of a serialized sku must match its serial numbers
+	if stored != s.Serialized {
+		err = tx.QueryRow("SELECT (SELECT COUNT(*) FROM stock WHERE sku=?) + (SELECT COUNT(*) FROM stock_serial WHERE sku=?)", s.Sku, s.Sku).Scan(&held)
+		if err != nil {
+			return fmt.Errorf("Could not update the settings of Sku %s", s.Sku)
+		}
+		if held > 0 {
+			return fmt.Errorf("409")
+		}
+	}
+
+	_, err = tx.Exec("INSERT INTO sku_settings (sku, preorder, backorder, backorder_limit, serialized, updated_at) VALUES (?,?,?,?,?,now()) ON DUPLICATE KEY UPDATE preorder=VALUES(preorder), backorder=VALUES(backorder), backorder_limit=VALUES(backorder_limit), serialized=VALUES(serialized), updated_at=now()", s.Sku, s.Preorder, s.Backorder, s.BackorderLimit, s.Serialized)
+	if err != nil {
+		return fmt.Errorf("Could not update the settings of Sku %s", s.Sku)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("Could not update the settings of Sku %s", s.Sku)
+	}
+
+	return nil
+}
+
+// Retrieves the lowest quantity a sku can be taken to under its backorder policy inside the given transaction
+func backorderFloor(tx *sql.Tx, sku string) (int64, error) {
+	s := &gen.SkuSettings{Sku: sku, Backorder: gen.BackorderDisallowed}
+
+	err := tx.QueryRow("SELECT backorder, backorder_limit FROM sku_settings WHERE sku=?", sku).Scan(&s.Backorder, &s.BackorderLimit)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, fmt.Errorf("Could not find the backorder policy of Sku %s", sku)
+	}
+
+	return repo.BackorderFloor(s), nil
+}
+
+// Retrieves if the quantity of a sku is derived from its serial numbers inside the given transaction
+func serialized(tx *sql.Tx, sku string) (bool, error) {
+	var serialized bool
+
+	err := tx.QueryRow("SELECT serialized FROM sku_settings WHERE sku=?", sku).Scan(&serialized)
+	if err != nil && err != sql.ErrNoRows {
+		return false, fmt.Errorf("Could not find the settings of Sku %s", sku)
+	}
+
+	return serialized, nil
+}
@@ -0,0 +1,172 @@
+package mysql
+
+import (
+	"database/sql"
+	"fmt"
+	gen "github.com/pintobikez/stock-service/api/structures"
+	"time"
+)
+
+// Finds a Transfer by its id
+func (r *Client) FindTransfer(id int64) (*gen.Transfer, error) {
+	t := new(gen.Transfer)
+
+	err := r.db.QueryRow("SELECT id, sku, source, destination, quantity, status, IFNULL(reference,''), created_at, shipped_at, received_at, cancelled_at FROM transfer WHERE id=?", id).Scan(&t.Id, &t.Sku, &t.Source, &t.Destination, &t.Quantity, &t.Status, &t.Reference, &t.CreatedAt, &t.ShippedAt, &t.ReceivedAt, &t.CancelledAt)
+	if err == sql.ErrNoRows {
+		return &gen.Transfer{}, nil
+	}
+	if err != nil {
+		return &gen.Transfer{}, fmt.Errorf("Could not find transfer %d: %s", id, err.Error())
+	}
+
+	return t, nil
+}
+
+// Inserts a requested Transfer, the stock only moves once it is shipped
+func (r *Client) InsertTransfer(t *gen.Transfer) (int64, error) {
+
+	res, err := r.db.Exec("INSERT INTO transfer (sku, source, destination, quantity, status, reference, request_id, caller, created_at) VALUES (?,?,?,?,?,NULLIF(?,''),NULLIF(?,''),NULLIF(?,''),UTC_TIMESTAMP())", t.Sku, t.Source, t.Destination, t.Quantity, gen.TransferRequested, t.Reference, t.RequestId, t.Caller)
+	if err != nil {
+		return 0, fmt.Errorf("Could not insert transfer for Sku %s", t.Sku)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("Could not insert transfer for Sku %s", t.Sku)
+	}
+
+	return id, nil
+}
+
+// Ships a requested Transfer, taking its units from the available quantity of the source warehouse
+// Fails with 404 when the transfer does not exist, 412 when it is not requested and 409 when the source has not enough available units
+func (r *Client) ShipTransfer(t *gen.Transfer) error {
+	var quantity int64
+	var reserved int64
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("Could not ship transfer %d", t.Id)
+	}
+	defer tx.Rollback()
+
+	if err := lockTransfer(tx, t, gen.TransferRequested); err != nil {
+		return err
+	}
+
+	err = tx.QueryRow("SELECT quantity FROM stock WHERE sku=? AND warehouse=? FOR UPDATE", t.Sku, t.Source).Scan(&quantity)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("409")
+	}
+	if err != nil {
+		return fmt.Errorf("Could not ship transfer %d", t.Id)
+	}
+
+	err = tx.QueryRow("SELECT IFNULL(SUM(quantity),0) FROM reservation WHERE sku=? AND warehouse=? AND (expires_at IS NULL OR expires_at>UTC_TIMESTAMP())", t.Sku, t.Source).Scan(&reserved)
+	if err != nil {
+		return fmt.Errorf("Could not ship transfer %d", t.Id)
+	}
+
+	// the units of the expired lots are not shipped
+	expired, err := expiredLots(tx, t.Sku, t.Source)
+	if err != nil {
+		return err
+	}
+
+	if quantity-expired-reserved < t.Quantity {
+		return fmt.Errorf("409")
+	}
+
+	_, err = tx.Exec("UPDATE stock SET quantity=quantity-?, version=version+1, updated_at=now() WHERE sku=? AND warehouse=?", t.Quantity, t.Sku, t.Source)
+	if err != nil {
+		return fmt.Errorf("Could not ship transfer %d", t.Id)
+	}
+
+	if err := takeLots(tx, t.Sku, t.Source, t.Quantity); err != nil {
+		return err
+	}
+
+	return closeTransferStep(tx, t, gen.TransferShipped, "shipped_at", &t.ShippedAt, &gen.StockMovement{Sku: t.Sku, Warehouse: t.Source, Action: gen.ActionTransferOut, Delta: -t.Quantity})
+}
+
+// Receives a shipped Transfer, adding its units to the destination warehouse
+// Fails with 404 when the transfer does not exist and 412 when it is not shipped
+func (r *Client) ReceiveTransfer(t *gen.Transfer) error {
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("Could not receive transfer %d", t.Id)
+	}
+	defer tx.Rollback()
+
+	if err := lockTransfer(tx, t, gen.TransferShipped); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("INSERT INTO stock (sku, warehouse, quantity, updated_at) VALUES (?,?,?,now()) ON DUPLICATE KEY UPDATE quantity=quantity+VALUES(quantity), version=version+1, updated_at=now()", t.Sku, t.Destination, t.Quantity)
+	if err != nil {
+		return fmt.Errorf("Could not receive transfer %d", t.Id)
+	}
+
+	return closeTransferStep(tx, t, gen.TransferReceived, "received_at", &t.ReceivedAt, &gen.StockMovement{Sku: t.Sku, Warehouse: t.Destination, Action: gen.ActionTransferIn, Delta: t.Quantity})
+}
+
+// Cancels a requested or shipped Transfer, a shipped one gives its units back to the source warehouse
+// Fails with 404 when the transfer does not exist and 412 when it was already received or cancelled
+func (r *Client) CancelTransfer(t *gen.Transfer) error {
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("Could not cancel transfer %d", t.Id)
+	}
+	defer tx.Rollback()
+
+	if err := lockTransfer(tx, t, gen.TransferRequested, gen.TransferShipped); err != nil {
+		return err
+	}
+
+	if t.Status == gen.TransferRequested {
+		return closeTransferStep(tx, t, gen.TransferCancelled, "cancelled_at", &t.CancelledAt, nil)
+	}
+
+	_, err = tx.Exec("INSERT INTO stock (sku, warehouse, quantity, updated_at) VALUES (?,?,?,now()) ON DUPLICATE KEY UPDATE quantity=quantity+VALUES(quantity), version=version+1, updated_at=now()", t.Sku, t.Source, t.Quantity)
+	if err != nil {
+		return fmt.Errorf("Could not cancel transfer %d", t.Id)
+	}
+
+	return closeTransferStep(tx, t, gen.TransferCancelled, "cancelled_at", &t.CancelledAt, &gen.StockMovement{Sku: t.Sku, Warehouse: t.Source, Action: gen.ActionTransferBack, Delta: t.Quantity})
+}
+
+// Locks the Transfer inside the given transaction and loads it into t, failing with 412 unless it has one of the statuses
+func lockTransfer(tx *sql.Tx, t *gen.Transfer, statuses ...string) error {
+
+	err := tx.QueryRow("SELECT sku, source, destination, quantity, status FROM transfer WHERE id=? FOR UPDATE", t.Id).Scan(&t.Sku, &t.Source, &t.Destination, &t.Quantity, &t.Status)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("404")
+	}
+	if err != nil {
+		return fmt.Errorf("Could not find transfer %d: %s", t.Id, err.Error())
+	}
+
+	for _, s := range statuses {
+		if t.Status == s {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("412")
+}
+
+// Moves the Transfer to the given status, records the stock movement if any and commits the transaction
+func closeTransferStep(tx *sql.Tx, t *gen.Transfer, status string, column string, at **time.Time, m *gen.StockMovement) error {
+	if m != nil {
+		m.TransferId, m.RequestId, m.Caller = t.Id, t.RequestId, t.Caller
+	}
+
+	if err := closeStep(tx, "transfer", t.Id, status, column, at, m); err != nil {
+		return err
+	}
+
+	t.Status = status
+	return nil
+}
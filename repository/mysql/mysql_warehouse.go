@@ -0,0 +1,124 @@
+package mysql
+
+import (
+	"database/sql"
+	"fmt"
+	gen "github.com/pintobikez/stock-service/api/structures"
+)
+
+// Finds every Warehouse, the preferred ones first
+func (r *Client) FindWarehouses() ([]gen.Warehouse, error) {
+
+	rows, err := r.db.Query("SELECT code, name, active, timezone, priority, safety_stock, IFNULL(address,'') FROM warehouse ORDER BY priority, code")
+	if err != nil {
+		return nil, fmt.Errorf("Could not find warehouses: %s", err.Error())
+	}
+	defer rows.Close()
+
+	warehouses := []gen.Warehouse{}
+	for rows.Next() {
+		var w gen.Warehouse
+
+		err = rows.Scan(&w.Code, &w.Name, &w.Active, &w.Timezone, &w.Priority, &w.SafetyStock, &w.Address)
+		if err != nil {
+			return nil, fmt.Errorf("Error reading rows: %s", err.Error())
+		}
+
+		warehouses = append(warehouses, w)
+	}
+
+	return warehouses, nil
+}
+
+// Finds a Warehouse by its code
+func (r *Client) FindWarehouse(code string) (*gen.Warehouse, error) {
+	w := new(gen.Warehouse)
+
+	err := r.db.QueryRow("SELECT code, name, active, timezone, priority, safety_stock, IFNULL(address,'') FROM warehouse WHERE code=?", code).Scan(&w.Code, &w.Name, &w.Active, &w.Timezone, &w.Priority, &w.SafetyStock, &w.Address)
+	if err == sql.ErrNoRows {
+		return &gen.Warehouse{}, nil
+	}
+	if err != nil {
+		return &gen.Warehouse{}, fmt.Errorf("Could not find warehouse %s: %s", code, err.Error())
+	}
+
+	return w, nil
+}
+
+// Inserts a Warehouse, failing with 409 when the code is already in use
+func (r *Client) InsertWarehouse(w *gen.Warehouse) error {
+
+	res, err := r.db.Exec("INSERT IGNORE INTO warehouse (code, name, active, timezone, priority, safety_stock, address, created_at, updated_at) VALUES (?,?,?,?,?,?,NULLIF(?,''),now(),now())", w.Code, w.Name, w.Active, w.Timezone, w.Priority, w.SafetyStock, w.Address)
+	if err != nil {
+		return fmt.Errorf("Could not insert warehouse %s", w.Code)
+	}
+
+	affect, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("Could not insert warehouse %s", w.Code)
+	}
+
+	if affect == 0 {
+		return fmt.Errorf("409")
+	}
+
+	return nil
+}
+
+// Updates a Warehouse, failing with 404 when it does not exist
+func (r *Client) UpdateWarehouse(w *gen.Warehouse) error {
+
+	res, err := r.db.Exec("UPDATE warehouse SET name=?, active=?, timezone=?, priority=?, safety_stock=?, address=NULLIF(?,''), updated_at=now() WHERE code=?", w.Name, w.Active, w.Timezone, w.Priority, w.SafetyStock, w.Address, w.Code)
+	if err != nil {
+		return fmt.Errorf("Could not update warehouse %s", w.Code)
+	}
+
+	affect, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("Could not update warehouse %s", w.Code)
+	}
+
+	if affect == 0 {
+		return fmt.Errorf("404")
+	}
+
+	return nil
+}
+
+// Deletes a Warehouse, failing with 404 when it does not exist and with 409 while it still holds stock or reservations
+func (r *Client) DeleteWarehouse(code string) error {
+	var used int64
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("Could not delete warehouse %s", code)
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow("SELECT (SELECT COUNT(*) FROM stock WHERE warehouse=?) + (SELECT COUNT(*) FROM reservation WHERE warehouse=?)", code, code).Scan(&used)
+	if err != nil {
+		return fmt.Errorf("Could not delete warehouse %s", code)
+	}
+	if used > 0 {
+		return fmt.Errorf("409")
+	}
+
+	res, err := tx.Exec("DELETE FROM warehouse WHERE code=?", code)
+	if err != nil {
+		return fmt.Errorf("Could not delete warehouse %s", code)
+	}
+
+	affect, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("Could not delete warehouse %s", code)
+	}
+	if affect == 0 {
+		return fmt.Errorf("404")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("Could not delete warehouse %s", code)
+	}
+
+	return nil
+}
@@ -1,15 +1,416 @@
 package repository
 
-import gen "github.com/pintobikez/stock-service/api/structures"
+import (
+	"fmt"
+	gen "github.com/pintobikez/stock-service/api/structures"
+	"math"
+	"sort"
+	"time"
+)
 
 type Repository interface {
 	Connect() error
 	Disconnect()
 	FindBySkuAndWharehouse(sku string, warehouse string) (*gen.Sku, error)
 	FindSku(sku string) (*gen.SkuResponse, error)
+	FindSkus(skus []string) (map[string]*gen.SkuResponse, error)
+	FindSkuAsOf(sku string, asOf time.Time) (*gen.SkuResponse, error)
+	ListStock(f *gen.StockFilter) ([]gen.StockItem, error)
 	UpdateSku(s *gen.Sku) (int64, error)
 	InsertSku(s *gen.Sku) error
-	InsertReservation(re *gen.Reservation) error
+	AdjustSku(s *gen.Sku, delta int64) (int64, error)
+	BulkSku(rows []gen.StockRow, chunk int64) []gen.StockRowResult
+	UpdateSafetyStock(s *gen.SafetyStock) error
+	FindMovements(f *gen.MovementFilter) ([]gen.StockMovement, error)
+	FindWarehouses() ([]gen.Warehouse, error)
+	FindWarehouse(code string) (*gen.Warehouse, error)
+	InsertWarehouse(w *gen.Warehouse) error
+	UpdateWarehouse(w *gen.Warehouse) error
+	DeleteWarehouse(code string) error
+	FindAdjustment(id int64) (*gen.Adjustment, error)
+	InsertAdjustment(a *gen.Adjustment) (int64, error)
+	FindTransfer(id int64) (*gen.Transfer, error)
+	InsertTransfer(t *gen.Transfer) (int64, error)
+	ShipTransfer(t *gen.Transfer) error
+	ReceiveTransfer(t *gen.Transfer) error
+	CancelTransfer(t *gen.Transfer) error
+	FindInbound(id int64) (*gen.Inbound, error)
+	FindInbounds(sku string, warehouse string) ([]gen.Inbound, error)
+	InsertInbound(i *gen.Inbound) (int64, error)
+	ReceiveInbound(i *gen.Inbound) error
+	CancelInbound(i *gen.Inbound) error
+	FindChannelAllocations(sku string) ([]gen.ChannelAllocation, error)
+	UpdateChannelAllocation(c *gen.ChannelAllocation) error
+	FindLots(sku string) ([]gen.Lot, error)
+	UpdateLot(l *gen.Lot) error
+	FindSerials(sku string, warehouse string) ([]gen.Serial, error)
+	InsertSerials(s *gen.SerialRegistration) error
+	DeleteSerial(s *gen.Serial) error
+	FindBundle(sku string) (*gen.Bundle, error)
+	FindBundlesWith(sku string) ([]string, error)
+	UpdateBundle(b *gen.Bundle) error
+	FindSkuSettings(sku string) (*gen.SkuSettings, error)
+	UpdateSkuSettings(s *gen.SkuSettings) error
+	FindReservation(id int64) (*gen.Reservation, error)
+	InsertReservation(re *gen.Reservation) (int64, error)
+	InsertReservations(res []*gen.Reservation) error
+	InsertOrder(o *gen.Order, res []*gen.Reservation) error
 	DeleteReservation(re *gen.Reservation) error
+	CommitReservation(re *gen.Reservation) error
+	DeleteReservations(o *gen.Order) ([]string, error)
+	DeleteExpiredReservations(limit int64) (int64, []string, error)
+	FindIdempotency(key string) (*gen.Idempotency, error)
+	InsertIdempotency(i *gen.Idempotency) error
+	UpdateIdempotency(i *gen.Idempotency) error
+	DeleteIdempotency(key string) error
+	DeleteExpiredIdempotency(limit int64) (int64, error)
 	Health() error
 }
+
+// Rebuilds the SkuResponse of a sku at the given moment from its stock movements
+// The latest movement of each warehouse up to that moment holds its quantity and reserved units
+// The movements do not record the safety stock, so every available unit is reported as sellable
+func SkuAsOf(sku string, movements []gen.StockMovement, asOf time.Time) (*gen.SkuResponse, error) {
+	latest := make(map[string]gen.StockMovement)
+	var warehouses []string
+
+	for _, m := range movements {
+		if m.Sku != sku || m.CreatedAt.After(asOf) {
+			continue
+		}
+
+		l, ok := latest[m.Warehouse]
+		if !ok {
+			warehouses = append(warehouses, m.Warehouse)
+		}
+		if !ok || m.Id > l.Id {
+			latest[m.Warehouse] = m
+		}
+	}
+
+	if len(warehouses) == 0 {
+		return new(gen.SkuResponse), fmt.Errorf("%s not found", sku)
+	}
+	sort.Strings(warehouses)
+
+	resp := &gen.SkuResponse{Sku: sku}
+	for _, w := range warehouses {
+		m := latest[w]
+		v := gen.SkuValues{Quantity: m.Quantity, Warehouse: w, Reserved: m.Reserved, RawAvailable: m.Quantity - m.Reserved, Available: m.Quantity - m.Reserved}
+		if v.RawAvailable < 0 {
+			v.Backordered = -v.RawAvailable
+		}
+		resp.Values = append(resp.Values, v)
+		resp.Reserved += v.Reserved
+		resp.RawAvailable += v.RawAvailable
+		resp.Available += v.Available
+		resp.Backordered += v.Backordered
+	}
+
+	return resp, nil
+}
+
+// Retrieves the lowest quantity a sku can be taken to under its backorder policy
+func BackorderFloor(s *gen.SkuSettings) int64 {
+	switch s.Backorder {
+	case gen.BackorderUnlimited:
+		return math.MinInt64
+	case gen.BackorderCapped:
+		return -s.BackorderLimit
+	}
+	return 0
+}
+
+// Retrieves the free units of the allocations of a warehouse ring-fenced for the channels other than the given one,
+// and the free units of the given channel when it has an allocation in the warehouse
+func ChannelFences(allocations []gen.ChannelAllocation, channel string) (int64, int64, bool) {
+	var others, own int64
+	fenced := false
+
+	for _, c := range allocations {
+		free := c.Allocated - c.Reserved
+		if free < 0 {
+			free = 0
+		}
+		if c.Channel == channel {
+			own, fenced = free, true
+			continue
+		}
+		others += free
+	}
+
+	return others, own, fenced
+}
+
+// Retrieves the available units of a warehouse a channel can take
+func channelAvailable(v gen.SkuValues, allocations []gen.ChannelAllocation, channel string) int64 {
+	others, own, fenced := ChannelFences(allocations, channel)
+
+	avail := v.Available - others
+	if avail < 0 {
+		// the fences of the other channels never turn a short warehouse shorter
+		avail = 0
+		if v.Available < 0 {
+			avail = v.Available
+		}
+	}
+	if fenced && own < avail {
+		avail = own
+	}
+
+	return avail
+}
+
+// Fills the available units of each channel with an allocation in the stock of a sku, by warehouse and in total,
+// with the units shared by the channels without allocation kept as the shared channel
+// A channel takes the shared units of the warehouses where it has no allocation
+func ApplyChannels(s *gen.SkuResponse, allocations []gen.ChannelAllocation) {
+	if len(allocations) == 0 {
+		return
+	}
+
+	byWarehouse := make(map[string][]gen.ChannelAllocation)
+	channels := []string{gen.ChannelShared}
+	seen := map[string]bool{gen.ChannelShared: true}
+	for _, c := range allocations {
+		byWarehouse[c.Warehouse] = append(byWarehouse[c.Warehouse], c)
+		if !seen[c.Channel] {
+			seen[c.Channel] = true
+			channels = append(channels, c.Channel)
+		}
+	}
+
+	s.Channels = make(map[string]int64)
+	for i := range s.Values {
+		v := &s.Values[i]
+		v.Channels = map[string]int64{gen.ChannelShared: channelAvailable(*v, byWarehouse[v.Warehouse], "")}
+		for _, c := range byWarehouse[v.Warehouse] {
+			v.Channels[c.Channel] = channelAvailable(*v, byWarehouse[v.Warehouse], c.Channel)
+		}
+
+		for _, channel := range channels {
+			avail, ok := v.Channels[channel]
+			if !ok {
+				avail = v.Channels[gen.ChannelShared]
+			}
+			s.Channels[channel] += avail
+		}
+	}
+}
+
+// Retrieves the stock of a sku as seen by a channel, with the units the channel can take as the available ones
+func ForChannel(s *gen.SkuResponse, channel string) *gen.SkuResponse {
+	resp := *s
+	resp.Channel = channel
+	resp.Available = 0
+	resp.Values = make([]gen.SkuValues, len(s.Values))
+
+	for i, v := range s.Values {
+		if v.Channels != nil {
+			avail, ok := v.Channels[channel]
+			if !ok {
+				avail = v.Channels[gen.ChannelShared]
+			}
+			v.Available = avail
+		}
+		resp.Values[i] = v
+		resp.Available += v.Available
+	}
+
+	return &resp
+}
+
+// Derives the stock of a bundle from the stock of its components, each warehouse holding the complete bundles
+// its components make up there, for every channel too. A warehouse missing a component holds no bundle,
+// and the reserved units are kept by the reservations of the components
+func BundleStock(b *gen.Bundle, components map[string]*gen.SkuResponse) *gen.SkuResponse {
+	resp := &gen.SkuResponse{Sku: b.Sku, Values: []gen.SkuValues{}, Components: b.Components}
+
+	byWarehouse := make(map[string]map[string]gen.SkuValues)
+	var warehouses, channels []string
+	seen := make(map[string]bool)
+	for _, c := range b.Components {
+		s, ok := components[c.Sku]
+		if !ok {
+			return resp
+		}
+		for _, v := range s.Values {
+			if byWarehouse[v.Warehouse] == nil {
+				byWarehouse[v.Warehouse] = make(map[string]gen.SkuValues)
+				warehouses = append(warehouses, v.Warehouse)
+			}
+			byWarehouse[v.Warehouse][c.Sku] = v
+
+			for channel := range v.Channels {
+				if !seen[channel] {
+					seen[channel] = true
+					channels = append(channels, channel)
+				}
+			}
+		}
+	}
+	sort.Strings(warehouses)
+	sort.Strings(channels)
+
+	for _, w := range warehouses {
+		if len(byWarehouse[w]) < len(b.Components) {
+			continue
+		}
+
+		v := gen.SkuValues{Warehouse: w}
+		if len(channels) > 0 {
+			v.Channels = make(map[string]int64)
+		}
+		for i, c := range b.Components {
+			cv := byWarehouse[w][c.Sku]
+
+			quantity, raw, avail := bundleUnits(cv.Quantity, c.Quantity), bundleUnits(cv.RawAvailable, c.Quantity), bundleUnits(cv.Available, c.Quantity)
+			if i == 0 || quantity < v.Quantity {
+				v.Quantity = quantity
+			}
+			if i == 0 || raw < v.RawAvailable {
+				v.RawAvailable = raw
+			}
+			if i == 0 || avail < v.Available {
+				v.Available = avail
+			}
+
+			// a component without allocations shares every available unit with every channel
+			for _, channel := range channels {
+				units := cv.Available
+				if cv.Channels != nil {
+					var ok bool
+					if units, ok = cv.Channels[channel]; !ok {
+						units = cv.Channels[gen.ChannelShared]
+					}
+				}
+				current, ok := v.Channels[channel]
+				if units = bundleUnits(units, c.Quantity); !ok || units < current {
+					v.Channels[channel] = units
+				}
+			}
+		}
+		if v.RawAvailable < 0 {
+			v.Backordered = -v.RawAvailable
+		}
+
+		resp.Values = append(resp.Values, v)
+		resp.RawAvailable += v.RawAvailable
+		resp.Available += v.Available
+		resp.Backordered += v.Backordered
+		for channel, units := range v.Channels {
+			if resp.Channels == nil {
+				resp.Channels = make(map[string]int64)
+			}
+			resp.Channels[channel] += units
+		}
+	}
+
+	return resp
+}
+
+// Retrieves the complete bundles the given units of a component make up, rounded down so a bundle partly short counts as short
+func bundleUnits(units int64, per int64) int64 {
+	bundles := units / per
+	if units < 0 && units%per != 0 {
+		bundles--
+	}
+	return bundles
+}
+
+// Retrieves every given sku once followed by the bundles made of them, which publish their stock when the stock
+// of a component changes, and the skus whose bundles could not be found
+func WithBundles(rp Repository, skus []string) ([]string, []string) {
+	var found []string
+	var failed []string
+	seen := make(map[string]bool)
+
+	for _, sku := range skus {
+		if !seen[sku] {
+			seen[sku] = true
+			found = append(found, sku)
+		}
+	}
+
+	for i := 0; i < len(found); i++ {
+		bundles, err := rp.FindBundlesWith(found[i])
+		if err != nil {
+			failed = append(failed, found[i])
+			continue
+		}
+		for _, b := range bundles {
+			if !seen[b] {
+				seen[b] = true
+				found = append(found, b)
+			}
+		}
+	}
+
+	return found, failed
+}
+
+// Spreads the reserved units of each warehouse over its lots, first-expiry-first-out
+// The lots are expected sorted by warehouse and expiry date, and the expired ones hold no reserved unit
+func AssignLots(lots []gen.Lot, reserved map[string]int64) {
+	left := make(map[string]int64)
+	for warehouse, units := range reserved {
+		left[warehouse] = units
+	}
+
+	for i := range lots {
+		l := &lots[i]
+		l.Reserved = 0
+		if l.Expired || left[l.Warehouse] <= 0 {
+			continue
+		}
+
+		l.Reserved = l.Quantity
+		if left[l.Warehouse] < l.Reserved {
+			l.Reserved = left[l.Warehouse]
+		}
+		left[l.Warehouse] -= l.Reserved
+	}
+}
+
+// Retrieves if the reservations of a sku in a warehouse are left short of the units they were promised once an inbound
+// supply is cancelled, given the units on hand and the supply still expected without it
+// Only a pre-orderable sku promises its inbound supply, so the safety stock and the reservations of any other sku do not count
+func PreordersShort(quantity int64, reserved int64, expected int64, preorder bool) bool {
+	return preorder && reserved > quantity+expected
+}
+
+// Projects the units of a sku that can be promised over time, in every warehouse when none is given
+// The projection starts at now with the available units less the safety stock, and each expected inbound supply
+// adds its units at its expected date. Supply expected before now is counted at now
+func AvailableToPromise(s *gen.SkuResponse, inbounds []gen.Inbound, warehouse string, now time.Time) *gen.Atp {
+	atp := &gen.Atp{Sku: s.Sku, Warehouse: warehouse}
+
+	current := gen.AtpPoint{Date: now}
+	for _, v := range s.Values {
+		if warehouse == "" || v.Warehouse == warehouse {
+			current.Available += v.RawAvailable - v.SafetyStock
+		}
+	}
+
+	sorted := make([]gen.Inbound, 0, len(inbounds))
+	for _, i := range inbounds {
+		if warehouse == "" || i.Warehouse == warehouse {
+			sorted = append(sorted, i)
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].ExpectedAt.Before(*sorted[j].ExpectedAt)
+	})
+
+	for _, i := range sorted {
+		if i.ExpectedAt.After(current.Date) {
+			atp.Points = append(atp.Points, current)
+			current = gen.AtpPoint{Date: i.ExpectedAt.UTC(), Available: current.Available}
+		}
+		current.Inbound += i.Quantity
+		current.Available += i.Quantity
+	}
+	atp.Points = append(atp.Points, current)
+
+	return atp
+}
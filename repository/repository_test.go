@@ -0,0 +1,301 @@
+package repository
+
+import (
+	gen "github.com/pintobikez/stock-service/api/structures"
+	"github.com/stretchr/testify/assert"
+	"math"
+	"testing"
+	"time"
+)
+
+/*
+Tests for SkuAsOf
+*/
+var testMovements = []gen.StockMovement{
+	{Id: 1, Sku: "A1", Warehouse: "B", Action: gen.ActionSet, Delta: 4, Quantity: 4, CreatedAt: time.Date(2017, 1, 1, 9, 0, 0, 0, time.UTC)},
+	{Id: 2, Sku: "A1", Warehouse: "A", Action: gen.ActionSet, Delta: 10, Quantity: 10, CreatedAt: time.Date(2017, 1, 1, 10, 0, 0, 0, time.UTC)},
+	{Id: 3, Sku: "A2", Warehouse: "A", Action: gen.ActionSet, Delta: 7, Quantity: 7, CreatedAt: time.Date(2017, 1, 1, 10, 0, 0, 0, time.UTC)},
+	{Id: 4, Sku: "A1", Warehouse: "A", Action: gen.ActionReserve, Delta: 3, Quantity: 10, Reserved: 3, CreatedAt: time.Date(2017, 1, 1, 11, 0, 0, 0, time.UTC)},
+	{Id: 5, Sku: "A1", Warehouse: "A", Action: gen.ActionSub, Delta: -2, Quantity: 8, Reserved: 3, CreatedAt: time.Date(2017, 1, 1, 11, 0, 0, 0, time.UTC)},
+	{Id: 6, Sku: "A1", Warehouse: "B", Action: gen.ActionSub, Delta: -4, Quantity: 0, CreatedAt: time.Date(2017, 1, 1, 12, 0, 0, 0, time.UTC)},
+	{Id: 7, Sku: "A4", Warehouse: "A", Action: gen.ActionSub, Delta: -2, Quantity: -2, CreatedAt: time.Date(2017, 1, 1, 13, 0, 0, 0, time.UTC)},
+}
+
+type skuAsOfProvider struct {
+	sku       string
+	asOf      time.Time
+	err       bool
+	values    []gen.SkuValues
+	reserved  int64
+	available int64
+}
+
+var testSkuAsOfProvider = []skuAsOfProvider{
+	{"A1", time.Date(2017, 1, 1, 8, 0, 0, 0, time.UTC), true, nil, 0, 0},                                                                                                                                                        // before the first movement
+	{"A3", time.Date(2017, 1, 2, 0, 0, 0, 0, time.UTC), true, nil, 0, 0},                                                                                                                                                        // sku without movements
+	{"A1", time.Date(2017, 1, 1, 9, 0, 0, 0, time.UTC), false, []gen.SkuValues{{Quantity: 4, Warehouse: "B", RawAvailable: 4, Available: 4}}, 0, 4},                                                                             // movement at the exact moment
+	{"A1", time.Date(2017, 1, 1, 10, 30, 0, 0, time.UTC), false, []gen.SkuValues{{Quantity: 10, Warehouse: "A", RawAvailable: 10, Available: 10}, {Quantity: 4, Warehouse: "B", RawAvailable: 4, Available: 4}}, 0, 14},         // warehouses sorted
+	{"A1", time.Date(2017, 1, 1, 11, 0, 0, 0, time.UTC), false, []gen.SkuValues{{Quantity: 8, Warehouse: "A", Reserved: 3, RawAvailable: 5, Available: 5}, {Quantity: 4, Warehouse: "B", RawAvailable: 4, Available: 4}}, 3, 9}, // same moment, latest id wins
+	{"A1", time.Date(2017, 1, 2, 0, 0, 0, 0, time.UTC), false, []gen.SkuValues{{Quantity: 8, Warehouse: "A", Reserved: 3, RawAvailable: 5, Available: 5}, {Quantity: 0, Warehouse: "B", RawAvailable: 0, Available: 0}}, 3, 5},  // every movement
+	{"A2", time.Date(2017, 1, 2, 0, 0, 0, 0, time.FixedZone("WEST", 3600)), false, []gen.SkuValues{{Quantity: 7, Warehouse: "A", RawAvailable: 7, Available: 7}}, 0, 7},                                                         // other sku, other timezone
+	{"A4", time.Date(2017, 1, 2, 0, 0, 0, 0, time.UTC), false, []gen.SkuValues{{Quantity: -2, Warehouse: "A", RawAvailable: -2, Available: -2, Backordered: 2}}, 0, -2},                                                         // backordered
+}
+
+func TestSkuAsOf(t *testing.T) {
+	for _, pair := range testSkuAsOfProvider {
+		resp, err := SkuAsOf(pair.sku, testMovements, pair.asOf)
+
+		if pair.err {
+			assert.Error(t, err)
+			continue
+		}
+
+		assert.NoError(t, err)
+		assert.Equal(t, pair.sku, resp.Sku, "Sku doesn't match")
+		assert.Equal(t, pair.values, resp.Values, "Values don't match")
+		assert.Equal(t, pair.reserved, resp.Reserved, "Reserved doesn't match")
+		assert.Equal(t, pair.available, resp.Available, "Available doesn't match")
+	}
+}
+
+/*
+Tests for BackorderFloor
+*/
+type backorderFloorProvider struct {
+	settings gen.SkuSettings
+	floor    int64
+}
+
+var testBackorderFloorProvider = []backorderFloorProvider{
+	{gen.SkuSettings{}, 0}, // no policy
+	{gen.SkuSettings{Backorder: gen.BackorderDisallowed, BackorderLimit: 5}, 0}, // limit of another policy
+	{gen.SkuSettings{Backorder: gen.BackorderCapped, BackorderLimit: 5}, -5},    // capped
+	{gen.SkuSettings{Backorder: gen.BackorderUnlimited}, math.MinInt64},         // unlimited
+}
+
+func TestBackorderFloor(t *testing.T) {
+	for _, pair := range testBackorderFloorProvider {
+		assert.Equal(t, pair.floor, BackorderFloor(&pair.settings), "Floor of "+pair.settings.Backorder+" doesn't match")
+	}
+}
+
+/*
+Tests for ApplyChannels and ForChannel
+*/
+var testChannelAllocations = []gen.ChannelAllocation{
+	{Sku: "A1", Warehouse: "A", Channel: "marketplace", Allocated: 2},
+	{Sku: "A1", Warehouse: "A", Channel: "web", Allocated: 4, Reserved: 1},
+	{Sku: "A1", Warehouse: "B", Channel: "web", Allocated: 3, Reserved: 5},
+	{Sku: "A1", Warehouse: "C", Channel: "retail", Allocated: 6},
+}
+
+type channelsProvider struct {
+	channel   string
+	available int64
+	values    []int64
+}
+
+var testChannelsProvider = []channelsProvider{
+	{"web", 3, []int64{3, 0, 0}},         // allocated in A and B, none left in B
+	{"marketplace", 4, []int64{2, 2, 0}}, // allocated in A only
+	{"retail", 9, []int64{5, 2, 2}},      // allocation larger than the available units
+	{"pos", 7, []int64{5, 2, 0}},         // channel without allocation
+	{"shared", 7, []int64{5, 2, 0}},      // units shared by the channels without allocation
+}
+
+func testChannelStock() *gen.SkuResponse {
+	return &gen.SkuResponse{Sku: "A1", Values: []gen.SkuValues{
+		{Quantity: 10, Warehouse: "A", Available: 10},
+		{Quantity: 8, Warehouse: "B", Reserved: 6, Available: 2},
+		{Quantity: 2, Warehouse: "C", Available: 2},
+	}, Available: 14}
+}
+
+func TestApplyChannels(t *testing.T) {
+	s := testChannelStock()
+	ApplyChannels(s, nil)
+	assert.Nil(t, s.Channels, "Channels without allocations don't match")
+
+	ApplyChannels(s, testChannelAllocations)
+	assert.Equal(t, map[string]int64{"shared": 7, "web": 3, "marketplace": 4, "retail": 9}, s.Channels, "Channels don't match")
+	assert.Equal(t, map[string]int64{"shared": 5, "web": 3, "marketplace": 2}, s.Values[0].Channels, "Channels of A don't match")
+	assert.Equal(t, map[string]int64{"shared": 0, "retail": 2}, s.Values[2].Channels, "Channels of C don't match")
+	assert.Equal(t, int64(14), s.Available, "Available doesn't match")
+
+	for _, pair := range testChannelsProvider {
+		c := ForChannel(s, pair.channel)
+
+		assert.Equal(t, pair.channel, c.Channel, "Channel doesn't match")
+		assert.Equal(t, pair.available, c.Available, "Available of "+pair.channel+" doesn't match")
+
+		var values []int64
+		for _, v := range c.Values {
+			values = append(values, v.Available)
+		}
+		assert.Equal(t, pair.values, values, "Available by warehouse of "+pair.channel+" doesn't match")
+	}
+
+	// the stock of the sku is left as it was
+	assert.Equal(t, int64(10), s.Values[0].Available, "Available of A doesn't match")
+}
+
+/*
+Tests for AvailableToPromise
+*/
+var testAtpNow = time.Date(2017, 1, 10, 12, 0, 0, 0, time.UTC)
+
+var testAtpStock = &gen.SkuResponse{Sku: "A1", Values: []gen.SkuValues{
+	{Quantity: 10, Warehouse: "A", Reserved: 12, SafetyStock: 1, RawAvailable: -2, Available: -2},
+	{Quantity: 6, Warehouse: "B", Reserved: 1, SafetyStock: 2, RawAvailable: 5, Available: 3},
+}}
+
+func testAtpDate(day int) *time.Time {
+	d := time.Date(2017, 1, day, 0, 0, 0, 0, time.UTC)
+	return &d
+}
+
+var testAtpInbounds = []gen.Inbound{
+	{Id: 1, Sku: "A1", Warehouse: "A", Quantity: 5, ExpectedAt: testAtpDate(20)},
+	{Id: 2, Sku: "A1", Warehouse: "B", Quantity: 4, ExpectedAt: testAtpDate(15)},
+	{Id: 3, Sku: "A1", Warehouse: "A", Quantity: 2, ExpectedAt: testAtpDate(9)},
+	{Id: 4, Sku: "A1", Warehouse: "B", Quantity: 1, ExpectedAt: testAtpDate(20)},
+}
+
+type atpProvider struct {
+	warehouse string
+	inbounds  []gen.Inbound
+	points    []gen.AtpPoint
+}
+
+var testAtpProvider = []atpProvider{
+	{"", nil, []gen.AtpPoint{{Date: testAtpNow, Available: 0}}}, // without inbound supply
+	{"", testAtpInbounds, []gen.AtpPoint{{Date: testAtpNow, Inbound: 2, Available: 2}, {Date: *testAtpDate(15), Inbound: 4, Available: 6}, {Date: *testAtpDate(20), Inbound: 6, Available: 12}}}, // every warehouse, late supply counted now
+	{"A", testAtpInbounds, []gen.AtpPoint{{Date: testAtpNow, Inbound: 2, Available: -1}, {Date: *testAtpDate(20), Inbound: 5, Available: 4}}},                                                    // pre-ordered warehouse
+	{"B", testAtpInbounds, []gen.AtpPoint{{Date: testAtpNow, Available: 3}, {Date: *testAtpDate(15), Inbound: 4, Available: 7}, {Date: *testAtpDate(20), Inbound: 1, Available: 8}}},             // single warehouse
+	{"C", testAtpInbounds, []gen.AtpPoint{{Date: testAtpNow, Available: 0}}},                                                                                                                     // warehouse without stock
+}
+
+func TestAvailableToPromise(t *testing.T) {
+	for _, pair := range testAtpProvider {
+		atp := AvailableToPromise(testAtpStock, pair.inbounds, pair.warehouse, testAtpNow)
+
+		assert.Equal(t, "A1", atp.Sku, "Sku doesn't match")
+		assert.Equal(t, pair.warehouse, atp.Warehouse, "Warehouse doesn't match")
+		assert.Equal(t, pair.points, atp.Points, "Points of "+pair.warehouse+" don't match")
+	}
+}
+
+/*
+Tests for PreordersShort
+*/
+type preordersShortProvider struct {
+	quantity int64
+	reserved int64
+	expected int64
+	preorder bool
+	short    bool
+}
+
+var testPreordersShortProvider = []preordersShortProvider{
+	{5, 0, 0, false, false}, // not pre-orderable, on hand below the safety stock
+	{5, 8, 0, false, false}, // not pre-orderable, backordered
+	{5, 0, 0, true, false},  // pre-orderable without reservations
+	{5, 5, 0, true, false},  // reservations held by the units on hand
+	{5, 8, 3, true, false},  // reservations held by the supply still expected
+	{5, 8, 2, true, true},   // pre-orders left short
+}
+
+func TestPreordersShort(t *testing.T) {
+	for _, pair := range testPreordersShortProvider {
+		assert.Equal(t, pair.short, PreordersShort(pair.quantity, pair.reserved, pair.expected, pair.preorder), "Short doesn't match")
+	}
+}
+
+/*
+Tests for AssignLots
+*/
+type lotsProvider struct {
+	reserved map[string]int64
+	values   []int64
+}
+
+var testLotsProvider = []lotsProvider{
+	{nil, []int64{0, 0, 0, 0, 0}},                               // nothing reserved
+	{map[string]int64{"A": 3}, []int64{0, 3, 0, 0, 0}},          // earliest unexpired lot first
+	{map[string]int64{"A": 7, "B": 2}, []int64{0, 4, 3, 2, 0}},  // spread over the next lots
+	{map[string]int64{"A": 20, "B": 9}, []int64{0, 4, 6, 2, 5}}, // reserved beyond the lots
+	{map[string]int64{"A": -2, "C": 4}, []int64{0, 0, 0, 0, 0}}, // nothing reserved in the warehouses of the lots
+}
+
+func testLots() []gen.Lot {
+	return []gen.Lot{
+		{Sku: "A1", Warehouse: "A", Lot: "L1", Quantity: 5, Expired: true},
+		{Sku: "A1", Warehouse: "A", Lot: "L2", Quantity: 4},
+		{Sku: "A1", Warehouse: "A", Lot: "L3", Quantity: 6},
+		{Sku: "A1", Warehouse: "B", Lot: "L4", Quantity: 2},
+		{Sku: "A1", Warehouse: "B", Lot: "L5", Quantity: 5},
+	}
+}
+
+func TestAssignLots(t *testing.T) {
+	for _, pair := range testLotsProvider {
+		lots := testLots()
+		AssignLots(lots, pair.reserved)
+
+		var values []int64
+		for _, l := range lots {
+			values = append(values, l.Reserved)
+		}
+		assert.Equal(t, pair.values, values, "Reserved units of the lots don't match")
+	}
+}
+
+/*
+Tests for BundleStock
+*/
+var testBundleComponents = map[string]*gen.SkuResponse{
+	"K1": {Sku: "K1", Values: []gen.SkuValues{
+		{Quantity: 10, Warehouse: "A", Reserved: 3, RawAvailable: 7, Available: 7},
+		{Quantity: 3, Warehouse: "B", RawAvailable: 3, Available: 3},
+		{Quantity: -3, Warehouse: "C", RawAvailable: -3, Available: -3, Backordered: 3},
+	}},
+	"K2": {Sku: "K2", Values: []gen.SkuValues{
+		{Quantity: 4, Warehouse: "A", RawAvailable: 4, Available: 4, Channels: map[string]int64{"shared": 1, "web": 3}},
+		{Quantity: 5, Warehouse: "B", RawAvailable: 5, Available: 5},
+		{Quantity: 2, Warehouse: "C", RawAvailable: 2, Available: 2},
+		{Quantity: 9, Warehouse: "D", RawAvailable: 9, Available: 9},
+	}},
+}
+
+type bundleStockProvider struct {
+	components []gen.Component
+	values     []gen.SkuValues
+	available  int64
+	channels   map[string]int64
+}
+
+var testBundleStockProvider = []bundleStockProvider{
+	{[]gen.Component{{Sku: "K1", Quantity: 1}, {Sku: "K3", Quantity: 1}}, []gen.SkuValues{}, 0, nil}, // component without stock
+	{[]gen.Component{{Sku: "K1", Quantity: 2}}, []gen.SkuValues{ // single component, short bundles rounded down
+		{Quantity: 5, Warehouse: "A", RawAvailable: 3, Available: 3},
+		{Quantity: 1, Warehouse: "B", RawAvailable: 1, Available: 1},
+		{Quantity: -2, Warehouse: "C", RawAvailable: -2, Available: -2, Backordered: 2},
+	}, 2, nil},
+	{[]gen.Component{{Sku: "K1", Quantity: 2}, {Sku: "K2", Quantity: 1}}, []gen.SkuValues{ // fewest bundles of every component, warehouse missing a component left out
+		{Quantity: 4, Warehouse: "A", RawAvailable: 3, Available: 3, Channels: map[string]int64{"shared": 1, "web": 3}},
+		{Quantity: 1, Warehouse: "B", RawAvailable: 1, Available: 1, Channels: map[string]int64{"shared": 1, "web": 1}},
+		{Quantity: -2, Warehouse: "C", RawAvailable: -2, Available: -2, Backordered: 2, Channels: map[string]int64{"shared": -2, "web": -2}},
+	}, 2, map[string]int64{"shared": 0, "web": 2}},
+}
+
+func TestBundleStock(t *testing.T) {
+	for _, pair := range testBundleStockProvider {
+		resp := BundleStock(&gen.Bundle{Sku: "BN", Components: pair.components}, testBundleComponents)
+
+		assert.Equal(t, "BN", resp.Sku, "Sku doesn't match")
+		assert.Equal(t, pair.components, resp.Components, "Components don't match")
+		assert.Equal(t, pair.values, resp.Values, "Values don't match")
+		assert.Equal(t, pair.available, resp.Available, "Available doesn't match")
+		assert.Equal(t, pair.channels, resp.Channels, "Channels don't match")
+	}
+}